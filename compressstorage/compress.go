@@ -0,0 +1,601 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package compressstorage implements stowage.Disk over another disk
+// compressing the files at rest with gzip or zstd, the files are
+// streamed through the compression in both directions, the files
+// excluded by the rules and the already compressed media are stored
+// as they are behind a header, the sizes reported are the sizes of
+// the content, the files written to the wrapped disk directly
+// have no header and are read as they are
+package compressstorage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/internal/replace"
+	"github.com/harranali/stowage/localstorage"
+)
+
+// make sure the compressed storage supports all operations
+var _ stowage.Disk = (*CompressStorage)(nil)
+
+// Opts options of the compressed storage
+type Opts struct {
+	// Algorithm compresses the new files, it defaults to Gzip,
+	// the files are read whatever algorithm they were compressed with
+	Algorithm Algorithm
+	// Level is the compression level of the algorithm,
+	// zero uses the default level
+	Level int
+	// Include lists the extensions without the dot of the files to
+	// compress, the listed extensions are compressed even if they are
+	// media, by default all files but the media are compressed
+	Include []string
+	// Exclude lists the extensions without the dot of the
+	// files never compressed, it takes precedence over Include
+	Exclude []string
+}
+
+// mediaTypes are the already compressed media types stored as they are
+var mediaTypes = []string{
+	"image/*", "video/*", "audio/*", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/vnd.rar",
+}
+
+// compressibleTypes are the exceptions to the media types
+var compressibleTypes = []string{"image/svg+xml", "image/bmp", "image/x-icon"}
+
+// CompressStorage compresses the files of the disk it wraps
+type CompressStorage struct {
+	disk    stowage.Disk
+	opts    Opts
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// Wrap returns a disk compressing the files written to the given disk
+// and decompressing the files read from it, the directories and the
+// paths are kept as they are
+func Wrap(disk stowage.Disk, opts Opts) *CompressStorage {
+	if opts.Algorithm == "" {
+		opts.Algorithm = Gzip
+	}
+
+	return &CompressStorage{
+		disk:    disk,
+		opts:    opts,
+		include: extensionSet(opts.Include),
+		exclude: extensionSet(opts.Exclude),
+	}
+}
+
+// Name returns the name of the wrapped disk
+func (c *CompressStorage) Name() string {
+	if named, ok := c.disk.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	return "compressed"
+}
+
+// FileInfo returns information about the given file or directory, the
+// size is the size of the content, it returns an error incase there is any
+func (c *CompressStorage) FileInfo(filePath string) (fileinfo localstorage.FileInfo, err error) {
+	info, err := c.disk.FileInfo(filePath)
+	if err != nil {
+		return localstorage.FileInfo{}, err
+	}
+
+	return c.plainInfo("fileinfo", filePath, info)
+}
+
+// Put compresses the given file from the local file system into the
+// root folder, it returns error incase there is any
+func (c *CompressStorage) Put(filePath string) error {
+	return c.PutAs(filePath, filepath.Base(filePath))
+}
+
+// PutAs compresses the given file from the local file system into the
+// root folder with the given name, it returns error incase there is any
+func (c *CompressStorage) PutAs(filePath string, filename string) error {
+	st, err := os.Stat(filePath)
+	if err != nil {
+		return c.pathError("put", filePath, err)
+	}
+	if st.IsDir() {
+		return c.pathError("put", filePath, stowage.ErrIsDirectory)
+	}
+	if !st.Mode().IsRegular() {
+		return c.pathError("put", filePath, stowage.ErrNotRegular)
+	}
+
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return c.pathError("put", filePath, err)
+	}
+	defer srcFile.Close()
+
+	_, err = c.WriteStream(filename, srcFile)
+
+	return err
+}
+
+// Copy copies the stored file into the destination folder,
+// it returns an error incase there is any
+func (c *CompressStorage) Copy(filePath string, destfolder string) error {
+	return c.disk.Copy(filePath, destfolder)
+}
+
+// CopyAs copies the stored file into the destination folder with the
+// given name, it returns an error incase there is any
+func (c *CompressStorage) CopyAs(filePath string, destfolder string, newFilePath string) error {
+	return c.disk.CopyAs(filePath, destfolder, newFilePath)
+}
+
+// Move moves the stored file into the destination folder,
+// it returns an error incase there is any
+func (c *CompressStorage) Move(filePath string, destfolder string) error {
+	return c.disk.Move(filePath, destfolder)
+}
+
+// MoveAs moves the stored file into the destination folder with the
+// given name, it returns an error incase there is any
+func (c *CompressStorage) MoveAs(filePath string, destFolder string, newFilePath string) error {
+	return c.disk.MoveAs(filePath, destFolder, newFilePath)
+}
+
+// Rename renames the stored file, it returns error incase there is any
+func (c *CompressStorage) Rename(filePath string, newFilePath string) error {
+	return c.disk.Rename(filePath, newFilePath)
+}
+
+// Delete deletes the given file it returns error incase there is any
+func (c *CompressStorage) Delete(filePath string) error {
+	return c.disk.Delete(filePath)
+}
+
+// DeleteMultiple deletes the given files, it returns error incase there is any
+func (c *CompressStorage) DeleteMultiple(filePaths []string) error {
+	return c.disk.DeleteMultiple(filePaths)
+}
+
+// Create creates a new file with the content compressed unless the rules
+// exclude it, it returns error incase there is any
+func (c *CompressStorage) Create(filePath string, content []byte) error {
+	_, err := c.WriteStream(filePath, bytes.NewReader(content))
+
+	return err
+}
+
+// WriteStream creates a new file and streams into it the content read from
+// the given reader compressed unless the rules exclude it, the media type
+// is found by the extension or by sniffing the start of the content, it
+// returns the number of bytes read from the reader and an error incase there is any
+func (c *CompressStorage) WriteStream(filePath string, r io.Reader) (int64, error) {
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	if !c.compressible(filePath, head) {
+		n, err := c.disk.WriteStream(filePath, io.MultiReader(bytes.NewReader(header(storedID)), br))
+		if err != nil {
+			return 0, err
+		}
+		return n - int64(headerSize), nil
+	}
+
+	compressed, stop := compressReader(br, c.opts.Algorithm, c.opts.Level)
+	_, err := c.disk.WriteStream(filePath, compressed)
+	n := stop(err)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Append appends content to a file, a compressed file is compressed again
+// with the content appended to it, it returns error incase there is any
+func (c *CompressStorage) Append(filePath string, content []byte) error {
+	current, compressed, err := c.open("append", filePath)
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+	if !compressed {
+		current.Close()
+		return c.disk.Append(filePath, content)
+	}
+
+	// the file is left as it was when the write fails
+	compressedContent, stop := compressReader(io.MultiReader(current, bytes.NewReader(content)), c.opts.Algorithm, c.opts.Level)
+	_, err = replace.Write(c.disk, filePath, compressedContent)
+	stop(err)
+
+	return err
+}
+
+// Exists checks if a file or a directory exists,
+// it returns a bool and an error incase any
+func (c *CompressStorage) Exists(filePath string) (bool, error) {
+	return c.disk.Exists(filePath)
+}
+
+// Missing checks if a file or a directory is missing,
+// it returns a bool and an error incase any
+func (c *CompressStorage) Missing(filePath string) (bool, error) {
+	return c.disk.Missing(filePath)
+}
+
+// Read reads and decompresses the given file,
+// it returns an error incase there is any
+func (c *CompressStorage) Read(filePath string) ([]byte, error) {
+	r, err := c.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, c.pathError("read", filePath, err)
+	}
+
+	return content, nil
+}
+
+// ReadStream returns a reader decompressing the file, the size of the
+// content is checked once it's read, the readers of the files stored as
+// they are keep seeking when the wrapped disk seeks, the caller must
+// close it, it returns an error incase there is any
+func (c *CompressStorage) ReadStream(filePath string) (io.ReadCloser, error) {
+	r, _, err := c.open("read", filePath)
+
+	return r, err
+}
+
+// Files returns the files of the given directory with the sizes of their
+// content, the size of a compressed file is kept in its trailer so listing
+// costs a read of the header of every file and of the trailer of every
+// compressed file, the readers of the wrapped disks which don't seek read
+// the files up to their trailer, the files removed meanwhile and the temp
+// files of the writes in progress are left out, any other file whose size
+// can't be read fails the listing with ErrCorrupted
+func (c *CompressStorage) Files(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	listed, err := c.disk.Files(DirectoryPath)
+	if err != nil {
+		return listed, err
+	}
+	files = make([]localstorage.FileInfo, 0, len(listed))
+	for _, file := range listed {
+		info, err := c.plainInfo("files", path.Join(DirectoryPath, file.Name), file)
+		if errors.Is(err, stowage.ErrNotFound) || (errors.Is(err, ErrCorrupted) && isTempName(file.Name)) {
+			continue
+		}
+		if err != nil {
+			return []localstorage.FileInfo{}, err
+		}
+		files = append(files, info)
+	}
+
+	return files, nil
+}
+
+// AllFiles returns the files of the given directory and its sub directories
+// with the sizes of their content, it costs the reads of Files for every
+// directory and fails the same way
+func (c *CompressStorage) AllFiles(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	files = []localstorage.FileInfo{}
+	if err := c.allFiles(cleanDir(DirectoryPath), &files); err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	return files, nil
+}
+
+// Directories returns the sub directories of the given directory
+func (c *CompressStorage) Directories(DirectoryPath string) (SubDirectoryPaths []string, err error) {
+	return c.disk.Directories(DirectoryPath)
+}
+
+// AllDirectories returns the sub directories of the given
+// directory including their sub directories
+func (c *CompressStorage) AllDirectories(SubDirectoryPath string) (directoryPaths []string, err error) {
+	return c.disk.AllDirectories(SubDirectoryPath)
+}
+
+// MakeDirectory creates a new directory and the necessary parent
+// directories, it returns an error incase is any
+func (c *CompressStorage) MakeDirectory(DirectoryPath string, perm int) error {
+	return c.disk.MakeDirectory(DirectoryPath, perm)
+}
+
+// RenameDirectory changes the name of directory to new name,
+// it returns an error incase there is any
+func (c *CompressStorage) RenameDirectory(DirectoryPath string, NewDirectoryPath string) (err error) {
+	return c.disk.RenameDirectory(DirectoryPath, NewDirectoryPath)
+}
+
+// DeleteDirectory deletes the given directory
+func (c *CompressStorage) DeleteDirectory(DirectoryPath string) (err error) {
+	return c.disk.DeleteDirectory(DirectoryPath)
+}
+
+// compressible applies the rules to the file, head
+// is the start of its content used to sniff its type
+func (c *CompressStorage) compressible(filePath string, head []byte) bool {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filePath), "."))
+	if c.exclude[ext] {
+		return false
+	}
+	if c.include[ext] {
+		return true
+	}
+	if len(c.include) > 0 {
+		return false
+	}
+
+	contentType := localstorage.DetectContentType(filePath, nil, head)
+	for _, pattern := range compressibleTypes {
+		if localstorage.MatchContentType(contentType, pattern) {
+			return true
+		}
+	}
+	for _, pattern := range mediaTypes {
+		if localstorage.MatchContentType(contentType, pattern) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// open opens the file decompressing it when it's compressed,
+// it reports whether the file is compressed
+func (c *CompressStorage) open(op string, filePath string) (io.ReadCloser, bool, error) {
+	src, err := c.disk.ReadStream(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	br := bufio.NewReader(src)
+	head, _ := br.Peek(headerSize)
+	id, ok := parseHeader(head)
+	if !ok || id == storedID {
+		return storedContent(src, br, ok), false, nil
+	}
+
+	algo, ok := algorithmOf(id)
+	if !ok {
+		src.Close()
+		return nil, true, c.pathError(op, filePath, ErrCorrupted)
+	}
+	br.Discard(headerSize)
+	trailer := &trailerReader{src: br}
+	dec, err := newDecompressor(trailer, algo)
+	if err != nil {
+		src.Close()
+		return nil, true, c.pathError(op, filePath, err)
+	}
+
+	return &decompressReader{src: src, trailer: trailer, dec: dec}, true, nil
+}
+
+// allFiles appends the files of the directory and of its sub directories
+// in the order of a walk, the entries of every directory sorted by name
+func (c *CompressStorage) allFiles(DirectoryPath string, files *[]localstorage.FileInfo) error {
+	listed, err := c.Files(DirectoryPath)
+	if err != nil {
+		return err
+	}
+	dirs, err := c.disk.Directories(DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		name string
+		file *localstorage.FileInfo
+	}
+	entries := []entry{}
+	for i := range listed {
+		entries = append(entries, entry{name: listed[i].Name, file: &listed[i]})
+	}
+	for _, dir := range dirs {
+		entries = append(entries, entry{name: path.Base(filepath.ToSlash(dir))})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	for _, e := range entries {
+		if e.file != nil {
+			*files = append(*files, *e.file)
+			continue
+		}
+		if err := c.allFiles(path.Join(DirectoryPath, e.name), files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// plainInfo replaces the stored size of a file with the size of its
+// content, the checksums of the wrapped disk are dropped as they're
+// computed over the stored content
+func (c *CompressStorage) plainInfo(op string, filePath string, info localstorage.FileInfo) (localstorage.FileInfo, error) {
+	if info.IsDirectory {
+		return info, nil
+	}
+	size, headed, err := c.contentSize(filePath, info.Size)
+	if err != nil {
+		return localstorage.FileInfo{}, c.pathError(op, filePath, err)
+	}
+	if !headed {
+		return info, nil
+	}
+
+	info.Size = size
+	info.Checksums = nil
+	info.ContentType = localstorage.ContentTypeOrDefault(info.Name)
+	if info.FsFileInfo != nil {
+		info.FsFileInfo = &plainFileInfo{FileInfo: info.FsFileInfo, size: size}
+	}
+
+	return info, nil
+}
+
+// isTempName reports whether the given name is one of the hidden temp
+// files replace.Write and the local disk write before renaming them
+// into place, such as ".name.tmp-1a2b3c4d"
+func isTempName(name string) bool {
+	i := strings.LastIndex(name, ".tmp-")
+	if !strings.HasPrefix(name, ".") || i < 1 || i+len(".tmp-") == len(name) {
+		return false
+	}
+	for _, r := range name[i+len(".tmp-"):] {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contentSize returns the size of the content of a file given its stored
+// size, only the header and the trailer are read when the readers of the
+// wrapped disk seek, it reports whether the file has the header
+func (c *CompressStorage) contentSize(filePath string, size int64) (int64, bool, error) {
+	head, err := c.readAt(filePath, 0, int64(headerSize))
+	if err != nil {
+		return 0, false, err
+	}
+	id, ok := parseHeader(head)
+	if !ok {
+		return size, false, nil
+	}
+	if id == storedID {
+		return size - int64(headerSize), true, nil
+	}
+
+	if size < int64(headerSize+trailerSize) {
+		return 0, true, ErrCorrupted
+	}
+	trailer, err := c.readAt(filePath, size-trailerSize, trailerSize)
+	if err != nil {
+		return 0, true, err
+	}
+	if len(trailer) != trailerSize || int64(binary.BigEndian.Uint64(trailer)) < 0 {
+		return 0, true, ErrCorrupted
+	}
+
+	return int64(binary.BigEndian.Uint64(trailer)), true, nil
+}
+
+// readAt reads up to length bytes of the file starting at offset, the
+// bytes before offset are read and dropped when the readers of the
+// wrapped disk don't seek
+func (c *CompressStorage) readAt(filePath string, offset int64, length int64) ([]byte, error) {
+	r, err := c.disk.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, r, offset)
+	}
+	if err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+	defer r.Close()
+
+	buf := make([]byte, length)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	return buf[:n], err
+}
+
+// pathError wraps the given error into a *stowage.PathError
+func (c *CompressStorage) pathError(op string, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &stowage.PathError{Op: op, Disk: c.Name(), Path: filePath, Err: err}
+}
+
+// storedContent returns the reader of a file stored as it is, the
+// readers of the sources which seek keep seeking, the header is
+// skipped unless the file has none
+func storedContent(src io.ReadCloser, br *bufio.Reader, headed bool) io.ReadCloser {
+	if seeker, ok := src.(io.Seeker); ok {
+		if !headed {
+			if _, err := seeker.Seek(0, io.SeekStart); err == nil {
+				return src
+			}
+		} else if _, err := seeker.Seek(int64(headerSize), io.SeekStart); err == nil {
+			return &storedReader{ReadCloser: src, seeker: seeker}
+		}
+	}
+	if headed {
+		br.Discard(headerSize)
+	}
+
+	return &readCloser{Reader: br, Closer: src}
+}
+
+// readCloser reads from a buffered reader and closes its source
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// plainFileInfo reports the size of the content
+type plainFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i *plainFileInfo) Size() int64 { return i.size }
+
+// Unwrap returns the file info of the wrapped disk
+func (i *plainFileInfo) Unwrap() fs.FileInfo { return i.FileInfo }
+
+// extensionSet returns the set of the extensions without the dot
+func extensionSet(extensions []string) map[string]bool {
+	set := map[string]bool{}
+	for _, ext := range extensions {
+		set[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+
+	return set
+}
+
+// cleanDir returns the directory as a path of the fs.FS of the disk
+func cleanDir(DirectoryPath string) string {
+	dir := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(DirectoryPath)), "/")
+	if dir == "" {
+		return "."
+	}
+
+	return dir
+}
@@ -0,0 +1,318 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package compressstorage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/compressstorage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+// logContent returns compressible content of the given number of lines
+func logContent(lines int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < lines; i++ {
+		b.WriteString("2021-06-01T10:00:00Z INFO request served path=/index.html status=200\n")
+	}
+	return b.Bytes()
+}
+
+// storedHeader is the header of the files stored as they are
+const storedHeader = "\x89STWZ\r\n\x1a\x00"
+
+// asStored returns the content as it's stored when it isn't compressed
+func asStored(content []byte) []byte {
+	return append([]byte(storedHeader), content...)
+}
+
+// pngContent returns content sniffed as a png image
+func pngContent() []byte {
+	return append([]byte("\x89PNG\r\n\x1a\n"), logContent(10)...)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, algo := range []Algorithm{Gzip, Zstd} {
+		inner := memstorage.New()
+		c := Wrap(inner, Opts{Algorithm: algo})
+		content := logContent(1000)
+		if err := c.Create("logs/app.log", content); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := c.Read("logs/app.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("failed asserting the %s content is decompressed", algo)
+		}
+		stored, _ := inner.Read("logs/app.log")
+		if len(stored) >= len(content)/10 {
+			t.Errorf("failed asserting the %s content is compressed, stored %d bytes", algo, len(stored))
+		}
+
+		info, err := c.FileInfo("logs/app.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != int64(len(content)) || info.FsFileInfo.Size() != int64(len(content)) {
+			t.Errorf("failed asserting the size is the size of the content, got %d", info.Size)
+		}
+		files, err := c.AllFiles("logs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || files[0].Size != int64(len(content)) {
+			t.Errorf("failed asserting the listed size is the size of the content")
+		}
+	}
+}
+
+func TestReadsEitherAlgorithm(t *testing.T) {
+	inner := memstorage.New()
+	if err := Wrap(inner, Opts{Algorithm: Zstd}).Create("a.txt", logContent(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Wrap(inner, Opts{Algorithm: Gzip}).Read("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, logContent(10)) {
+		t.Error("failed asserting a zstd file is read by a gzip disk")
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		opts       Opts
+		name       string
+		content    []byte
+		compressed bool
+	}{
+		{Opts{}, "a.log", logContent(100), true},
+		{Opts{}, "a.png", logContent(100), false},
+		{Opts{}, "image", pngContent(), false},
+		{Opts{}, "a.svg", logContent(100), true},
+		{Opts{}, "a.zip", logContent(100), false},
+		{Opts{Exclude: []string{"log"}}, "a.log", logContent(100), false},
+		{Opts{Exclude: []string{".LOG"}}, "a.log", logContent(100), false},
+		{Opts{Include: []string{"log"}}, "a.log", logContent(100), true},
+		{Opts{Include: []string{"log"}}, "a.txt", logContent(100), false},
+		{Opts{Include: []string{"png"}}, "a.png", pngContent(), true},
+		{Opts{Include: []string{"png"}, Exclude: []string{"png"}}, "a.png", pngContent(), false},
+	}
+	for _, test := range tests {
+		inner := memstorage.New()
+		c := Wrap(inner, test.opts)
+		if err := c.Create(test.name, test.content); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := inner.Read(test.name)
+		if compressed := !bytes.Equal(raw, asStored(test.content)); compressed != test.compressed {
+			t.Errorf("failed asserting %s with %+v is compressed: %v", test.name, test.opts, test.compressed)
+		}
+		got, err := c.Read(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, test.content) {
+			t.Errorf("failed asserting %s is read back", test.name)
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	inner := localstorage.New(t.TempDir())
+	c := Wrap(inner, Opts{})
+	if err := c.Create("a.log", logContent(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Append("a.log", logContent(50)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Read("a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, logContent(150)) {
+		t.Error("failed asserting the content is appended to the compressed file")
+	}
+	stored, _ := inner.Read("a.log")
+	if len(stored) >= len(got)/10 {
+		t.Error("failed asserting the appended file stays compressed")
+	}
+
+	if err := c.Create("a.png", pngContent()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Append("a.png", []byte("tail")); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ = inner.Read("a.png")
+	if !bytes.Equal(stored, asStored(append(pngContent(), "tail"...))) {
+		t.Error("failed asserting the content is appended to the raw file")
+	}
+
+	// memstorage has no conflict policies
+	c = Wrap(memstorage.New(), Opts{Algorithm: Zstd})
+	c.Create("a.log", logContent(10))
+	if err := c.Append("a.log", logContent(10)); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = c.Read("a.log")
+	if !bytes.Equal(got, logContent(20)) {
+		t.Error("failed asserting the content is appended on a disk without conflict policies")
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	inner := memstorage.New()
+	c := Wrap(inner, Opts{})
+	c.Create("a.log", logContent(100))
+	stored, _ := inner.Read("a.log")
+
+	// a wrong size in the trailer
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-1]++
+	inner.Delete("a.log")
+	inner.Create("a.log", tampered)
+	if _, err := c.Read("a.log"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("failed asserting a wrong size is reported, got %v", err)
+	}
+
+	// a truncated file
+	inner.Delete("a.log")
+	inner.Create("a.log", stored[:len(stored)-4])
+	if _, err := c.Read("a.log"); err == nil {
+		t.Error("failed asserting a truncated file is reported")
+	}
+}
+
+func TestListingCorrupted(t *testing.T) {
+	inner := memstorage.New()
+	c := Wrap(inner, Opts{})
+	c.Create("logs/a.log", logContent(100))
+	stored, _ := inner.Read("logs/a.log")
+
+	// a temp file of a write in progress is left out
+	inner.Create("logs/.b.log.tmp-0a1b2c3d", stored[:12])
+	files, err := c.Files("logs")
+	if err != nil || len(files) != 1 || files[0].Name != "a.log" {
+		t.Fatalf("failed asserting the temp file is left out, got %v %v", files, err)
+	}
+	if files[0].Size != int64(len(logContent(100))) {
+		t.Errorf("failed asserting the size of the content is listed, got %d", files[0].Size)
+	}
+
+	// any other file fails the listing
+	inner.Create("logs/c.log", stored[:12])
+	if _, err := c.Files("logs"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("failed asserting files reports the corrupted file, got %v", err)
+	}
+	if _, err := c.AllFiles(""); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("failed asserting all files reports the corrupted file, got %v", err)
+	}
+}
+
+func TestReadStream(t *testing.T) {
+	c := Wrap(memstorage.New(), Opts{})
+	c.WriteStream("a.log", strings.NewReader(string(logContent(500))))
+	r, err := c.ReadStream("a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, logContent(500)) {
+		t.Error("failed asserting the stream is decompressed")
+	}
+}
+
+func TestContentLookingCompressed(t *testing.T) {
+	// the content of a png made to look like a gzip file claiming a huge size
+	content := append([]byte("\x89STWZ\r\n\x1a\x01"), pngContent()...)
+	content = append(content, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+
+	for name, c := range map[string]*CompressStorage{
+		"local":  Wrap(localstorage.New(t.TempDir()), Opts{Exclude: []string{"png"}}),
+		"memory": Wrap(memstorage.New(), Opts{Exclude: []string{"png"}}),
+	} {
+		if err := c.Create("a.png", content); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Read("a.png")
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("failed asserting the stored content is read as it is on %s: %v", name, err)
+		}
+		info, err := c.FileInfo("a.png")
+		if err != nil || info.Size != int64(len(content)) {
+			t.Errorf("failed asserting the size of the stored content on %s: %d %v", name, info.Size, err)
+		}
+		files, err := c.Files(".")
+		if err != nil || len(files) != 1 || files[0].Size != int64(len(content)) {
+			t.Errorf("failed asserting the listed size of the stored content on %s: %+v %v", name, files, err)
+		}
+	}
+}
+
+func TestStoredSeek(t *testing.T) {
+	inner := localstorage.New(t.TempDir())
+	c := Wrap(inner, Opts{})
+	c.Create("a.png", pngContent())
+	inner.Create("legacy.txt", []byte("written directly"))
+
+	r, err := c.ReadStream("a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	seeker, ok := r.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("failed asserting the reader of a stored local file seeks")
+	}
+	if pos, err := seeker.Seek(-4, io.SeekEnd); err != nil || pos != int64(len(pngContent()))-4 {
+		t.Fatalf("failed asserting seeking from the end: %d %v", pos, err)
+	}
+	if rest, _ := ioutil.ReadAll(seeker); !bytes.Equal(rest, pngContent()[len(pngContent())-4:]) {
+		t.Error("failed asserting the content from the end")
+	}
+	if _, err := seeker.Seek(-1, io.SeekStart); err == nil {
+		t.Error("failed asserting seeking into the header fails")
+	}
+
+	if got, err := c.Read("legacy.txt"); err != nil || string(got) != "written directly" {
+		t.Errorf("failed asserting a file without the header is read as it is: %v", err)
+	}
+	if info, err := c.FileInfo("legacy.txt"); err != nil || info.Size != 16 {
+		t.Errorf("failed asserting the size of a file without the header: %v", err)
+	}
+}
+
+func TestTransferOntoWrappedFile(t *testing.T) {
+	local := localstorage.New(t.TempDir())
+	c := Wrap(local, Opts{})
+	c.Create("logs/app.log", logContent(10))
+
+	_, err := stowage.Transfer(context.Background(), c, "logs/app.log", local, "logs/app.log", stowage.TransferOpts{Overwrite: true, DeleteSource: true})
+	if !errors.Is(err, stowage.ErrSameFile) {
+		t.Error("failed asserting transfer onto the wrapped file. ", err)
+	}
+	if content, err := c.Read("logs/app.log"); err != nil || !bytes.Equal(content, logContent(10)) {
+		t.Error("failed asserting the file is kept. ", err)
+	}
+}
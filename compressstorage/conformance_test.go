@@ -0,0 +1,33 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package compressstorage_test
+
+import (
+	"testing"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/compressstorage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+	"github.com/harranali/stowage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	for _, algo := range []Algorithm{Gzip, Zstd} {
+		algo := algo
+		t.Run(string(algo), func(t *testing.T) {
+			t.Run("memory", func(t *testing.T) {
+				storagetest.RunConformance(t, func() stowage.Disk {
+					return Wrap(memstorage.New(), Opts{Algorithm: algo})
+				})
+			})
+			t.Run("local", func(t *testing.T) {
+				storagetest.RunConformance(t, func() stowage.Disk {
+					return Wrap(localstorage.New(t.TempDir()), Opts{Algorithm: algo})
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package compressstorage
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithm names a supported compression algorithm
+type Algorithm string
+
+// the supported compression algorithms
+const (
+	Gzip Algorithm = "gzip"
+	Zstd Algorithm = "zstd"
+)
+
+// ErrCorrupted is returned when reading a compressed
+// file whose content doesn't match its trailer
+var ErrCorrupted = errors.New("compressed file is corrupted")
+
+// the format of the files, a header made of a magic and the id of the
+// algorithm is followed by the compressed content and a trailer holding
+// the size of the content, the files stored as they are have the id 0
+// and no trailer, so their content can't be taken for a header
+const (
+	magic       = "\x89STWZ\r\n\x1a"
+	headerSize  = len(magic) + 1
+	trailerSize = 8
+	storedID    = 0
+)
+
+// the algorithms ids stored in the header
+var algorithmIDs = map[Algorithm]byte{Gzip: 1, Zstd: 2}
+
+// header returns the header of a file with the given algorithm id
+func header(id byte) []byte {
+	return append([]byte(magic), id)
+}
+
+// parseHeader returns the algorithm id of the file starting with the
+// given bytes, it reports false for the files without the header
+func parseHeader(head []byte) (byte, bool) {
+	if len(head) < headerSize || string(head[:len(magic)]) != magic {
+		return 0, false
+	}
+
+	return head[len(magic)], true
+}
+
+// algorithmOf returns the algorithm with the given id
+func algorithmOf(id byte) (Algorithm, bool) {
+	for algo, algoID := range algorithmIDs {
+		if algoID == id {
+			return algo, true
+		}
+	}
+
+	return "", false
+}
+
+// newCompressor returns a writer compressing into w
+func newCompressor(w io.Writer, algo Algorithm, level int) (io.WriteCloser, error) {
+	switch algo {
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+
+	return nil, fmt.Errorf("compressstorage: unsupported algorithm %q", algo)
+}
+
+// newDecompressor returns a reader decompressing r
+func newDecompressor(r io.Reader, algo Algorithm) (io.ReadCloser, error) {
+	switch algo {
+	case Gzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		gz.Multistream(false)
+		return gz, nil
+	case Zstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+
+	return nil, ErrCorrupted
+}
+
+// compressReader returns a reader of the compressed form of the content
+// of src, the compression runs in its own goroutine feeding a pipe, the
+// returned function stops it and returns the number of bytes read from src
+func compressReader(src io.Reader, algo Algorithm, level int) (io.Reader, func(err error) int64) {
+	pr, pw := io.Pipe()
+	done := make(chan int64, 1)
+	go func() {
+		n, err := compressTo(pw, src, algo, level)
+		pw.CloseWithError(err)
+		done <- n
+	}()
+
+	return pr, func(err error) int64 {
+		if err == nil {
+			err = io.ErrClosedPipe
+		}
+		// unblock the compression if the reader stopped early
+		pr.CloseWithError(err)
+		return <-done
+	}
+}
+
+// compressTo writes the header, the compressed content and the trailer
+func compressTo(w io.Writer, src io.Reader, algo Algorithm, level int) (int64, error) {
+	if _, err := w.Write(header(algorithmIDs[algo])); err != nil {
+		return 0, err
+	}
+	c, err := newCompressor(w, algo, level)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(c, src)
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	trailer := make([]byte, trailerSize)
+	binary.BigEndian.PutUint64(trailer, uint64(n))
+	_, err = w.Write(trailer)
+
+	return n, err
+}
+
+// trailerReader reads its source but the trailer,
+// which is kept once the source is read
+type trailerReader struct {
+	src     io.Reader
+	pending []byte
+	eof     bool
+}
+
+func (r *trailerReader) Read(p []byte) (int, error) {
+	for len(r.pending) <= trailerSize && !r.eof {
+		buf := make([]byte, 32*1024)
+		n, err := r.src.Read(buf)
+		r.pending = append(r.pending, buf[:n]...)
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	available := len(r.pending) - trailerSize
+	if available <= 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.pending[:available])
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// trailer returns the size stored in the trailer
+func (r *trailerReader) trailer() (int64, error) {
+	if len(r.pending) != trailerSize {
+		return 0, ErrCorrupted
+	}
+
+	return int64(binary.BigEndian.Uint64(r.pending)), nil
+}
+
+// decompressReader decompresses a file and checks its size against
+// the trailer once the content is read
+type decompressReader struct {
+	src      io.Closer
+	trailer  *trailerReader
+	dec      io.ReadCloser
+	n        int64
+	verified bool
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	n, err := r.dec.Read(p)
+	r.n += int64(n)
+	if err == io.EOF && !r.verified {
+		// drain what follows the compressed stream to reach the trailer
+		rest, drainErr := io.Copy(io.Discard, r.trailer)
+		if drainErr != nil {
+			return n, drainErr
+		}
+		size, trailerErr := r.trailer.trailer()
+		if rest != 0 || trailerErr != nil || size != r.n {
+			return n, ErrCorrupted
+		}
+		r.verified = true
+	}
+	if err != nil && err != io.EOF && !errors.Is(err, ErrCorrupted) {
+		err = fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+
+	return n, err
+}
+
+func (r *decompressReader) Close() error {
+	r.dec.Close()
+	return r.src.Close()
+}
+
+// storedReader reads the content of a file stored as it is
+// from its source which seeks, the header is skipped
+type storedReader struct {
+	io.ReadCloser
+	seeker io.Seeker
+}
+
+// Seek sets the position of the next read within the content
+func (r *storedReader) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		offset += int64(headerSize)
+	}
+	pos, err := r.seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	if pos < int64(headerSize) {
+		r.seeker.Seek(int64(headerSize), io.SeekStart)
+		return 0, errors.New("compressstorage: negative position")
+	}
+
+	return pos - int64(headerSize), nil
+}
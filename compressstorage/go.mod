@@ -0,0 +1,8 @@
+module github.com/harranali/stowage/compressstorage
+
+go 1.22
+
+require (
+	github.com/harranali/stowage v0.0.0-20261017175125-3e5d6914d9ab
+	github.com/klauspost/compress v1.18.0
+)
@@ -0,0 +1,28 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package encryptstorage_test
+
+import (
+	"testing"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/encryptstorage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+	"github.com/harranali/stowage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storagetest.RunConformance(t, func() stowage.Disk {
+			return Wrap(memstorage.New(), newKeyring(t, "k1"))
+		})
+	})
+	t.Run("local", func(t *testing.T) {
+		storagetest.RunConformance(t, func() stowage.Disk {
+			return Wrap(localstorage.New(t.TempDir()), newKeyring(t, "k1"))
+		})
+	})
+}
@@ -0,0 +1,482 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package encryptstorage implements stowage.Disk over another disk
+// encrypting the files at rest, the content is sealed with AES-256-GCM
+// in chunks of 64KiB so the files are streamed in both directions and
+// the readers of disks that can seek can seek too, the ID of the key is
+// kept in the header of every file so the keys can be rotated, every file
+// is sealed with its own key derived from the key and a random salt of
+// the header, the chunks are authenticated against the header and the
+// path of their own file, so a file moved or swapped on the wrapped disk
+// fails reading, the files are encrypted again when they're copied, moved
+// or renamed, Opts.UnboundPaths leaves the paths out for the files that
+// must be moved on the wrapped disk directly
+package encryptstorage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/internal/replace"
+	"github.com/harranali/stowage/localstorage"
+)
+
+// make sure the encrypted storage supports all operations
+var _ stowage.Disk = (*EncryptStorage)(nil)
+
+// Opts options of the encrypted storage
+type Opts struct {
+	// UnboundPaths leaves the path out of the authentication of the new
+	// files so they can be renamed, moved and copied on the wrapped disk
+	// directly, the content of two of them swapped on the wrapped disk is
+	// then read without error, by default the path is authenticated
+	UnboundPaths bool
+}
+
+// EncryptStorage encrypts the files of the disk it wraps
+type EncryptStorage struct {
+	disk    stowage.Disk
+	keyring *Keyring
+	opts    Opts
+}
+
+// Wrap returns a disk encrypting the files written to the given disk with
+// the primary key of the keyring and decrypting the files read from it
+// with any key of the keyring, the directories and the paths are kept
+// as they are, only the content of the files is encrypted
+func Wrap(disk stowage.Disk, keyring *Keyring) *EncryptStorage {
+	return WrapWithOpts(disk, keyring, Opts{})
+}
+
+// WrapWithOpts returns a disk like Wrap with the given options
+func WrapWithOpts(disk stowage.Disk, keyring *Keyring, opts Opts) *EncryptStorage {
+	return &EncryptStorage{disk: disk, keyring: keyring, opts: opts}
+}
+
+// Name returns the name of the wrapped disk
+func (e *EncryptStorage) Name() string {
+	if named, ok := e.disk.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	return "encrypted"
+}
+
+// FileInfo returns information about the given file or directory, the
+// size is the size of the decrypted content, it returns an error
+// incase there is any
+func (e *EncryptStorage) FileInfo(filePath string) (fileinfo localstorage.FileInfo, err error) {
+	info, err := e.disk.FileInfo(filePath)
+	if err != nil {
+		return localstorage.FileInfo{}, err
+	}
+
+	return plainInfo(info), nil
+}
+
+// Put encrypts the given file from the local file system into the
+// root folder, it returns error incase there is any
+func (e *EncryptStorage) Put(filePath string) error {
+	return e.PutAs(filePath, filepath.Base(filePath))
+}
+
+// PutAs encrypts the given file from the local file system into the root
+// folder with the given name, it returns error incase there is any
+func (e *EncryptStorage) PutAs(filePath string, filename string) error {
+	st, err := os.Stat(filePath)
+	if err != nil {
+		return e.pathError("put", filePath, err)
+	}
+	if st.IsDir() {
+		return e.pathError("put", filePath, stowage.ErrIsDirectory)
+	}
+	if !st.Mode().IsRegular() {
+		return e.pathError("put", filePath, stowage.ErrNotRegular)
+	}
+
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return e.pathError("put", filePath, err)
+	}
+	defer srcFile.Close()
+
+	_, err = e.WriteStream(filename, srcFile)
+
+	return err
+}
+
+// Copy copies the encrypted file into the destination folder, the
+// files bound to their path are encrypted again for the copy,
+// it returns an error incase there is any
+func (e *EncryptStorage) Copy(filePath string, destfolder string) error {
+	return e.CopyAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// CopyAs copies the encrypted file into the destination folder with the
+// given name, the files bound to their path are encrypted again for the
+// copy, it returns an error incase there is any
+func (e *EncryptStorage) CopyAs(filePath string, destfolder string, newFilePath string) error {
+	bound, err := e.bound(filePath)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return e.disk.CopyAs(filePath, destfolder, newFilePath)
+	}
+
+	return e.rewrite(filePath, path.Join(filepath.ToSlash(destfolder), newFilePath), false)
+}
+
+// Move moves the encrypted file into the destination folder, the files
+// bound to their path are encrypted again at the destination,
+// it returns an error incase there is any
+func (e *EncryptStorage) Move(filePath string, destfolder string) error {
+	return e.MoveAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// MoveAs moves the encrypted file into the destination folder with the
+// given name, the files bound to their path are encrypted again at the
+// destination, it returns an error incase there is any
+func (e *EncryptStorage) MoveAs(filePath string, destFolder string, newFilePath string) error {
+	bound, err := e.bound(filePath)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return e.disk.MoveAs(filePath, destFolder, newFilePath)
+	}
+	if err := e.rewrite(filePath, path.Join(filepath.ToSlash(destFolder), newFilePath), false); err != nil {
+		return err
+	}
+
+	return e.disk.Delete(filePath)
+}
+
+// Rename renames the encrypted file, an existing file with the new name
+// is replaced, the files bound to their path are encrypted again with the
+// new name, it returns error incase there is any
+func (e *EncryptStorage) Rename(filePath string, newFilePath string) error {
+	bound, err := e.bound(filePath)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return e.disk.Rename(filePath, newFilePath)
+	}
+	if cleanPath(filePath) == cleanPath(newFilePath) {
+		return nil
+	}
+	if err := e.rewrite(filePath, newFilePath, true); err != nil {
+		return err
+	}
+
+	return e.disk.Delete(filePath)
+}
+
+// Delete deletes the given file it returns error incase there is any
+func (e *EncryptStorage) Delete(filePath string) error {
+	return e.disk.Delete(filePath)
+}
+
+// DeleteMultiple deletes the given files, it returns error incase there is any
+func (e *EncryptStorage) DeleteMultiple(filePaths []string) error {
+	return e.disk.DeleteMultiple(filePaths)
+}
+
+// Create creates a new file with the encrypted content,
+// it returns error incase there is any
+func (e *EncryptStorage) Create(filePath string, content []byte) error {
+	_, err := e.WriteStream(filePath, bytes.NewReader(content))
+
+	return err
+}
+
+// WriteStream creates a new file and streams into it the content read
+// from the given reader encrypted chunk by chunk, it returns the number of
+// bytes read from the reader and an error incase there is any
+func (e *EncryptStorage) WriteStream(filePath string, r io.Reader) (int64, error) {
+	enc, err := e.encryptReader(filePath, r)
+	if err != nil {
+		return 0, e.pathError("write", filePath, err)
+	}
+	_, err = e.disk.WriteStream(filePath, enc)
+	if err != nil {
+		return 0, err
+	}
+
+	return enc.n, nil
+}
+
+// Append appends content to a file, the file is encrypted again
+// with the content appended to it, it returns error incase there is any
+func (e *EncryptStorage) Append(filePath string, content []byte) error {
+	current, err := e.ReadStream(filePath)
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+
+	return e.overwrite("append", filePath, io.MultiReader(current, bytes.NewReader(content)))
+}
+
+// Exists checks if a file or a directory exists,
+// it returns a bool and an error incase any
+func (e *EncryptStorage) Exists(filePath string) (bool, error) {
+	return e.disk.Exists(filePath)
+}
+
+// Missing checks if a file or a directory is missing,
+// it returns a bool and an error incase any
+func (e *EncryptStorage) Missing(filePath string) (bool, error) {
+	return e.disk.Missing(filePath)
+}
+
+// Read reads and decrypts the given file,
+// it returns an error incase there is any
+func (e *EncryptStorage) Read(filePath string) ([]byte, error) {
+	r, err := e.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, e.pathError("read", filePath, err)
+	}
+
+	return content, nil
+}
+
+// ReadStream returns a reader decrypting the file chunk by chunk, the
+// content of each chunk is returned once it's authenticated, the reader
+// implements io.Seeker when the reader of the wrapped disk does, the
+// caller must close it, it returns an error incase there is any
+func (e *EncryptStorage) ReadStream(filePath string) (io.ReadCloser, error) {
+	src, err := e.disk.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newDecryptReader(src, e.keyring, filePath)
+	if err != nil {
+		src.Close()
+		return nil, e.pathError("read", filePath, err)
+	}
+
+	return r, nil
+}
+
+// Files returns the files of the given directory with the
+// sizes of their decrypted content
+func (e *EncryptStorage) Files(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	files, err = e.disk.Files(DirectoryPath)
+	for i := range files {
+		files[i] = plainInfo(files[i])
+	}
+
+	return files, err
+}
+
+// AllFiles returns the files of the given directory and its sub
+// directories with the sizes of their decrypted content
+func (e *EncryptStorage) AllFiles(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	files, err = e.disk.AllFiles(DirectoryPath)
+	for i := range files {
+		files[i] = plainInfo(files[i])
+	}
+
+	return files, err
+}
+
+// Directories returns the sub directories of the given directory
+func (e *EncryptStorage) Directories(DirectoryPath string) (SubDirectoryPaths []string, err error) {
+	return e.disk.Directories(DirectoryPath)
+}
+
+// AllDirectories returns the sub directories of the given
+// directory including their sub directories
+func (e *EncryptStorage) AllDirectories(SubDirectoryPath string) (directoryPaths []string, err error) {
+	return e.disk.AllDirectories(SubDirectoryPath)
+}
+
+// MakeDirectory creates a new directory and the necessary parent
+// directories, it returns an error incase is any
+func (e *EncryptStorage) MakeDirectory(DirectoryPath string, perm int) error {
+	return e.disk.MakeDirectory(DirectoryPath, perm)
+}
+
+// RenameDirectory changes the name of directory to new name, when some of
+// its files are bound to their path the files are encrypted again into the
+// new directory before the directory is deleted, the new directory is
+// deleted when it fails, it returns an error incase there is any
+func (e *EncryptStorage) RenameDirectory(DirectoryPath string, NewDirectoryPath string) (err error) {
+	// the wrapped disk rejects renaming the root or into itself
+	from, to := cleanPath(DirectoryPath), cleanPath(NewDirectoryPath)
+	if from == "" || strings.HasPrefix(to+"/", from+"/") {
+		return e.disk.RenameDirectory(DirectoryPath, NewDirectoryPath)
+	}
+	fsys, err := fs.Sub(stowage.AsFS(e.disk), from)
+	if err != nil {
+		return err
+	}
+	// the files whose header can't be read are copied as they are
+	files := []string{}
+	dirs := []string{}
+	bound := map[string]bool{}
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		files = append(files, p)
+		if b, err := e.bound(path.Join(from, p)); err == nil && b {
+			bound[p] = true
+		}
+		return nil
+	})
+	if err != nil || len(bound) == 0 {
+		return e.disk.RenameDirectory(DirectoryPath, NewDirectoryPath)
+	}
+
+	if exists, err := e.disk.Exists(NewDirectoryPath); err != nil || exists {
+		if err == nil {
+			err = e.pathError("rename", NewDirectoryPath, stowage.ErrAlreadyExists)
+		}
+		return err
+	}
+	if err := e.disk.MakeDirectory(NewDirectoryPath, 0755); err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := e.disk.MakeDirectory(path.Join(to, dir), 0755); err != nil {
+			e.disk.DeleteDirectory(NewDirectoryPath)
+			return err
+		}
+	}
+	for _, file := range files {
+		src, dst := path.Join(from, file), path.Join(to, file)
+		if bound[file] {
+			err = e.rewrite(src, dst, false)
+		} else {
+			err = e.disk.CopyAs(src, path.Dir(dst), path.Base(dst))
+		}
+		if err != nil {
+			e.disk.DeleteDirectory(NewDirectoryPath)
+			return err
+		}
+	}
+
+	return e.disk.DeleteDirectory(DirectoryPath)
+}
+
+// DeleteDirectory deletes the given directory
+func (e *EncryptStorage) DeleteDirectory(DirectoryPath string) (err error) {
+	return e.disk.DeleteDirectory(DirectoryPath)
+}
+
+// encryptReader returns a reader encrypting the content of the
+// given reader into the given file with the primary key
+func (e *EncryptStorage) encryptReader(filePath string, r io.Reader) (*encryptReader, error) {
+	var flags byte
+	if !e.opts.UnboundPaths {
+		flags |= boundPath
+	}
+	h, err := newHeader(e.keyring.primary, flags)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.keyring.aead(h.keyID, h.salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncryptReader(r, aead, h, filePath), nil
+}
+
+// overwrite replaces the file with the encrypted content of the reader,
+// the file is left as it was when the write fails
+func (e *EncryptStorage) overwrite(op string, filePath string, r io.Reader) error {
+	enc, err := e.encryptReader(filePath, r)
+	if err != nil {
+		return e.pathError(op, filePath, err)
+	}
+	_, err = replace.Write(e.disk, filePath, enc)
+
+	return err
+}
+
+// bound reports whether the given file is authenticated with its path
+func (e *EncryptStorage) bound(filePath string) (bool, error) {
+	h, err := e.header("read", filePath)
+	if err != nil {
+		return false, err
+	}
+
+	return h.flags&boundPath != 0, nil
+}
+
+// rewrite decrypts the file and encrypts it again into the new path, an
+// existing file with the new path is replaced when replace is set,
+// otherwise the write fails
+func (e *EncryptStorage) rewrite(filePath string, newFilePath string, replace bool) error {
+	current, err := e.ReadStream(filePath)
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+	if replace {
+		return e.overwrite("rename", newFilePath, current)
+	}
+	_, err = e.WriteStream(newFilePath, current)
+
+	return err
+}
+
+// pathError wraps the given error into a *stowage.PathError
+func (e *EncryptStorage) pathError(op string, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &stowage.PathError{Op: op, Disk: e.Name(), Path: filePath, Err: err}
+}
+
+// plainInfo replaces the size of the encrypted file with the size
+// of its content, the checksums of the wrapped disk are dropped as
+// they're computed over the encrypted content
+func plainInfo(info localstorage.FileInfo) localstorage.FileInfo {
+	if info.IsDirectory {
+		return info
+	}
+	info.Size = plainSize(info.Size)
+	info.Checksums = nil
+	info.ContentType = localstorage.ContentTypeOrDefault(info.Name)
+	if info.FsFileInfo != nil {
+		info.FsFileInfo = &plainFileInfo{FileInfo: info.FsFileInfo, size: info.Size}
+	}
+
+	return info
+}
+
+// plainFileInfo reports the size of the decrypted content
+type plainFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i *plainFileInfo) Size() int64 { return i.size }
+
+// Unwrap returns the file info of the wrapped disk
+func (i *plainFileInfo) Unwrap() fs.FileInfo { return i.FileInfo }
@@ -0,0 +1,309 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package encryptstorage_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/encryptstorage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+const chunkSize = 64 * 1024
+
+// key returns a key whose secret is derived from its id
+func key(id string) Key {
+	secret := sha256.Sum256([]byte(id))
+	return Key{ID: id, Secret: secret[:]}
+}
+
+// newKeyring returns a keyring of the keys with the given ids
+func newKeyring(t *testing.T, ids ...string) *Keyring {
+	keys := []Key{}
+	for _, id := range ids {
+		keys = append(keys, key(id))
+	}
+	keyring, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+// randomContent returns reproducible content of the given size
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	return content
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := [][]Key{
+		{},
+		{{ID: "", Secret: make([]byte, 32)}},
+		{{ID: "k1", Secret: make([]byte, 16)}},
+		{{ID: string(make([]byte, 33)), Secret: make([]byte, 32)}},
+		{key("k1"), key("k1")},
+	}
+	for _, keys := range tests {
+		if _, err := NewKeyring(keys...); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("failed asserting invalid keys %v: %v", keys, err)
+		}
+	}
+	if keyring := newKeyring(t, "k2", "k1"); keyring.Primary() != "k2" {
+		t.Error("failed asserting the primary key. ", keyring.Primary())
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// the first block of the test case 1 of RFC 5869
+	secret := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	if got := hex.EncodeToString(DeriveKey(secret, salt, info)); got != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf" {
+		t.Error("failed asserting the derived key. ", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	inner := memstorage.New()
+	e := Wrap(inner, newKeyring(t, "k1"))
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		content := randomContent(size)
+		n, err := e.WriteStream("file.bin", bytes.NewReader(content))
+		if err != nil || n != int64(size) {
+			t.Fatalf("failed asserting writing %d bytes: %d %v", size, n, err)
+		}
+
+		got, err := e.Read("file.bin")
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("failed asserting reading %d bytes: %d %v", size, len(got), err)
+		}
+		info, err := e.FileInfo("file.bin")
+		if err != nil || info.Size != int64(size) || info.FsFileInfo.Size() != int64(size) {
+			t.Errorf("failed asserting the size of %d bytes: %d %v", size, info.Size, err)
+		}
+		raw, _ := inner.Read("file.bin")
+		if size > 16 && bytes.Contains(raw, content[:16]) {
+			t.Errorf("failed asserting the %d bytes are encrypted", size)
+		}
+		e.Delete("file.bin")
+	}
+
+	e.Create("docs/a.txt", []byte("secret"))
+	e.Append("docs/a.txt", []byte(" appended"))
+	if content, _ := e.Read("docs/a.txt"); string(content) != "secret appended" {
+		t.Errorf("failed asserting append: %s", content)
+	}
+	files, _ := e.AllFiles(".")
+	if len(files) != 1 || files[0].Size != 15 || files[0].ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("failed asserting the listed files: %+v", files)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	e := Wrap(localstorage.New(t.TempDir()), newKeyring(t, "k1"))
+	content := randomContent(3*chunkSize + 100)
+	e.Create("file.bin", content)
+
+	r, err := e.ReadStream("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	seeker, ok := r.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("failed asserting the reader of a local file seeks")
+	}
+
+	for _, offset := range []int64{0, 10, chunkSize - 1, chunkSize, 2*chunkSize + 7, int64(len(content)) - 1} {
+		if pos, err := seeker.Seek(offset, io.SeekStart); err != nil || pos != offset {
+			t.Fatalf("failed asserting seeking to %d: %d %v", offset, pos, err)
+		}
+		got := make([]byte, 200)
+		n, _ := io.ReadFull(seeker, got)
+		end := offset + 200
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		if !bytes.Equal(got[:n], content[offset:end]) {
+			t.Errorf("failed asserting the content at %d", offset)
+		}
+	}
+
+	if pos, err := seeker.Seek(-50, io.SeekEnd); err != nil || pos != int64(len(content))-50 {
+		t.Fatalf("failed asserting seeking from the end: %d %v", pos, err)
+	}
+	if rest, _ := ioutil.ReadAll(seeker); !bytes.Equal(rest, content[len(content)-50:]) {
+		t.Error("failed asserting the content from the end")
+	}
+	if _, err := seeker.Seek(10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := seeker.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("failed asserting reading past the end: %d %v", n, err)
+	}
+	if _, err := seeker.Seek(0, 3); err == nil {
+		t.Error("failed asserting an invalid whence is rejected")
+	}
+
+	if r, _ := Wrap(memstorage.New(), newKeyring(t, "k1")).ReadStream("missing"); r != nil {
+		t.Error("failed asserting a missing file has no reader")
+	}
+}
+
+func TestTampering(t *testing.T) {
+	inner := memstorage.New()
+	e := Wrap(inner, newKeyring(t, "k1"))
+	content := randomContent(2*chunkSize + 10)
+	e.Create("file.bin", content)
+	raw, _ := inner.Read("file.bin")
+
+	tamper := map[string][]byte{
+		"flipped byte":       append(append([]byte{}, raw[:100]...), append([]byte{raw[100] ^ 1}, raw[101:]...)...),
+		"truncated chunk":    raw[:len(raw)-5],
+		"dropped last chunk": raw[:len(raw)-26],
+		"appended data":      append(append([]byte{}, raw...), 1, 2, 3),
+	}
+	for name, tampered := range tamper {
+		inner.Delete("file.bin")
+		inner.Create("file.bin", tampered)
+		if _, err := e.Read("file.bin"); !errors.Is(err, ErrTampered) {
+			t.Errorf("failed asserting the %s is detected: %v", name, err)
+		}
+	}
+
+	inner.Create("plain.txt", []byte("not encrypted at all, just plain text here"))
+	if _, err := e.Read("plain.txt"); !errors.Is(err, ErrMalformed) {
+		t.Error("failed asserting a plain file is malformed. ", err)
+	}
+	var pathErr *stowage.PathError
+	if _, err := e.Read("plain.txt"); !errors.As(err, &pathErr) || pathErr.Path != "plain.txt" {
+		t.Error("failed asserting the path error. ", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	inner := memstorage.New()
+	old := Wrap(inner, newKeyring(t, "old"))
+	old.Create("a.txt", []byte("a"))
+	old.Create("docs/b.txt", []byte("b"))
+
+	rotated := Wrap(inner, newKeyring(t, "new", "old"))
+	rotated.Create("docs/c.txt", []byte("c"))
+	if content, err := rotated.Read("a.txt"); err != nil || string(content) != "a" {
+		t.Errorf("failed asserting reading with an old key: %s %v", content, err)
+	}
+	if id, _ := rotated.KeyID("docs/c.txt"); id != "new" {
+		t.Error("failed asserting new files use the primary key. ", id)
+	}
+
+	result, err := rotated.ReEncrypt(".")
+	if err != nil || len(result.ReEncrypted) != 2 || result.Skipped != 1 {
+		t.Fatalf("failed asserting the re-encryption: %+v %v", result, err)
+	}
+	for _, file := range []string{"a.txt", "docs/b.txt"} {
+		if id, _ := rotated.KeyID(file); id != "new" {
+			t.Errorf("failed asserting %s is re-encrypted: %s", file, id)
+		}
+	}
+
+	current := Wrap(inner, newKeyring(t, "new"))
+	if content, err := current.Read("docs/b.txt"); err != nil || string(content) != "b" {
+		t.Errorf("failed asserting reading without the old key: %s %v", content, err)
+	}
+	if _, err := old.Read("a.txt"); !errors.Is(err, ErrUnknownKey) {
+		t.Error("failed asserting a missing key. ", err)
+	}
+}
+
+func TestPathBinding(t *testing.T) {
+	inner := memstorage.New()
+	e := Wrap(inner, newKeyring(t, "k1"))
+	e.Create("a.txt", []byte("a"))
+	e.Create("b.txt", []byte("b"))
+	e.Create("same1.txt", []byte("same"))
+	e.Create("same2.txt", []byte("same"))
+	same1, _ := inner.Read("same1.txt")
+	// the sealed content before the tag differs with the keys only
+	if same2, _ := inner.Read("same2.txt"); bytes.Equal(same1[len(same1)-20:len(same1)-16], same2[len(same2)-20:len(same2)-16]) {
+		t.Error("failed asserting every file has its own key")
+	}
+
+	// swapped on the wrapped disk
+	inner.Rename("a.txt", "tmp.txt")
+	inner.Rename("b.txt", "a.txt")
+	inner.Rename("tmp.txt", "b.txt")
+	if _, err := e.Read("a.txt"); !errors.Is(err, ErrTampered) {
+		t.Error("failed asserting a swapped file fails reading. ", err)
+	}
+	inner.Rename("a.txt", "c.txt")
+	if _, err := e.Read("c.txt"); !errors.Is(err, ErrTampered) {
+		t.Error("failed asserting a file moved on the wrapped disk fails reading. ", err)
+	}
+
+	e.Create("docs/a.txt", []byte("a"))
+	e.Create("docs/sub/b.txt", []byte("b"))
+	steps := []struct {
+		name string
+		run  func() error
+		file string
+	}{
+		{"rename", func() error { return e.Rename("docs/a.txt", "docs/renamed.txt") }, "docs/renamed.txt"},
+		{"copy", func() error { return e.CopyAs("docs/renamed.txt", "copies", "a.txt") }, "copies/a.txt"},
+		{"move", func() error { return e.Move("copies/a.txt", "moved") }, "moved/a.txt"},
+		{"rename directory", func() error { return e.RenameDirectory("docs", "documents") }, "documents/sub/b.txt"},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("failed asserting %s: %v", step.name, err)
+		}
+		if _, err := e.Read(step.file); err != nil {
+			t.Errorf("failed asserting reading after %s: %v", step.name, err)
+		}
+	}
+	for _, file := range []string{"docs/a.txt", "copies/a.txt", "docs"} {
+		if ok, _ := e.Exists(file); ok {
+			t.Errorf("failed asserting %s is gone", file)
+		}
+	}
+	if ok, _ := e.Exists("documents/renamed.txt"); !ok {
+		t.Error("failed asserting the renamed directory keeps its files")
+	}
+}
+
+func TestUnboundPaths(t *testing.T) {
+	inner := memstorage.New()
+	e := WrapWithOpts(inner, newKeyring(t, "k1"), Opts{UnboundPaths: true})
+	e.Create("a.txt", []byte("a"))
+	e.Create("b.txt", []byte("b"))
+
+	inner.Rename("a.txt", "tmp.txt")
+	inner.Rename("b.txt", "a.txt")
+	inner.Rename("tmp.txt", "b.txt")
+	if content, err := e.Read("a.txt"); err != nil || string(content) != "b" {
+		t.Errorf("failed asserting an unbound file is read after moving it: %s %v", content, err)
+	}
+
+	// the files bound by default keep their binding
+	Wrap(inner, newKeyring(t, "k1")).Create("bound.txt", []byte("bound"))
+	if err := e.Rename("bound.txt", "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := e.Read("renamed.txt"); err != nil || string(content) != "bound" {
+		t.Errorf("failed asserting a bound file is encrypted again: %s %v", content, err)
+	}
+}
@@ -0,0 +1,8 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package encryptstorage
+
+// DeriveKey exposes the derivation of the keys of the files to the tests
+var DeriveKey = deriveKey
@@ -0,0 +1,388 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package encryptstorage
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// the format of the encrypted files, a header is followed by the chunks
+// of the content sealed with AES-256-GCM, the header holds the ID of the
+// key, the flags and a random salt, every file is sealed with its own key
+// derived from the key of the keyring and the salt, so the nonce of each
+// chunk is only the index of the chunk and a flag marking the last chunk,
+// reordered, removed or truncated chunks fail authentication, the header
+// and the path of the file unless the flags leave it out are authenticated
+// with every chunk
+const (
+	magic         = "STWE"
+	formatVersion = 2
+	saltSize      = 32
+	headerSize    = len(magic) + 1 + 1 + maxKeyIDLength + 1 + saltSize
+	nonceSize     = 12
+	chunkSize     = 64 * 1024
+	tagSize       = 16
+	sealedSize    = chunkSize + tagSize
+)
+
+// the flags of the header
+const (
+	// boundPath marks the files whose path is authenticated
+	boundPath byte = 1 << iota
+)
+
+// header is the header of an encrypted file
+type header struct {
+	keyID string
+	flags byte
+	salt  [saltSize]byte
+}
+
+// newHeader returns the header of a new file encrypted with the given key
+func newHeader(keyID string, flags byte) (header, error) {
+	h := header{keyID: keyID, flags: flags}
+	_, err := rand.Read(h.salt[:])
+
+	return h, err
+}
+
+// marshal returns the bytes of the header, the key ID is padded
+// so the header has a fixed size
+func (h header) marshal() []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, magic...)
+	b = append(b, formatVersion, byte(len(h.keyID)))
+	b = append(b, h.keyID...)
+	b = append(b, make([]byte, maxKeyIDLength-len(h.keyID))...)
+	b = append(b, h.flags)
+	b = append(b, h.salt[:]...)
+
+	return b
+}
+
+// parseHeader parses the header of an encrypted file
+func parseHeader(b []byte) (header, error) {
+	if len(b) != headerSize || !strings.HasPrefix(string(b), magic) || b[len(magic)] != formatVersion {
+		return header{}, ErrMalformed
+	}
+	idLength := int(b[len(magic)+1])
+	if idLength == 0 || idLength > maxKeyIDLength {
+		return header{}, ErrMalformed
+	}
+	offset := len(magic) + 2
+	h := header{keyID: string(b[offset : offset+idLength]), flags: b[offset+maxKeyIDLength]}
+	if h.flags&^boundPath != 0 {
+		return header{}, ErrMalformed
+	}
+	copy(h.salt[:], b[offset+maxKeyIDLength+1:])
+
+	return h, nil
+}
+
+// aad returns the data authenticated with every chunk of the file, the
+// marshaled header followed by the path when the header binds it
+func (h header) aad(marshaled []byte, filePath string) []byte {
+	aad := append([]byte{}, marshaled...)
+	if h.flags&boundPath != 0 {
+		aad = append(aad, cleanPath(filePath)...)
+	}
+
+	return aad
+}
+
+// nonce returns the nonce of the chunk with the given index, the key of
+// the file is used only for the file so the nonces only count the chunks
+func nonce(index uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint32(nonce[nonceSize-5:], index)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+
+	return nonce
+}
+
+// cleanPath cleans the path of a file so the same
+// file is authenticated with the same path
+func cleanPath(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filePath)), "/")
+}
+
+// plainSize returns the size of the content of an encrypted file of the
+// given size, all chunks are full but the last one, an empty content is
+// sealed as an empty chunk
+func plainSize(size int64) int64 {
+	body := size - int64(headerSize)
+	if body <= 0 {
+		return 0
+	}
+	chunks := (body + sealedSize - 1) / sealedSize
+	if plain := body - chunks*tagSize; plain > 0 {
+		return plain
+	}
+
+	return 0
+}
+
+// readChunk reads a chunk of at most the size of the buffer,
+// it reports whether the end of the reader was reached
+func readChunk(r io.Reader, buf []byte) ([]byte, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:n], true, nil
+	}
+
+	return buf[:n], false, err
+}
+
+// encryptReader reads the encrypted form of the content of its source,
+// a chunk is read ahead to know which chunk is the last one
+type encryptReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	header  header
+	aad     []byte
+	index   uint32
+	current []byte
+	eof     bool
+	started bool
+	done    bool
+	out     []byte
+	bufs    [2][]byte
+	// n is the number of bytes read from the source
+	n int64
+}
+
+// newEncryptReader returns a reader encrypting the content of the
+// source into the given file with the key of the file
+func newEncryptReader(src io.Reader, aead cipher.AEAD, h header, filePath string) *encryptReader {
+	marshaled := h.marshal()
+	return &encryptReader{
+		src:    src,
+		aead:   aead,
+		header: h,
+		aad:    h.aad(marshaled, filePath),
+		out:    append(make([]byte, 0, sealedSize), marshaled...),
+		bufs:   [2][]byte{make([]byte, chunkSize), make([]byte, chunkSize)},
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+
+	return n, nil
+}
+
+// seal encrypts the next chunk
+func (r *encryptReader) seal() error {
+	var err error
+	if !r.started {
+		r.current, r.eof, err = readChunk(r.src, r.bufs[0])
+		if err != nil {
+			return err
+		}
+		r.started = true
+	}
+
+	last := r.eof
+	var next []byte
+	if !last {
+		next, r.eof, err = readChunk(r.src, r.bufs[(r.index+1)%2])
+		if err != nil {
+			return err
+		}
+		last = len(next) == 0 && r.eof
+	}
+	if !last && r.index == math.MaxUint32 {
+		return errors.New("encryptstorage: the content is too large")
+	}
+
+	r.out = r.aead.Seal(r.out[:0], nonce(r.index, last), r.current, r.aad)
+	r.n += int64(len(r.current))
+	r.index++
+	r.current = next
+	r.done = last
+
+	return nil
+}
+
+// decryptReader reads the content of an encrypted file, every chunk is
+// authenticated before any of its content is returned
+type decryptReader struct {
+	src    io.ReadCloser
+	br     *bufio.Reader
+	aead   cipher.AEAD
+	header header
+	aad    []byte
+	index  uint32
+	done   bool
+	plain  []byte
+	buf    []byte
+	// pos is the position in the content used by the seekable reader
+	pos int64
+}
+
+// seekableReader is a decryptReader over a source that can seek,
+// it seeks by decrypting only the chunk holding the new position
+type seekableReader struct {
+	*decryptReader
+	seeker io.Seeker
+	size   int64
+}
+
+// newDecryptReader reads the header of the given encrypted file and
+// returns a reader of its content, it implements io.Seeker when the
+// source does
+func newDecryptReader(src io.ReadCloser, keyring *Keyring, filePath string) (io.ReadCloser, error) {
+	marshaled := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, marshaled); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrMalformed
+		}
+		return nil, err
+	}
+	h, err := parseHeader(marshaled)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := keyring.aead(h.keyID, h.salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	r := &decryptReader{
+		src:    src,
+		br:     bufio.NewReaderSize(src, sealedSize),
+		aead:   aead,
+		header: h,
+		aad:    h.aad(marshaled, filePath),
+		buf:    make([]byte, sealedSize),
+	}
+	if seeker, ok := src.(io.Seeker); ok {
+		return &seekableReader{decryptReader: r, seeker: seeker, size: -1}, nil
+	}
+
+	return r, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	r.pos += int64(n)
+
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
+
+// open reads and decrypts the next chunk
+func (r *decryptReader) open() error {
+	sealed, eof, err := readChunk(r.br, r.buf)
+	if err != nil {
+		return err
+	}
+	if !eof {
+		// a chunk followed by nothing is the last one
+		if _, err := r.br.Peek(1); err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(sealed) < tagSize {
+		// the last chunk is missing
+		return ErrTampered
+	}
+
+	r.plain, err = r.aead.Open(sealed[:0], nonce(r.index, eof), sealed, r.aad)
+	if err != nil {
+		return ErrTampered
+	}
+	r.index++
+	r.done = eof
+
+	return nil
+}
+
+// Seek sets the position of the next read, io.SeekEnd uses the
+// size of the content computed from the size of the source
+func (r *seekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		if r.size < 0 {
+			size, err := r.seeker.Seek(0, io.SeekEnd)
+			if err != nil {
+				return 0, err
+			}
+			r.size = plainSize(size)
+		}
+		offset += r.size
+	default:
+		return 0, errors.New("encryptstorage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("encryptstorage: negative position")
+	}
+
+	index := offset / chunkSize
+	if index > math.MaxUint32 {
+		return 0, errors.New("encryptstorage: position out of range")
+	}
+	if _, err := r.seeker.Seek(int64(headerSize)+index*sealedSize, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r.br.Reset(r.src)
+	r.index = uint32(index)
+	r.plain = nil
+	r.done = false
+	r.pos = offset
+
+	within := int(offset % chunkSize)
+	if _, err := r.br.Peek(1); err == io.EOF {
+		// past the end, the reads return io.EOF
+		r.done = true
+		return offset, nil
+	}
+	if err := r.open(); err != nil {
+		return 0, err
+	}
+	if within > len(r.plain) {
+		within = len(r.plain)
+	}
+	r.plain = r.plain[within:]
+
+	return offset, nil
+}
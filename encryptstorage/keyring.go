@@ -0,0 +1,101 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package encryptstorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// errors returned by the encrypted storage wrapped in a *stowage.PathError
+// when they concern a file, use errors.Is to match them
+var (
+	ErrInvalidKey = errors.New("invalid encryption key")
+	ErrUnknownKey = errors.New("file is encrypted with a key missing from the keyring")
+	ErrMalformed  = errors.New("file is not encrypted or its header is malformed")
+	ErrTampered   = errors.New("file content failed authentication")
+)
+
+// maxKeyIDLength is the longest key ID, the IDs
+// are stored in the header of every file
+const maxKeyIDLength = 32
+
+// fileKeyInfo is the HKDF info of the keys of the files
+const fileKeyInfo = "stowage encryptstorage file key"
+
+// Key is an AES-256 key, the ID is stored in the
+// header of the files so keys can be rotated
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring holds the keys of an encrypted storage, the first key
+// encrypts the new files while all of them decrypt the files
+type Keyring struct {
+	primary string
+	secrets map[string][]byte
+}
+
+// NewKeyring returns a keyring with the given keys, the first key is the
+// primary key, the secrets must be 32 bytes long and the IDs unique and
+// at most 32 bytes long, it returns an error incase a key is invalid
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys are given", ErrInvalidKey)
+	}
+
+	k := &Keyring{primary: keys[0].ID, secrets: map[string][]byte{}}
+	for _, key := range keys {
+		if key.ID == "" || len(key.ID) > maxKeyIDLength {
+			return nil, fmt.Errorf("%w: the id %q must be 1 to %d bytes long", ErrInvalidKey, key.ID, maxKeyIDLength)
+		}
+		if len(key.Secret) != 32 {
+			return nil, fmt.Errorf("%w: the secret of %q must be 32 bytes long", ErrInvalidKey, key.ID)
+		}
+		if _, ok := k.secrets[key.ID]; ok {
+			return nil, fmt.Errorf("%w: the id %q is repeated", ErrInvalidKey, key.ID)
+		}
+		k.secrets[key.ID] = append([]byte{}, key.Secret...)
+	}
+
+	return k, nil
+}
+
+// Primary returns the ID of the key encrypting the new files
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// aead returns the cipher of the file whose key is derived
+// from the given key of the keyring and the salt of the file
+func (k *Keyring) aead(id string, salt []byte) (cipher.AEAD, error) {
+	secret, ok := k.secrets[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	block, err := aes.NewCipher(deriveKey(secret, salt, []byte(fileKeyInfo)))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives a 32 bytes key from the secret and the salt with
+// HKDF-SHA256, a single block of the expansion is the whole key
+func deriveKey(secret []byte, salt []byte, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+
+	return expand.Sum(nil)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package encryptstorage
+
+import (
+	"io"
+	"io/fs"
+	"path"
+
+	"github.com/harranali/stowage"
+)
+
+// ReEncryptResult reports the files visited by ReEncrypt
+type ReEncryptResult struct {
+	// ReEncrypted are the paths of the files encrypted again
+	// with the primary key
+	ReEncrypted []string
+	// Skipped is the number of files already encrypted
+	// with the primary key
+	Skipped int
+}
+
+// KeyID returns the ID of the key the given file is encrypted with,
+// it returns an error incase there is any
+func (e *EncryptStorage) KeyID(filePath string) (string, error) {
+	h, err := e.header("keyid", filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return h.keyID, nil
+}
+
+// header reads the header of the given file
+func (e *EncryptStorage) header(op string, filePath string) (header, error) {
+	r, err := e.disk.ReadStream(filePath)
+	if err != nil {
+		return header{}, err
+	}
+	defer r.Close()
+
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrMalformed
+		}
+		return header{}, e.pathError(op, filePath, err)
+	}
+	h, err := parseHeader(b)
+	if err != nil {
+		return header{}, e.pathError(op, filePath, err)
+	}
+
+	return h, nil
+}
+
+// ReEncryptFile encrypts the given file again with the primary key
+// unless it's already encrypted with it, the old key must still be in
+// the keyring, it reports whether the file was encrypted again and
+// returns an error incase there is any
+func (e *EncryptStorage) ReEncryptFile(filePath string) (bool, error) {
+	keyID, err := e.KeyID(filePath)
+	if err != nil || keyID == e.keyring.primary {
+		return false, err
+	}
+
+	current, err := e.ReadStream(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer current.Close()
+	if err := e.overwrite("reencrypt", filePath, current); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReEncrypt encrypts again with the primary key the files of the given
+// directory and its sub directories that are encrypted with the other
+// keys, once it's done the other keys can be removed from the keyring,
+// it stops at the first failing file and returns the files encrypted
+// so far and an error incase there is any
+func (e *EncryptStorage) ReEncrypt(DirectoryPath string) (ReEncryptResult, error) {
+	result := ReEncryptResult{ReEncrypted: []string{}}
+	root := path.Clean("/" + DirectoryPath)[1:]
+	if root == "" {
+		root = "."
+	}
+
+	err := fs.WalkDir(stowage.AsFS(e.disk), root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		reEncrypted, err := e.ReEncryptFile(p)
+		if err != nil {
+			return err
+		}
+		if reEncrypted {
+			result.ReEncrypted = append(result.ReEncrypted, p)
+		} else {
+			result.Skipped++
+		}
+		return nil
+	})
+
+	return result, err
+}
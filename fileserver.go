@@ -0,0 +1,267 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/harranali/stowage/localstorage"
+)
+
+// FileServerOpts options for serving the files of a disk
+type FileServerOpts struct {
+	// Root is the directory of the disk that is served,
+	// it defaults to the root of the disk
+	Root string
+	// Listing lists the directories, otherwise they are not found
+	Listing bool
+	// Attachment asks the browsers to download the files
+	// instead of displaying them
+	Attachment bool
+	// HideDotFiles hides the files and directories whose
+	// names start with a dot, they are not found nor listed
+	HideDotFiles bool
+	// Allow is called with the path of every served or listed entry
+	// within Root, the entries it rejects are not found nor listed
+	Allow func(filePath string) bool
+	// ETag returns the entity tag of the file, it defaults
+	// to a tag made of the modification time and the size
+	ETag func(info localstorage.FileInfo) string
+}
+
+// FileServer returns a handler serving the files of the disk by the
+// request path, it answers range requests unless the streams of the disk
+// can't seek and it doesn't implement RangeDisk, and conditional requests with
+// If-None-Match and If-Modified-Since, and sets the Content-Type and the
+// Content-Disposition of the files, only GET and HEAD are allowed,
+// use http.StripPrefix to serve the disk under a prefix
+func FileServer(disk Disk, opts FileServerOpts) http.Handler {
+	if opts.ETag == nil {
+		opts.ETag = defaultETag
+	}
+
+	return &fileServer{disk: disk, fsys: AsFS(disk), root: cleanPath(opts.Root), opts: opts}
+}
+
+// fileServer serves the files of a disk
+type fileServer struct {
+	disk Disk
+	fsys fs.FS
+	root string
+	opts FileServerOpts
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := cleanPath(r.URL.Path)
+	if !s.allowed(name) {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := s.disk.FileInfo(s.diskPath(name))
+	if err != nil {
+		serveError(w, r, err)
+		return
+	}
+
+	if info.IsDirectory {
+		s.serveDirectory(w, r, name)
+		return
+	}
+	s.serveFile(w, r, name, info)
+}
+
+// serveFile serves the content of the file
+func (s *fileServer) serveFile(w http.ResponseWriter, r *http.Request, name string, info localstorage.FileInfo) {
+	f, err := s.fsys.Open(s.fsName(name))
+	if err != nil {
+		serveError(w, r, err)
+		return
+	}
+	defer f.Close()
+	seeker, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = localstorage.ContentTypeByExtension(info.Name, nil)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "inline"
+	if s.opts.Attachment {
+		disposition = "attachment"
+	}
+	// the disposition bound to a signed url takes precedence
+	if bound, ok := r.Context().Value(dispositionKey{}).(string); ok {
+		disposition = bound
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": info.Name}))
+	if etag := s.opts.ETag(info); etag != "" {
+		header.Set("ETag", etag)
+	}
+
+	// the files that can't seek on a disk without ranged reads are served
+	// whole, the ranged reads of the others stop where the ranges end
+	if opened, ok := f.(*file); ok && !opened.seekable {
+		if _, ok := s.disk.(RangeDisk); !ok {
+			r = r.Clone(r.Context())
+			r.Header.Del("Range")
+			w = &noRangesWriter{ResponseWriter: w}
+		} else {
+			opened.end = rangesEnd(r.Header.Get("Range"), info.Size)
+		}
+	}
+
+	http.ServeContent(w, r, info.Name, info.LastModified, seeker)
+}
+
+// rangesEnd returns the offset where the requested ranges end, it's the
+// size of the file when there are no ranges or they can't be parsed,
+// http.ServeContent validates them
+func rangesEnd(header string, size int64) int64 {
+	if !strings.HasPrefix(header, "bytes=") {
+		return size
+	}
+	end := int64(0)
+	for _, spec := range strings.Split(header[len("bytes="):], ",") {
+		bounds := strings.Split(strings.TrimSpace(spec), "-")
+		if len(bounds) != 2 || bounds[0] == "" || bounds[1] == "" {
+			return size
+		}
+		last, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || last+1 >= size {
+			return size
+		}
+		if last+1 > end {
+			end = last + 1
+		}
+	}
+
+	return end
+}
+
+// serveDirectory lists the directory when the listing is enabled
+func (s *fileServer) serveDirectory(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.opts.Listing {
+		http.NotFound(w, r)
+		return
+	}
+	// the links of the listing are relative to the directory
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		target := path.Base(r.URL.Path) + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		// a relative location keeps working under http.StripPrefix
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	entries, err := fs.ReadDir(s.fsys, s.fsName(name))
+	if err != nil {
+		serveError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintf(w, "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		if !s.allowed(path.Join(name, entry.Name())) {
+			continue
+		}
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(entryName))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// allowed applies the path checks to the path within the root
+func (s *fileServer) allowed(name string) bool {
+	if s.opts.HideDotFiles {
+		for _, segment := range strings.Split(name, "/") {
+			if strings.HasPrefix(segment, ".") {
+				return false
+			}
+		}
+	}
+	if s.opts.Allow != nil && !s.opts.Allow(name) {
+		return false
+	}
+
+	return true
+}
+
+// diskPath returns the path of the entry on the disk
+func (s *fileServer) diskPath(name string) string {
+	return path.Join(s.root, name)
+}
+
+// fsName returns the name of the entry on the disk file system
+func (s *fileServer) fsName(name string) string {
+	fsName := path.Join(s.root, name)
+	if fsName == "" {
+		return "."
+	}
+
+	return fsName
+}
+
+// serveError answers with the status matching the error
+func serveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrOutsideRoot):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// defaultETag makes a strong entity tag of the modification time and the size
+func defaultETag(info localstorage.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.LastModified.UnixNano(), info.Size)
+}
+
+// noRangesWriter tells the clients the ranges of the file aren't served
+type noRangesWriter struct {
+	http.ResponseWriter
+}
+
+func (w *noRangesWriter) WriteHeader(code int) {
+	w.Header().Set("Accept-Ranges", "none")
+	w.ResponseWriter.WriteHeader(code)
+}
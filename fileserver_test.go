@@ -0,0 +1,190 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+// serve sends a request to the handler and returns the response
+func serve(h http.Handler, method string, target string, header http.Header) (*http.Response, string) {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	return resp, string(body)
+}
+
+func TestFileServer(t *testing.T) {
+	for _, d := range []Disk{localstorage.New(t.TempDir()), memstorage.New()} {
+		d.Create("docs/readme.txt", []byte("0123456789"))
+		d.Create("docs/photo.png", []byte("\x89PNG\r\n\x1a\n"))
+		d.Create("docs/résumé.pdf", []byte("%PDF-1.4"))
+		h := FileServer(d, FileServerOpts{})
+
+		resp, body := serve(h, http.MethodGet, "/docs/readme.txt", nil)
+		if resp.StatusCode != http.StatusOK || body != "0123456789" {
+			t.Fatalf("failed asserting serving a file on %T: %d %s", d, resp.StatusCode, body)
+		}
+		if resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" || resp.Header.Get("Content-Disposition") != `inline; filename=readme.txt` {
+			t.Errorf("failed asserting the headers on %T: %v", d, resp.Header)
+		}
+		if resp.Header.Get("ETag") == "" || resp.Header.Get("Last-Modified") == "" || resp.Header.Get("Accept-Ranges") != "bytes" {
+			t.Errorf("failed asserting the caching headers on %T: %v", d, resp.Header)
+		}
+
+		resp, body = serve(h, http.MethodGet, "/docs/readme.txt", http.Header{"Range": {"bytes=2-5"}})
+		if resp.StatusCode != http.StatusPartialContent || body != "2345" || resp.Header.Get("Content-Range") != "bytes 2-5/10" {
+			t.Errorf("failed asserting a range request on %T: %d %s", d, resp.StatusCode, body)
+		}
+
+		resp, _ = serve(h, http.MethodGet, "/docs/photo.png", nil)
+		if resp.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("failed asserting the image content type on %T: %v", d, resp.Header)
+		}
+
+		resp, _ = serve(h, http.MethodGet, "/docs/r%C3%A9sum%C3%A9.pdf", nil)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Disposition") != `inline; filename*=utf-8''r%C3%A9sum%C3%A9.pdf` {
+			t.Errorf("failed asserting a unicode file name on %T: %v", d, resp.Header)
+		}
+
+		for _, target := range []string{"/missing.txt", "/docs", "/../../etc/passwd"} {
+			if resp, _ := serve(h, http.MethodGet, target, nil); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("failed asserting %s is not found on %T: %d", target, d, resp.StatusCode)
+			}
+		}
+		if resp, _ := serve(h, http.MethodPost, "/docs/readme.txt", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("failed asserting the method is not allowed on %T: %d", d, resp.StatusCode)
+		}
+	}
+}
+
+func TestFileServerRanges(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("digits.txt", []byte("0123456789"))
+	h := FileServer(disk, FileServerOpts{})
+
+	resp, body := serve(h, http.MethodGet, "/digits.txt", http.Header{"Range": {"bytes=1-2,6-7"}})
+	if resp.StatusCode != http.StatusPartialContent || !strings.Contains(body, "12") || !strings.Contains(body, "67") {
+		t.Errorf("failed asserting multiple ranges: %d %s", resp.StatusCode, body)
+	}
+	// a stale If-Range serves the whole file past the end of the range
+	resp, body = serve(h, http.MethodGet, "/digits.txt", http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"stale"`}})
+	if resp.StatusCode != http.StatusOK || body != "0123456789" {
+		t.Errorf("failed asserting the whole file is served: %d %s", resp.StatusCode, body)
+	}
+
+	// the disk hides the ranged reads and its streams can't seek
+	h = FileServer(struct{ Disk }{disk}, FileServerOpts{})
+	resp, body = serve(h, http.MethodGet, "/digits.txt", http.Header{"Range": {"bytes=2-5"}})
+	if resp.StatusCode != http.StatusOK || body != "0123456789" || resp.Header.Get("Accept-Ranges") != "none" {
+		t.Errorf("failed asserting the ranges are turned off: %d %s %v", resp.StatusCode, body, resp.Header)
+	}
+}
+
+func TestFileServerConditional(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("docs/readme.txt", []byte("0123456789"))
+	h := FileServer(disk, FileServerOpts{})
+	resp, _ := serve(h, http.MethodGet, "/docs/readme.txt", nil)
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+
+	if resp, _ := serve(h, http.MethodGet, "/docs/readme.txt", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("failed asserting If-None-Match: %d", resp.StatusCode)
+	}
+	if resp, _ := serve(h, http.MethodGet, "/docs/readme.txt", http.Header{"If-None-Match": {`"other"`}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("failed asserting a stale If-None-Match: %d", resp.StatusCode)
+	}
+	later := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if resp, _ := serve(h, http.MethodGet, "/docs/readme.txt", http.Header{"If-Modified-Since": {later}}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("failed asserting If-Modified-Since: %d %s", resp.StatusCode, lastModified)
+	}
+	if resp, body := serve(h, http.MethodGet, "/docs/readme.txt", http.Header{"If-Range": {etag}, "Range": {"bytes=8-"}}); resp.StatusCode != http.StatusPartialContent || body != "89" {
+		t.Errorf("failed asserting If-Range: %d %s", resp.StatusCode, body)
+	}
+
+	h = FileServer(disk, FileServerOpts{
+		ETag: func(info localstorage.FileInfo) string { return `"` + info.Name + `"` },
+	})
+	if resp, _ := serve(h, http.MethodGet, "/docs/readme.txt", nil); resp.Header.Get("ETag") != `"readme.txt"` {
+		t.Errorf("failed asserting a custom ETag: %v", resp.Header)
+	}
+}
+
+func TestFileServerListing(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("docs/readme.txt", []byte("0123456789"))
+	disk.Create("docs/résumé.pdf", []byte("%PDF-1.4"))
+	disk.Create("docs/.secret", []byte("secret"))
+	disk.Create(".hidden/file.txt", []byte("hidden"))
+	h := FileServer(disk, FileServerOpts{Listing: true, HideDotFiles: true})
+
+	resp, _ := serve(h, http.MethodGet, "/docs?sort=name", nil)
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "docs/?sort=name" {
+		t.Errorf("failed asserting the directory redirect: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp, body := serve(h, http.MethodGet, "/", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `<a href="docs/">docs/</a>`) || strings.Contains(body, ".hidden") {
+		t.Errorf("failed asserting the root listing: %d %s", resp.StatusCode, body)
+	}
+	_, body = serve(h, http.MethodGet, "/docs/", nil)
+	if !strings.Contains(body, `<a href="readme.txt">readme.txt</a>`) || !strings.Contains(body, "r%C3%A9sum%C3%A9.pdf") || strings.Contains(body, ".secret") {
+		t.Errorf("failed asserting the directory listing: %s", body)
+	}
+
+	for _, target := range []string{"/docs/.secret", "/.hidden/file.txt"} {
+		if resp, _ := serve(h, http.MethodGet, target, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("failed asserting %s is hidden: %d", target, resp.StatusCode)
+		}
+	}
+}
+
+func TestFileServerConfinement(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("docs/readme.txt", []byte("0123456789"))
+	disk.Create("docs/résumé.pdf", []byte("%PDF-1.4"))
+	disk.Create("public/index.txt", []byte("public"))
+	h := FileServer(disk, FileServerOpts{
+		Root:       "docs",
+		Attachment: true,
+		Allow: func(filePath string) bool {
+			return !strings.HasSuffix(filePath, ".pdf")
+		},
+	})
+
+	resp, body := serve(h, http.MethodGet, "/readme.txt", nil)
+	if resp.StatusCode != http.StatusOK || body != "0123456789" || resp.Header.Get("Content-Disposition") != "attachment; filename=readme.txt" {
+		t.Errorf("failed asserting serving from the root: %d %v", resp.StatusCode, resp.Header)
+	}
+	for _, target := range []string{"/résumé.pdf", "/../public/index.txt", "/public/index.txt"} {
+		if resp, _ := serve(h, http.MethodGet, target, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("failed asserting %s is not served: %d", target, resp.StatusCode)
+		}
+	}
+
+	srv := httptest.NewServer(http.StripPrefix("/files", h))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/files/readme.txt")
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Error("failed asserting serving under a prefix. ", err)
+	}
+	res.Body.Close()
+}
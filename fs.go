@@ -0,0 +1,366 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/harranali/stowage/localstorage"
+)
+
+// errNoSeek is returned when seeking a file whose stream can't
+// seek on a disk that doesn't implement RangeDisk
+var errNoSeek = errors.New("seek: the disk can't read from an offset")
+
+// make sure the adapter implements the optional interfaces
+var (
+	_ fs.StatFS     = (*diskFS)(nil)
+	_ fs.ReadDirFS  = (*diskFS)(nil)
+	_ fs.ReadFileFS = (*diskFS)(nil)
+	_ fs.SubFS      = (*diskFS)(nil)
+)
+
+// AsFS returns a read only fs.FS over the given disk so it can be
+// used with http.FS, template.ParseFS, fs.WalkDir and the like,
+// the returned file system implements fs.StatFS, fs.ReadDirFS,
+// fs.ReadFileFS and fs.SubFS, its files implement io.Seeker, the disks
+// implementing RangeDisk read the files from the offset they're read at,
+// the files of the other disks seek with their streams when they can,
+// otherwise only to the offset of the stream or to the end of the file
+func AsFS(disk Disk) fs.FS {
+	return &diskFS{disk: disk, dir: "."}
+}
+
+// diskFS adapts a Disk to fs.FS, dir is the sub directory of the
+// disk the file system is rooted at
+type diskFS struct {
+	disk Disk
+	dir  string
+}
+
+// Open opens the named file or directory
+func (f *diskFS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dirFile{fsys: f, name: name, info: info}, nil
+	}
+
+	// the disks with ranged reads open the stream on the first read
+	// from where it's asked for, so seeking first reads nothing twice
+	if _, ok := f.disk.(RangeDisk); ok {
+		return &file{ReadCloser: ioutil.NopCloser(bytes.NewReader(nil)), fsys: f, name: name, info: info, at: -1, end: info.Size()}, nil
+	}
+	stream, err := f.disk.ReadStream(f.diskPath(name))
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+
+	_, seekable := stream.(io.Seeker)
+
+	return &file{ReadCloser: stream, fsys: f, name: name, info: info, seekable: seekable, end: info.Size()}, nil
+}
+
+// Stat returns the information about the named file or directory
+func (f *diskFS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// ReadFile reads the named file and returns its content
+func (f *diskFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	content, err := f.disk.Read(f.diskPath(name))
+	if err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+
+	return content, nil
+}
+
+// ReadDir reads the named directory and returns
+// its entries sorted by file name
+func (f *diskFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dirPath := f.diskPath(name)
+
+	dirs, err := f.disk.Directories(dirPath)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+	files, err := f.disk.Files(dirPath)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(dirs)+len(files))
+	for _, dir := range dirs {
+		entries = append(entries, &dirEntry{fsys: f, name: path.Base(dir), path: path.Join(name, path.Base(dir))})
+	}
+	for _, file := range files {
+		info := toFileInfo(file.Name, file)
+		entries = append(entries, &dirEntry{fsys: f, name: file.Name, info: info})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// Sub returns the file system rooted at the given directory
+func (f *diskFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return f, nil
+	}
+
+	return &diskFS{disk: f.disk, dir: f.diskPath(dir)}, nil
+}
+
+// stat validates the name and returns the information about it
+func (f *diskFS) stat(op string, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := f.disk.FileInfo(f.diskPath(name))
+	if err != nil {
+		return nil, fsError(op, name, err)
+	}
+
+	return toFileInfo(path.Base(name), info), nil
+}
+
+// diskPath returns the path of the named file on the disk
+func (f *diskFS) diskPath(name string) string {
+	return path.Join(f.dir, name)
+}
+
+// fsError converts the disk error into an *fs.PathError with the
+// name used on the file system, the underlying error is kept so
+// errors.Is matches fs.ErrNotExist as well as the disk errors
+func fsError(op string, name string, err error) error {
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// fileInfo implements fs.FileInfo over the disk file information
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     interface{}
+}
+
+// toFileInfo maps the disk file information onto fs.FileInfo,
+// the name is the one used on the file system, for example "."
+func toFileInfo(name string, info localstorage.FileInfo) *fileInfo {
+	fi := &fileInfo{name: name, size: info.Size, modTime: info.LastModified}
+	if info.FsFileInfo != nil {
+		fi.mode = info.FsFileInfo.Mode()
+		fi.sys = info.FsFileInfo.Sys()
+	}
+	// keep the type bits consistent with the disk
+	if info.IsDirectory {
+		fi.mode = fs.ModeDir | fi.mode.Perm()
+		if fi.mode.Perm() == 0 {
+			fi.mode |= 0755
+		}
+		fi.size = 0
+	} else if fi.mode.IsDir() || fi.mode.Perm() == 0 {
+		fi.mode = fi.mode&^fs.ModeDir | 0644
+	}
+
+	return fi
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}   { return i.sys }
+
+// dirEntry implements fs.DirEntry, the information about
+// directories is only read when it's asked for
+type dirEntry struct {
+	fsys *diskFS
+	name string
+	path string
+	info fs.FileInfo
+}
+
+func (e *dirEntry) Name() string { return e.name }
+func (e *dirEntry) IsDir() bool  { return e.info == nil || e.info.IsDir() }
+
+func (e *dirEntry) Type() fs.FileMode {
+	if e.info == nil {
+		return fs.ModeDir
+	}
+	return e.info.Mode().Type()
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.info != nil {
+		return e.info, nil
+	}
+	return e.fsys.stat("stat", e.path)
+}
+
+// file is an opened regular file, it seeks with the disk stream when
+// the stream can, otherwise offset is where the next read starts and
+// at is where the stream is, the stream is replaced by a ranged read
+// once they differ, the ranged reads stop at end when the reader knows
+// where it stops reading and continue to the end of the file after it
+type file struct {
+	io.ReadCloser
+	fsys     *diskFS
+	name     string
+	info     fs.FileInfo
+	seekable bool
+	offset   int64
+	at       int64
+	end      int64
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.offset != f.at {
+		if f.offset >= f.info.Size() {
+			return 0, io.EOF
+		}
+		if err := f.readFrom(f.offset); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.ReadCloser.Read(p)
+	f.offset += int64(n)
+	f.at = f.offset
+	// the ranged read stopped at end, the rest is read on demand
+	if err == io.EOF && f.at == f.end && f.end < f.info.Size() {
+		f.at, f.end = -1, f.info.Size()
+		if n == 0 {
+			return f.Read(p)
+		}
+		err = nil
+	}
+
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.seekable {
+		return f.ReadCloser.(io.Seeker).Seek(offset, whence)
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	// the disks without ranged reads would have to read the file again,
+	// seeking to the end only answers the size as reading there ends
+	if _, ok := f.fsys.disk.(RangeDisk); !ok && offset != f.at && offset < f.info.Size() {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errNoSeek}
+	}
+	f.offset = offset
+
+	return offset, nil
+}
+
+// readFrom replaces the stream with a ranged read starting at
+// the given offset, the previous stream is closed first
+func (f *file) readFrom(offset int64) error {
+	f.ReadCloser.Close()
+	length := int64(-1)
+	if offset < f.end {
+		length = f.end - offset
+	}
+	stream, err := f.fsys.disk.(RangeDisk).ReadRange(f.fsys.diskPath(f.name), offset, length)
+	if err != nil {
+		f.ReadCloser = ioutil.NopCloser(bytes.NewReader(nil))
+		return fsError("seek", f.name, err)
+	}
+	f.ReadCloser, f.at = stream, offset
+
+	return nil
+}
+
+// dirFile is an opened directory
+type dirFile struct {
+	fsys    *diskFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: ErrIsDirectory}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// ReadDir reads the entries of the directory, with n greater than
+// zero it returns at most n entries and io.EOF at the end
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage_test
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+func TestAsFS(t *testing.T) {
+	disks := map[string]Disk{
+		"local":  localstorage.New(t.TempDir()),
+		"memory": memstorage.New(),
+	}
+	for name, d := range disks {
+		d.Create("index.html", []byte("<h1>{{.}}</h1>"))
+		d.Create("docs/readme.md", []byte("read me"))
+		d.Create("docs/guide/intro.md", []byte("intro"))
+		d.Create("docs/guide/setup.md", []byte("setup"))
+		d.MakeDirectory("empty", 0755)
+
+		t.Run(name, func(t *testing.T) {
+			fsys := AsFS(d)
+			if err := fstest.TestFS(fsys, "index.html", "docs/readme.md", "docs/guide/intro.md", "docs/guide/setup.md", "empty"); err != nil {
+				t.Error("failed asserting fstest: ", err)
+			}
+
+			sub, err := fs.Sub(fsys, "docs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fstest.TestFS(sub, "readme.md", "guide/intro.md", "guide/setup.md"); err != nil {
+				t.Error("failed asserting fstest of sub: ", err)
+			}
+		})
+	}
+}
+
+func TestAsFSErrors(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("docs/readme.md", []byte("read me"))
+	fsys := AsFS(disk)
+
+	if _, err := fsys.Open("missing.md"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("failed asserting missing file error. ", err)
+	}
+	if _, err := fs.ReadFile(fsys, "docs"); !errors.Is(err, ErrIsDirectory) {
+		t.Error("failed asserting reading a directory error. ", err)
+	}
+	var pathErr *fs.PathError
+	if _, err := fs.Stat(fsys, "../outside.md"); !errors.As(err, &pathErr) || !errors.Is(err, fs.ErrInvalid) {
+		t.Error("failed asserting invalid path error. ", err)
+	}
+}
+
+// rangeDisk records the offsets of the ranged reads
+type rangeDisk struct {
+	*memstorage.MemStorage
+	offsets []int64
+}
+
+func (d *rangeDisk) ReadRange(filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	d.offsets = append(d.offsets, offset)
+	return d.MemStorage.ReadRange(filePath, offset, length)
+}
+
+func TestAsFSSeek(t *testing.T) {
+	disk := &rangeDisk{MemStorage: memstorage.New()}
+	disk.Create("digits.txt", []byte("0123456789"))
+	f, err := AsFS(disk).Open("digits.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seeker := f.(io.ReadSeeker)
+
+	reads := []struct {
+		offset  int64
+		whence  int
+		content string
+	}{
+		{6, io.SeekStart, "6789"},
+		{-8, io.SeekEnd, "23"},
+		{1, io.SeekCurrent, "5"},
+		{0, io.SeekStart, "01"},
+	}
+	for _, r := range reads {
+		if _, err := seeker.Seek(r.offset, r.whence); err != nil {
+			t.Fatal("failed asserting seek. ", err)
+		}
+		buf := make([]byte, len(r.content))
+		if _, err := io.ReadFull(seeker, buf); err != nil || string(buf) != r.content {
+			t.Errorf("failed asserting the read after seeking to %d: %q %v", r.offset, buf, err)
+		}
+	}
+	if size, err := seeker.Seek(0, io.SeekEnd); err != nil || size != 10 {
+		t.Error("failed asserting seeking to the end. ", size, err)
+	}
+	if n, err := seeker.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Error("failed asserting reading at the end. ", n, err)
+	}
+	if fmt.Sprint(disk.offsets) != "[6 2 5 0]" {
+		t.Error("failed asserting the ranged reads. ", disk.offsets)
+	}
+}
+
+func TestAsFSSeekWithoutRanges(t *testing.T) {
+	mem := memstorage.New()
+	mem.Create("digits.txt", []byte("0123456789"))
+	// the disk hides the ranged reads of the memory storage
+	f, err := AsFS(struct{ Disk }{mem}).Open("digits.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seeker := f.(io.ReadSeeker)
+
+	// the size is found the way http.ServeContent does
+	if size, err := seeker.Seek(0, io.SeekEnd); err != nil || size != 10 {
+		t.Error("failed asserting seeking to the end. ", size, err)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		t.Error("failed asserting seeking back to the stream. ", err)
+	}
+	if _, err := seeker.Seek(3, io.SeekStart); err == nil {
+		t.Error("failed asserting seeking away from the stream fails")
+	}
+	if content, err := ioutil.ReadAll(seeker); err != nil || string(content) != "0123456789" {
+		t.Errorf("failed asserting the content: %q %v", content, err)
+	}
+}
+
+func TestAsFSWalkDir(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("index.html", []byte("<h1>{{.}}</h1>"))
+	disk.Create("docs/readme.md", []byte("read me"))
+	disk.Create("docs/guide/intro.md", []byte("intro"))
+	disk.Create("docs/guide/setup.md", []byte("setup"))
+	disk.MakeDirectory("empty", 0755)
+	fsys := AsFS(disk)
+
+	walked := []string{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(walked, ",") != ".,docs,docs/guide,docs/guide/intro.md,docs/guide/setup.md,docs/readme.md,empty,index.html" {
+		t.Error("failed asserting walk dir. ", walked)
+	}
+}
+
+func TestAsFSHTTPAndTemplates(t *testing.T) {
+	disk := memstorage.New()
+	disk.Create("index.html", []byte("<h1>{{.}}</h1>"))
+	disk.Create("docs/readme.md", []byte("read me"))
+	fsys := AsFS(disk)
+
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/docs/readme.md", nil)
+	req.Header.Set("Range", "bytes=5-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "me" {
+		t.Error("failed asserting http.FS range request. ", resp.StatusCode, string(body))
+	}
+
+	tmpl, err := template.ParseFS(fsys, "*.html")
+	if err != nil {
+		t.Fatal("failed asserting template.ParseFS. ", err)
+	}
+	var out strings.Builder
+	tmpl.Execute(&out, "title")
+	if out.String() != "<h1>title</h1>" {
+		t.Error("failed asserting template output. ", out.String())
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package replace overwrites the files of the disks without
+// losing their content when the write fails, it's shared by
+// the transfers and the decorators
+package replace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/harranali/stowage/localstorage"
+)
+
+// Disk is the part of a disk used to replace its files
+type Disk interface {
+	WriteStream(filePath string, r io.Reader) (int64, error)
+	Rename(filePath string, newFilePath string) error
+	Delete(filePath string) error
+}
+
+// policyDisk is implemented by the disks supporting the conflict policies
+type policyDisk interface {
+	WriteStreamWith(filePath string, r io.Reader, policy localstorage.ConflictPolicy) (localstorage.WriteResult, error)
+}
+
+// Write writes the content of the reader over the given file, the disks
+// supporting the conflict policies overwrite it with Overwrite, on the
+// others the content is streamed into a hidden temp file next to it which
+// is renamed over the file once complete, so a failed write leaves the
+// file as it was, it returns the number of bytes written and an error
+// incase there is any
+func Write(disk Disk, filePath string, r io.Reader) (int64, error) {
+	if policyDisk, ok := disk.(policyDisk); ok {
+		result, err := policyDisk.WriteStreamWith(filePath, r, localstorage.Overwrite)
+		return result.Size, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return 0, err
+	}
+	dir, name := path.Split(strings.TrimPrefix(path.Clean("/"+filePath), "/"))
+	tmpPath := path.Join(dir, "."+name+".tmp-"+hex.EncodeToString(suffix))
+
+	n, err := disk.WriteStream(tmpPath, r)
+	if err == nil {
+		err = disk.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		disk.Delete(tmpPath)
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package replace_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/internal/replace"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+func TestWrite(t *testing.T) {
+	disks := map[string]stowage.Disk{"local": localstorage.New(t.TempDir()), "memory": memstorage.New()}
+	for name, disk := range disks {
+		disk.Create("dir/a.txt", []byte("old"))
+
+		n, err := Write(disk, "dir/a.txt", strings.NewReader("new content"))
+		if err != nil || n != 11 {
+			t.Fatalf("failed asserting replace on %s: %d %v", name, n, err)
+		}
+		if content, _ := disk.Read("dir/a.txt"); string(content) != "new content" {
+			t.Errorf("failed asserting the file is replaced on %s", name)
+		}
+
+		failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("read failed")))
+		if _, err := Write(disk, "dir/a.txt", failing); err == nil {
+			t.Errorf("failed asserting the failed write is reported on %s", name)
+		}
+		if content, _ := disk.Read("dir/a.txt"); string(content) != "new content" {
+			t.Errorf("failed asserting a failed write leaves the file as it was on %s", name)
+		}
+		if files, _ := disk.Files("dir"); len(files) != 1 {
+			t.Errorf("failed asserting the temp file is removed on %s", name)
+		}
+	}
+}
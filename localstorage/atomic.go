@@ -0,0 +1,102 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeAtomic writes the content of the reader into a temp file in the
+// same directory as the destination, syncs it and hands it to place to
+// move it into place, so readers either see the whole file or no file
+// at all, the temp file is removed on failure
+func (l *LocalStorage) writeAtomic(ctx context.Context, fullPath string, r io.Reader, place func(tmpPath string) error) (int64, error) {
+	dir := filepath.Dir(fullPath)
+	tmp, err := l.createTemp(dir, filepath.Base(fullPath))
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+
+	n, err := copyStream(ctx, tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = place(tmpPath)
+	}
+	// the temp file is gone after a rename, after a link
+	// or a failure it has to be removed
+	l.remove(tmpPath)
+	if err != nil {
+		return n, err
+	}
+
+	if l.syncDirectory {
+		if err := syncDir(dir); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// link links the file to the destination failing if it exists,
+// file systems without hard links fall back to checking the
+// destination before renaming which isn't safe against races,
+// it reports whether the file was renamed rather than linked
+func link(src string, dest string) (renamed bool, err error) {
+	err = os.Link(src, dest)
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return false, err
+	}
+	if _, statErr := os.Lstat(dest); statErr == nil {
+		return false, fs.ErrExist
+	}
+
+	return true, os.Rename(src, dest)
+}
+
+// createTemp creates a hidden temp file next to the destination,
+// unlike os.CreateTemp it honors the umask like os.Create does
+func (l *LocalStorage) createTemp(dir string, name string) (*os.File, error) {
+	for {
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		tmpPath := filepath.Join(dir, "."+name+".tmp-"+hex.EncodeToString(suffix))
+		file, err := l.openFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return file, err
+	}
+}
+
+// syncDir flushes the directory entries so a completed
+// rename survives a crash of the system
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
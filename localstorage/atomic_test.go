@@ -0,0 +1,118 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+// failingReader returns the error once its content is read
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+// assertOnlyEntries fails the test incase the directory holds other
+// entries than the given ones, like leftover temp files
+func assertOnlyEntries(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, _ := ioutil.ReadDir(dir)
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		t.Errorf("failed asserting the directory entries: got %v, want %v", got, names)
+	}
+}
+
+func TestAtomicWriteFailure(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+
+	diskFull := errors.New("no space left on device")
+	_, err := l.WriteStream("sub/file.md", &failingReader{r: strings.NewReader("partial content"), err: diskFull})
+	if !errors.Is(err, diskFull) {
+		t.Error("failed asserting the write error. ", err)
+	}
+	// neither the file nor the temp file is left behind
+	assertOnlyEntries(t, filepath.Join(root, "sub"))
+}
+
+func TestAtomicWriteVisibility(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := l.WriteStream("file.md", pr)
+		done <- err
+	}()
+
+	pw.Write([]byte("first half "))
+	// the file isn't visible while it's being written
+	if _, err := os.Stat(filepath.Join(root, "file.md")); !os.IsNotExist(err) {
+		t.Error("failed asserting the partial file isn't visible. ", err)
+	}
+	pw.Write([]byte("second half"))
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(root, "file.md"))
+	if string(content) != "first half second half" {
+		t.Error("failed asserting the written content")
+	}
+	assertOnlyEntries(t, root, "file.md")
+}
+
+func TestAtomicWriteNeverOverwrites(t *testing.T) {
+	root := t.TempDir()
+	l := NewWithOpts(root, Opts{SyncDirectory: true})
+
+	if err := l.Create("file.md", []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "file.md")
+	ioutil.WriteFile(src, []byte("replacement"), 0644)
+
+	if err := l.Put(src); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting put over an existing file. ", err)
+	}
+	if err := l.Create("copy.md", []byte("copy")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.CopyAs("copy.md", "/", "file.md"); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting copy over an existing file. ", err)
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(root, "file.md"))
+	if string(content) != "original" {
+		t.Error("failed asserting the existing file is kept")
+	}
+	info, _ := os.Stat(filepath.Join(root, "copy.md"))
+	if info.Mode().Perm()&0600 != 0600 {
+		t.Error("failed asserting the file permissions. ", info.Mode())
+	}
+	assertOnlyEntries(t, root, "copy.md", "file.md")
+}
@@ -0,0 +1,226 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChecksumAlgorithm names a supported checksum algorithm
+type ChecksumAlgorithm string
+
+// the supported checksum algorithms
+const (
+	MD5    ChecksumAlgorithm = "md5"
+	SHA1   ChecksumAlgorithm = "sha1"
+	SHA256 ChecksumAlgorithm = "sha256"
+	CRC32C ChecksumAlgorithm = "crc32c"
+)
+
+// errors returned by the checksum operations wrapped in a *PathError
+var (
+	ErrChecksumMismatch     = errors.New("checksum mismatch")
+	ErrUnsupportedAlgorithm = errors.New("unsupported checksum algorithm")
+)
+
+// Checksum is a hex encoded checksum computed with the given algorithm
+type Checksum struct {
+	Algorithm ChecksumAlgorithm
+	Value     string
+}
+
+// ChecksumMismatchError is returned by Verify wrapped in a *PathError
+// when the file content doesn't match the expected checksum,
+// it matches ErrChecksumMismatch with errors.Is
+type ChecksumMismatchError struct {
+	Algorithm ChecksumAlgorithm
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return string(e.Algorithm) + " checksum mismatch: expected " + e.Expected + ", got " + e.Actual
+}
+
+// Is reports whether the target is ErrChecksumMismatch
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// newHash creates the hash of the given algorithm
+func newHash(algo ChecksumAlgorithm) (hash.Hash, error) {
+	switch algo {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case CRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// Checksum returns the hex encoded checksum of the file content computed
+// with the given algorithm, the checksums are cached until the size or
+// the modification time of the file changes,
+// it returns an error incase there is any
+func (l *LocalStorage) Checksum(filePath string, algo ChecksumAlgorithm) (string, error) {
+	return l.ChecksumCtx(context.Background(), filePath, algo)
+}
+
+// ChecksumCtx is the context aware variant of Checksum
+func (l *LocalStorage) ChecksumCtx(ctx context.Context, filePath string, algo ChecksumAlgorithm) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	fullPath, err := l.resolve("checksum", filePath)
+	if err != nil {
+		return "", err
+	}
+	s, err := os.Stat(fullPath)
+	if err != nil {
+		return "", l.pathError("checksum", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return "", l.pathError("checksum", filePath, err)
+	}
+
+	sum, err := l.checksum(ctx, fullPath, s, algo)
+	if err != nil {
+		return "", l.pathError("checksum", filePath, err)
+	}
+
+	return sum, nil
+}
+
+// Verify compares the checksum of the file content with the expected one,
+// it returns a *ChecksumMismatchError wrapped in a *PathError incase they
+// differ or an other error incase there is any
+func (l *LocalStorage) Verify(filePath string, expected Checksum) error {
+	return l.VerifyCtx(context.Background(), filePath, expected)
+}
+
+// VerifyCtx is the context aware variant of Verify
+func (l *LocalStorage) VerifyCtx(ctx context.Context, filePath string, expected Checksum) error {
+	actual, err := l.ChecksumCtx(ctx, filePath, expected.Algorithm)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected.Value) {
+		return l.pathError("verify", filePath, &ChecksumMismatchError{
+			Algorithm: expected.Algorithm,
+			Expected:  expected.Value,
+			Actual:    actual,
+		})
+	}
+
+	return nil
+}
+
+// checksum returns the checksum of the file from the cache
+// or computes it and caches it
+func (l *LocalStorage) checksum(ctx context.Context, fullPath string, s os.FileInfo, algo ChecksumAlgorithm) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := l.checksums.get(fullPath, algo, s); ok {
+		return sum, nil
+	}
+
+	f, err := l.openFile(fullPath, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := copyStream(ctx, h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	l.checksums.set(fullPath, algo, s, sum)
+
+	return sum, nil
+}
+
+// checksumsOf computes the checksums filled in the file information
+func (l *LocalStorage) checksumsOf(ctx context.Context, fullPath string, s os.FileInfo) (map[ChecksumAlgorithm]string, error) {
+	sums := make(map[ChecksumAlgorithm]string, len(l.listingChecksums))
+	for _, algo := range l.listingChecksums {
+		sum, err := l.checksum(ctx, fullPath, s, algo)
+		if err != nil {
+			return nil, err
+		}
+		sums[algo] = sum
+	}
+
+	return sums, nil
+}
+
+// maxCachedChecksums bounds the number of cached checksums,
+// the cache is cleared once it's reached
+const maxCachedChecksums = 10000
+
+// checksumKey identifies a cached checksum
+type checksumKey struct {
+	path string
+	algo ChecksumAlgorithm
+}
+
+// cachedChecksum is a checksum along with the size and the
+// modification time of the file it was computed for
+type cachedChecksum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// checksumCache caches the computed checksums, a nil cache caches nothing
+type checksumCache struct {
+	mu      sync.Mutex
+	entries map[checksumKey]cachedChecksum
+}
+
+// get returns the cached checksum if the file didn't change since
+func (c *checksumCache) get(fullPath string, algo ChecksumAlgorithm, s os.FileInfo) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[checksumKey{fullPath, algo}]
+	if !ok || entry.size != s.Size() || !entry.modTime.Equal(s.ModTime()) {
+		return "", false
+	}
+
+	return entry.sum, true
+}
+
+// set caches the checksum of the file
+func (c *checksumCache) set(fullPath string, algo ChecksumAlgorithm, s os.FileInfo, sum string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= maxCachedChecksums {
+		c.entries = map[checksumKey]cachedChecksum{}
+	}
+	c.entries[checksumKey{fullPath, algo}] = cachedChecksum{size: s.Size(), modTime: s.ModTime(), sum: sum}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+func TestChecksum(t *testing.T) {
+	l := New(t.TempDir())
+	l.Create("hello.txt", []byte("hello world"))
+	l.Create("digits.txt", []byte("123456789"))
+
+	tests := []struct {
+		file string
+		algo ChecksumAlgorithm
+		sum  string
+	}{
+		{"hello.txt", MD5, "5eb63bbbe01eeed093cb22bb8f5acdc3"},
+		{"hello.txt", SHA1, "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed"},
+		{"hello.txt", SHA256, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+		{"digits.txt", CRC32C, "e3069283"},
+	}
+	for _, tt := range tests {
+		sum, err := l.Checksum(tt.file, tt.algo)
+		if err != nil || sum != tt.sum {
+			t.Errorf("failed asserting %s checksum: %s %v", tt.algo, sum, err)
+		}
+	}
+
+	if _, err := l.Checksum("hello.txt", "md4"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Error("failed asserting unsupported algorithm. ", err)
+	}
+	if _, err := l.Checksum("missing.txt", MD5); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting checksum of a missing file. ", err)
+	}
+	l.MakeDirectory("dir", 0755)
+	if _, err := l.Checksum("dir", MD5); !errors.Is(err, ErrIsDirectory) {
+		t.Error("failed asserting checksum of a directory. ", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	l := New(t.TempDir())
+	l.Create("hello.txt", []byte("hello world"))
+
+	if err := l.Verify("hello.txt", Checksum{Algorithm: MD5, Value: "5EB63BBBE01EEED093CB22BB8F5ACDC3"}); err != nil {
+		t.Error("failed asserting verify. ", err)
+	}
+
+	err := l.Verify("hello.txt", Checksum{Algorithm: MD5, Value: "00"})
+	var mismatch *ChecksumMismatchError
+	var pathErr *PathError
+	if !errors.Is(err, ErrChecksumMismatch) || !errors.As(err, &mismatch) || !errors.As(err, &pathErr) {
+		t.Fatal("failed asserting checksum mismatch. ", err)
+	}
+	if mismatch.Expected != "00" || mismatch.Actual != "5eb63bbbe01eeed093cb22bb8f5acdc3" || pathErr.Op != "verify" {
+		t.Errorf("failed asserting the mismatch error: %v", err)
+	}
+}
+
+func TestChecksumCache(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	l.Create("file.txt", []byte("aaaa"))
+	fullPath := filepath.Join(root, "file.txt")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(fullPath, mtime, mtime)
+	first, _ := l.Checksum("file.txt", SHA256)
+
+	// same size and time, the cached checksum is returned
+	ioutil.WriteFile(fullPath, []byte("bbbb"), 0644)
+	os.Chtimes(fullPath, mtime, mtime)
+	if sum, _ := l.Checksum("file.txt", SHA256); sum != first {
+		t.Error("failed asserting the checksum is cached")
+	}
+
+	os.Chtimes(fullPath, mtime.Add(time.Second), mtime.Add(time.Second))
+	if sum, _ := l.Checksum("file.txt", SHA256); sum == first {
+		t.Error("failed asserting the cache is invalidated by the time")
+	}
+}
+
+func TestListingChecksums(t *testing.T) {
+	l := NewWithOpts(t.TempDir(), Opts{Checksums: []ChecksumAlgorithm{MD5, CRC32C}})
+	l.Create("docs/hello.txt", []byte("hello world"))
+	l.Create("docs/sub/digits.txt", []byte("123456789"))
+
+	files, err := l.AllFiles("docs")
+	if err != nil || len(files) != 2 {
+		t.Fatal("failed asserting the listing. ", err)
+	}
+	for _, f := range files {
+		if len(f.Checksums) != 2 || f.Checksums[MD5] == "" || f.Checksums[CRC32C] == "" {
+			t.Errorf("failed asserting the checksums of %s: %v", f.Name, f.Checksums)
+		}
+	}
+	info, _ := l.FileInfo("docs/sub/digits.txt")
+	if info.Checksums[CRC32C] != "e3069283" {
+		t.Error("failed asserting the file info checksums: ", info.Checksums)
+	}
+	if info, _ := l.FileInfo("docs"); info.Checksums != nil {
+		t.Error("failed asserting directories have no checksums")
+	}
+	if info, _ := New(t.TempDir()).FileInfo("."); info.Checksums != nil {
+		t.Error("failed asserting checksums are opt in")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// sniffLength is the number of bytes used to sniff the content type
+const sniffLength = 512
+
+// contentTypes maps the common extensions to their content types,
+// so they don't depend on the mime tables of the system
+var contentTypes = map[string]string{
+	"txt":  "text/plain; charset=utf-8",
+	"md":   "text/markdown; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+	"htm":  "text/html; charset=utf-8",
+	"css":  "text/css; charset=utf-8",
+	"js":   "text/javascript; charset=utf-8",
+	"json": "application/json",
+	"xml":  "text/xml; charset=utf-8",
+	"pdf":  "application/pdf",
+	"zip":  "application/zip",
+	"gz":   "application/gzip",
+	"tar":  "application/x-tar",
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"svg":  "image/svg+xml",
+	"ico":  "image/x-icon",
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"ogg":  "audio/ogg",
+	"mp4":  "video/mp4",
+	"webm": "video/webm",
+	"mov":  "video/quicktime",
+	"wasm": "application/wasm",
+}
+
+// ContentTypeByExtension returns the content type of the file by its
+// extension, the overrides map extensions without the dot to content
+// types and take precedence over the built-in table which takes
+// precedence over the mime tables of the system,
+// it returns "" incase the extension is unknown
+func ContentTypeByExtension(name string, overrides map[string]string) string {
+	ext := strings.ToLower(removeFirstChar(path.Ext(name)))
+	if ext == "" {
+		return ""
+	}
+	for key, contentType := range overrides {
+		if strings.ToLower(strings.TrimPrefix(key, ".")) == ext {
+			return contentType
+		}
+	}
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+
+	return mime.TypeByExtension("." + ext)
+}
+
+// ContentTypeOrDefault returns the content type of the file by its
+// extension, or "application/octet-stream" incase the extension is unknown,
+// it's meant for the disks which don't read the files to sniff their content
+func ContentTypeOrDefault(name string) string {
+	if contentType := ContentTypeByExtension(name, nil); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
+
+// DetectContentType returns the content type of the file by its extension
+// or, incase the extension is unknown, by sniffing the head of its content
+// with http.DetectContentType
+func DetectContentType(name string, overrides map[string]string, head []byte) string {
+	if contentType := ContentTypeByExtension(name, overrides); contentType != "" {
+		return contentType
+	}
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+
+	return http.DetectContentType(head)
+}
+
+// MatchContentType reports whether the content type matches the pattern,
+// a pattern is a media type like "image/png" or a family like "image/*",
+// the parameters like the charset are ignored
+func MatchContentType(contentType string, pattern string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	pattern = strings.ToLower(strings.TrimSpace(strings.Split(pattern, ";")[0]))
+	if pattern == "*/*" || pattern == "*" {
+		return mediaType != ""
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return mediaType == pattern
+}
+
+// FilterByContentType returns the files whose content type
+// matches any of the patterns, see MatchContentType
+func FilterByContentType(files []FileInfo, patterns ...string) []FileInfo {
+	filtered := []FileInfo{}
+	for _, f := range files {
+		for _, pattern := range patterns {
+			if MatchContentType(f.ContentType, pattern) {
+				filtered = append(filtered, f)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// contentType returns the content type of the file, the head of the file
+// is read only when its extension is unknown and it's a regular file,
+// so pipes, sockets and devices aren't opened
+func (l *LocalStorage) contentType(fullPath string, mode os.FileMode) string {
+	if contentType := ContentTypeByExtension(fullPath, l.contentTypes); contentType != "" {
+		return contentType
+	}
+	if !mode.IsRegular() {
+		return ""
+	}
+
+	head := make([]byte, sniffLength)
+	f, err := l.openFile(fullPath, os.O_RDONLY, 0)
+	if err != nil {
+		return DetectContentType(fullPath, l.contentTypes, nil)
+	}
+	defer f.Close()
+	n, _ := io.ReadFull(f, head)
+
+	return DetectContentType(fullPath, l.contentTypes, head[:n])
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package localstorage_test
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+func TestContentTypeOfFIFO(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	l.Create("pipes/notes.txt", []byte("notes"))
+	if err := syscall.Mkfifo(filepath.Join(root, "pipes", "queue"), 0644); err != nil {
+		t.Skip("mkfifo isn't supported: ", err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(root, "pipes", "events.json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []FileInfo, 1)
+	go func() {
+		files, err := l.Files("pipes")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- files
+	}()
+
+	select {
+	case files := <-done:
+		types := map[string]string{}
+		for _, f := range files {
+			types[f.Name] = f.ContentType
+		}
+		if len(types) != 3 || types["queue"] != "" || types["events.json"] != "application/json" || types["notes.txt"] != "text/plain; charset=utf-8" {
+			t.Errorf("failed asserting the content types of a directory with pipes: %v", types)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed asserting the listing doesn't open the pipes")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"testing"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+func TestContentType(t *testing.T) {
+	l := NewWithOpts(t.TempDir(), Opts{ContentTypes: map[string]string{".log": "text/x-log", "JSON": "application/vnd.api+json"}})
+	files := map[string]string{
+		"photo.JPG":    "not really a jpeg",
+		"notes.txt":    "notes",
+		"noext":        "<html><body>hello</body></html>",
+		"image.bin123": "\x89PNG\r\n\x1a\n0000",
+		"app.log":      "log line",
+		"data.json":    "{}",
+	}
+	for file, content := range files {
+		l.Create(file, []byte(content))
+	}
+
+	tests := map[string]string{
+		"photo.JPG":    "image/jpeg",
+		"notes.txt":    "text/plain; charset=utf-8",
+		"noext":        "text/html; charset=utf-8",
+		"image.bin123": "image/png",
+		"app.log":      "text/x-log",
+		"data.json":    "application/vnd.api+json",
+	}
+	for file, contentType := range tests {
+		info, err := l.FileInfo(file)
+		if err != nil || info.ContentType != contentType {
+			t.Errorf("failed asserting the content type of %s: %q %v", file, info.ContentType, err)
+		}
+	}
+	l.MakeDirectory("dir.png", 0755)
+	if info, _ := l.FileInfo("dir.png"); info.ContentType != "" {
+		t.Error("failed asserting directories have no content type")
+	}
+}
+
+func TestContentTypeOrDefault(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+	}{
+		{"a.png", "image/png"},
+		{"docs/A.JSON", "application/json"},
+		{"a.unknown-ext", "application/octet-stream"},
+		{"noext", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := ContentTypeOrDefault(tt.name); got != tt.contentType {
+			t.Errorf("failed asserting the content type of %q: %q", tt.name, got)
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := map[string]string{"a.txt": "txt", "docs/a.tar.gz": "gz", "noext": "", ".env": "env"}
+	for name, ext := range tests {
+		if got := Extension(name); got != ext {
+			t.Errorf("failed asserting the extension of %q: %q", name, got)
+		}
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		pattern     string
+		match       bool
+	}{
+		{"image/png", "image/png", true},
+		{"image/png", "image/*", true},
+		{"IMAGE/PNG", "image/*", true},
+		{"text/plain; charset=utf-8", "text/plain", true},
+		{"text/plain; charset=utf-8", "*/*", true},
+		{"image/png", "image/jpeg", false},
+		{"imagex/png", "image/*", false},
+		{"", "*/*", false},
+	}
+	for _, tt := range tests {
+		if MatchContentType(tt.contentType, tt.pattern) != tt.match {
+			t.Errorf("failed asserting %q matches %q is %v", tt.contentType, tt.pattern, tt.match)
+		}
+	}
+}
+
+func TestFilterByContentType(t *testing.T) {
+	l := New(t.TempDir())
+	for _, file := range []string{"a.png", "b.jpg", "docs/c.txt", "docs/d.mp4"} {
+		l.Create(file, []byte("content"))
+	}
+	files, _ := l.AllFiles(".")
+
+	if images := FilterByContentType(files, "image/*"); len(images) != 2 {
+		t.Errorf("failed asserting the image files: %d", len(images))
+	}
+	if media := FilterByContentType(files, "image/png", "video/*"); len(media) != 2 {
+		t.Errorf("failed asserting the media files: %d", len(media))
+	}
+	if none := FilterByContentType(files, "audio/*"); len(none) != 0 {
+		t.Errorf("failed asserting no audio files: %d", len(none))
+	}
+}
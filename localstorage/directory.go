@@ -0,0 +1,597 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// SymlinkPolicy decides how the symlinks found in a directory tree are copied
+type SymlinkPolicy int
+
+const (
+	// SkipSymlinks leaves the symlinks out
+	SkipSymlinks SymlinkPolicy = iota
+	// FollowSymlinks copies what the symlinks point to, symlinks leading
+	// outside the root folder, dangling ones and the ones forming a
+	// cycle are left out
+	FollowSymlinks
+	// PreserveSymlinks recreates the symlinks with the same target
+	PreserveSymlinks
+)
+
+// DirectoryOpts options for copying and moving directories
+type DirectoryOpts struct {
+	// Conflict is applied to every file which exists in the
+	// destination, it defaults to Fail which copies nothing
+	// when any of the files exists
+	Conflict ConflictPolicy
+	// Symlinks defaults to SkipSymlinks
+	Symlinks SymlinkPolicy
+	// Workers is the number of files copied concurrently, it defaults to 4
+	Workers int
+	// Progress is called after every file, the calls never overlap
+	Progress func(Progress)
+}
+
+// Progress reports the progress of a directory copy or move
+type Progress struct {
+	// Path is the destination path of the processed file
+	Path       string
+	Action     Action
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// DirectoryResult reports the outcome of a directory copy or move
+type DirectoryResult struct {
+	// Files is the number of processed files including the skipped ones
+	Files int
+	// Bytes is the number of bytes written
+	Bytes       int64
+	Created     int
+	Overwritten int
+	Skipped     int
+	Renamed     int
+}
+
+// RemoveErrors is returned by MoveDirectory when the tree is copied but
+// some of the moved source entries couldn't be removed, it holds an
+// error for every entry left in the source
+type RemoveErrors []error
+
+func (e RemoveErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d moved entries were not removed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the entries
+func (e RemoveErrors) Unwrap() []error {
+	return e
+}
+
+// Is reports whether the error of any entry matches the target,
+// errors.Is doesn't walk the errors returned by Unwrap before Go 1.20
+func (e RemoveErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error of the entries matching the target
+// and sets the target to it, see Is
+func (e RemoveErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultWorkers is the number of files copied concurrently by default
+const defaultWorkers = 4
+
+// rename renames the directories, tests replace it to simulate EXDEV
+var rename = os.Rename
+
+// treeEntry is an entry of a scanned directory tree, rel is
+// relative to the scanned directory, link is the target of
+// the preserved symlinks, followed is the followed symlink
+// to a directory the entry was reached through
+type treeEntry struct {
+	rel      string
+	info     fs.FileInfo
+	link     string
+	followed string
+}
+
+// tree is a scanned directory tree, dirs are in walk order, links
+// are the followed symlinks to directories found in the tree itself,
+// kept are the skipped files and the links leading to them
+type tree struct {
+	dirs     []treeEntry
+	files    []treeEntry
+	links    []string
+	kept     map[string]bool
+	symlinks bool
+	bytes    int64
+}
+
+// CopyDirectory copies the directory tree into the destination directory
+// preserving the modes and the modification times, existing directories
+// are merged and the conflict policy is applied to the existing files,
+// it returns the outcome and an error incase there is any
+func (l *LocalStorage) CopyDirectory(DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error) {
+	return l.CopyDirectoryCtx(context.Background(), DirectoryPath, destPath, opts)
+}
+
+// CopyDirectoryCtx is the context aware variant of CopyDirectory,
+// the copy stops as soon as the context is done
+func (l *LocalStorage) CopyDirectoryCtx(ctx context.Context, DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error) {
+	return l.copyDirectory(ctx, "copy", DirectoryPath, destPath, opts)
+}
+
+// MoveDirectory moves the directory tree into the destination directory,
+// a missing destination is renamed into place at once, otherwise or
+// when the destination is on another device the tree is copied and
+// the moved files are deleted, skipped files stay in the source, the
+// entries that can't be deleted are reported with RemoveErrors,
+// it returns the outcome and an error incase there is any
+func (l *LocalStorage) MoveDirectory(DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error) {
+	return l.MoveDirectoryCtx(context.Background(), DirectoryPath, destPath, opts)
+}
+
+// MoveDirectoryCtx is the context aware variant of MoveDirectory,
+// the move stops as soon as the context is done
+func (l *LocalStorage) MoveDirectoryCtx(ctx context.Context, DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error) {
+	return l.copyDirectory(ctx, "move", DirectoryPath, destPath, opts)
+}
+
+// copyDirectory copies the tree, with the op "move" the source is removed
+func (l *LocalStorage) copyDirectory(ctx context.Context, op string, DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return DirectoryResult{}, err
+	}
+
+	srcFullPath, err := l.resolve(op, DirectoryPath)
+	if err != nil {
+		return DirectoryResult{}, err
+	}
+	destFullPath, err := l.resolve(op, destPath)
+	if err != nil {
+		return DirectoryResult{}, err
+	}
+	srcRel, _ := cleanRelative(DirectoryPath)
+	destRel, _ := cleanRelative(destPath)
+
+	// make sure the source is a directory
+	s, err := os.Stat(srcFullPath)
+	if err != nil {
+		return DirectoryResult{}, l.pathError(op, DirectoryPath, err)
+	}
+	if !s.IsDir() {
+		return DirectoryResult{}, l.pathError(op, DirectoryPath, syscall.ENOTDIR)
+	}
+	// a directory can't be copied into itself
+	if srcRel == "." || isWithin(srcFullPath, destFullPath) {
+		return DirectoryResult{}, l.pathError(op, DirectoryPath, syscall.EINVAL)
+	}
+
+	t, err := l.scan(ctx, op, srcRel, s, opts.Symlinks)
+	if err != nil {
+		return DirectoryResult{}, l.pathError(op, DirectoryPath, err)
+	}
+
+	// renaming moves the symlinks as they are,
+	// so the trees holding symlinks are copied
+	if op == "move" && (!t.symlinks || opts.Symlinks == PreserveSymlinks) {
+		moved, err := l.renameTree(srcFullPath, destFullPath)
+		if err != nil {
+			return DirectoryResult{}, l.pathError(op, DirectoryPath, err)
+		}
+		if moved {
+			return t.renamed(destRel, opts.Progress), nil
+		}
+	}
+
+	// with the fail policy nothing is copied when a file exists,
+	// the copies running concurrently would leave some behind
+	if opts.Conflict == Fail {
+		for _, entry := range t.files {
+			if _, err := os.Lstat(filepath.Join(destFullPath, filepath.FromSlash(entry.rel))); err == nil {
+				return DirectoryResult{}, l.pathError(op, DirectoryPath, ErrAlreadyExists)
+			}
+		}
+	}
+
+	// create the directories before their files, the modes are
+	// applied last so read only directories can be filled
+	if err := os.MkdirAll(destFullPath, 0755); err != nil {
+		return DirectoryResult{}, l.pathError(op, DirectoryPath, err)
+	}
+	for _, dir := range t.dirs {
+		if err := os.MkdirAll(filepath.Join(destFullPath, filepath.FromSlash(dir.rel)), 0755); err != nil {
+			return DirectoryResult{}, l.pathError(op, DirectoryPath, err)
+		}
+	}
+
+	result, err := l.copyFiles(ctx, op, srcRel, destRel, t, opts)
+	if err != nil {
+		return result, l.pathError(op, DirectoryPath, err)
+	}
+
+	// apply the modes and the times of the directories deepest first,
+	// as creating their entries changed the times
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		applyInfo(filepath.Join(destFullPath, filepath.FromSlash(t.dirs[i].rel)), t.dirs[i].info)
+	}
+	applyInfo(destFullPath, s)
+
+	if op == "move" {
+		if errs := l.removeTree(srcRel, srcFullPath, t); len(errs) > 0 {
+			return result, errs
+		}
+	}
+
+	return result, nil
+}
+
+// removeTree removes the moved source entries once all of them are copied,
+// as the followed symlinks may point to the files of the tree, it returns
+// the errors of the entries that couldn't be removed
+func (l *LocalStorage) removeTree(srcRel string, srcFullPath string, t *tree) RemoveErrors {
+	var errs RemoveErrors
+	remove := func(rel string, dir bool) {
+		err := l.remove(filepath.Join(srcFullPath, filepath.FromSlash(rel)))
+		// the directories still holding skipped entries stay
+		if err == nil || os.IsNotExist(err) || (dir && (errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST))) {
+			return
+		}
+		errs = append(errs, l.pathError("move", path.Join(srcRel, rel), err))
+	}
+
+	// the entries reached through a followed symlink aren't in the tree
+	for _, entry := range t.files {
+		if entry.followed == "" && !t.kept[entry.rel] {
+			remove(entry.rel, false)
+		}
+	}
+	// the followed symlinks are removed rather than what they point
+	// to, which may be outside the moved tree, unless they lead to
+	// skipped files
+	for _, link := range t.links {
+		if !t.kept[link] {
+			remove(link, false)
+		}
+	}
+	// remove the emptied source directories
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		if t.dirs[i].followed == "" {
+			remove(t.dirs[i].rel, true)
+		}
+	}
+	remove(".", true)
+
+	return errs
+}
+
+// renameTree renames the source directory to the destination when it's
+// missing, it reports false when the tree has to be copied instead
+func (l *LocalStorage) renameTree(srcFullPath string, destFullPath string) (bool, error) {
+	if _, err := os.Lstat(destFullPath); err == nil {
+		// merge into the existing destination
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(destFullPath), 0755); err != nil {
+		return false, err
+	}
+	err := rename(srcFullPath, destFullPath)
+	if errors.Is(err, syscall.EXDEV) {
+		// the destination is on another device
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// scan walks the source tree applying the symlink policy
+func (l *LocalStorage) scan(ctx context.Context, op string, srcRel string, root fs.FileInfo, symlinks SymlinkPolicy) (*tree, error) {
+	t := &tree{kept: map[string]bool{}}
+	err := l.scanDir(ctx, op, srcRel, ".", "", []fs.FileInfo{root}, symlinks, t)
+
+	return t, err
+}
+
+// scanDir scans the directory rel, followed is the followed symlink
+// the directory was reached through, ancestors are the directories
+// leading to it used to detect the cycles of the followed symlinks
+func (l *LocalStorage) scanDir(ctx context.Context, op string, srcRel string, rel string, followed string, ancestors []fs.FileInfo, symlinks SymlinkPolicy, t *tree) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fullPath, err := l.resolve(op, path.Join(srcRel, rel))
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(fullPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+		info := entry
+		entryFollowed := followed
+
+		if entry.Mode()&fs.ModeSymlink != 0 {
+			t.symlinks = true
+			switch symlinks {
+			case PreserveSymlinks:
+				target, err := os.Readlink(filepath.Join(fullPath, entry.Name()))
+				if err != nil {
+					return err
+				}
+				t.files = append(t.files, treeEntry{rel: entryRel, info: entry, link: target, followed: followed})
+				continue
+			case FollowSymlinks:
+				// resolving makes sure the symlink stays within the root
+				target, err := l.resolve(op, path.Join(srcRel, entryRel))
+				if err != nil {
+					continue
+				}
+				if info, err = os.Stat(target); err != nil {
+					continue
+				}
+				if info.IsDir() && formsCycle(info, ancestors) {
+					continue
+				}
+				if info.IsDir() && followed == "" {
+					entryFollowed = entryRel
+					t.links = append(t.links, entryRel)
+				}
+			default:
+				continue
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			t.dirs = append(t.dirs, treeEntry{rel: entryRel, info: info, followed: entryFollowed})
+			if err := l.scanDir(ctx, op, srcRel, entryRel, entryFollowed, append(ancestors, info), symlinks, t); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			t.files = append(t.files, treeEntry{rel: entryRel, info: info, followed: followed})
+			t.bytes += info.Size()
+		}
+	}
+
+	return nil
+}
+
+// formsCycle reports whether the directory is one of its ancestors
+func formsCycle(dir fs.FileInfo, ancestors []fs.FileInfo) bool {
+	for _, ancestor := range ancestors {
+		if os.SameFile(dir, ancestor) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyFiles copies the files of the tree on a pool of workers,
+// the first failure stops the remaining copies
+func (l *LocalStorage) copyFiles(ctx context.Context, op string, srcRel string, destRel string, t *tree, opts DirectoryOpts) (DirectoryResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	result := DirectoryResult{}
+	progress := Progress{FilesTotal: len(t.files), BytesTotal: t.bytes}
+
+	jobs := make(chan treeEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				written, err := l.copyEntry(ctx, op, srcRel, destRel, entry, opts.Conflict)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+				result.add(written)
+				if written.Action == Skipped {
+					t.kept[entry.rel] = true
+					t.kept[entry.followed] = true
+				}
+				progress.Path = written.Path
+				progress.Action = written.Action
+				progress.FilesDone++
+				progress.BytesDone += entry.info.Size()
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, entry := range t.files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+
+	return result, firstErr
+}
+
+// copyEntry copies a file or a preserved symlink of the tree
+func (l *LocalStorage) copyEntry(ctx context.Context, op string, srcRel string, destRel string, entry treeEntry, policy ConflictPolicy) (WriteResult, error) {
+	srcPath := path.Join(srcRel, entry.rel)
+	destFilePath := path.Join(destRel, entry.rel)
+
+	if entry.link != "" {
+		return l.copySymlink(ctx, op, entry.link, destFilePath, policy, entry.info)
+	}
+
+	return l.copyFile(ctx, op, srcPath, destFilePath, policy, entry.info)
+}
+
+// copyFile copies the file preserving its mode and modification time
+func (l *LocalStorage) copyFile(ctx context.Context, op string, srcPath string, destFilePath string, policy ConflictPolicy, info fs.FileInfo) (WriteResult, error) {
+	srcFullPath, err := l.resolve(op, srcPath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	srcFile, err := os.Open(srcFullPath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	defer srcFile.Close()
+
+	result, err := l.writeWith(ctx, destFilePath, srcFile, policy, info.ModTime())
+	if err != nil || result.Action == Skipped {
+		return result, err
+	}
+
+	fullPath, err := l.resolve(op, result.Path)
+	if err != nil {
+		return result, err
+	}
+
+	return result, applyInfo(fullPath, info)
+}
+
+// copySymlink recreates the symlink applying the conflict policy
+func (l *LocalStorage) copySymlink(ctx context.Context, op string, target string, destFilePath string, policy ConflictPolicy, info fs.FileInfo) (WriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return WriteResult{}, err
+	}
+	// the symlink itself is checked rather than what it points to
+	fullPath, err := l.resolve(op, path.Dir(destFilePath))
+	if err != nil {
+		return WriteResult{}, err
+	}
+	fullPath = filepath.Join(fullPath, path.Base(destFilePath))
+
+	result := WriteResult{Action: Created, Path: destFilePath}
+	for i := 0; i < maxSuffix; i++ {
+		candidate := fullPath
+		if i > 0 {
+			candidate = withSuffix(fullPath, i)
+		}
+		existing, err := os.Lstat(candidate)
+		if err == nil {
+			switch {
+			case policy == Skip || (policy == KeepNewer && !info.ModTime().After(existing.ModTime())):
+				return WriteResult{Action: Skipped, Path: destFilePath}, nil
+			case policy == RenameWithSuffix:
+				continue
+			case (policy == Overwrite || policy == KeepNewer) && !existing.IsDir():
+				if err := os.Remove(candidate); err != nil {
+					return result, err
+				}
+				result.Action = Overwritten
+			case existing.IsDir():
+				return result, ErrIsDirectory
+			default:
+				return result, ErrAlreadyExists
+			}
+		}
+		if candidate != fullPath {
+			result.Action = Renamed
+			result.Path = path.Join(path.Dir(destFilePath), filepath.Base(candidate))
+		}
+		return result, os.Symlink(target, candidate)
+	}
+
+	return result, ErrAlreadyExists
+}
+
+// applyInfo sets the mode and the modification time of the entry
+func applyInfo(fullPath string, info fs.FileInfo) error {
+	if err := os.Chmod(fullPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(fullPath, info.ModTime(), info.ModTime())
+}
+
+// add counts the outcome of a file
+func (r *DirectoryResult) add(written WriteResult) {
+	r.Files++
+	r.Bytes += written.Size
+	switch written.Action {
+	case Created:
+		r.Created++
+	case Overwritten:
+		r.Overwritten++
+	case Skipped:
+		r.Skipped++
+	case Renamed:
+		r.Renamed++
+	}
+}
+
+// renamed reports a tree renamed into place at once
+func (t *tree) renamed(destRel string, report func(Progress)) DirectoryResult {
+	result := DirectoryResult{Files: len(t.files), Bytes: t.bytes, Created: len(t.files)}
+	if report != nil {
+		report(Progress{
+			Path:       destRel,
+			Action:     Created,
+			FilesDone:  len(t.files),
+			FilesTotal: len(t.files),
+			BytesDone:  t.bytes,
+			BytesTotal: t.bytes,
+		})
+	}
+
+	return result
+}
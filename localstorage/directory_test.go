@@ -0,0 +1,333 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+// newTree creates a small tree under src with custom modes and times
+func newTree(t *testing.T, l *LocalStorage, root string) time.Time {
+	t.Helper()
+	l.Create("src/a.txt", []byte("aaa"))
+	l.Create("src/sub/b.txt", []byte("bb"))
+	l.Create("src/sub/deep/c.txt", []byte("c"))
+	l.MakeDirectory("src/empty", 0755)
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chmod(filepath.Join(root, "src/a.txt"), 0600)
+	os.Chmod(filepath.Join(root, "src/sub"), 0750)
+	for _, p := range []string{"src/a.txt", "src/sub/b.txt", "src/sub/deep/c.txt", "src/sub/deep", "src/sub", "src/empty"} {
+		os.Chtimes(filepath.Join(root, p), mtime, mtime)
+	}
+
+	return mtime
+}
+
+func TestCopyDirectory(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	mtime := newTree(t, l, root)
+
+	var mu sync.Mutex
+	reports := []Progress{}
+	result, err := l.CopyDirectory("src", "dest", DirectoryOpts{
+		Workers: 2,
+		Progress: func(p Progress) {
+			mu.Lock()
+			reports = append(reports, p)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal("failed asserting copy directory. ", err)
+	}
+	if result.Files != 3 || result.Created != 3 || result.Bytes != 6 {
+		t.Errorf("failed asserting the result: %+v", result)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("failed asserting the progress reports: %+v", reports)
+	}
+	last := reports[len(reports)-1]
+	if last.FilesDone != 3 || last.FilesTotal != 3 || last.BytesDone != 6 || last.BytesTotal != 6 {
+		t.Errorf("failed asserting the last progress report: %+v", last)
+	}
+
+	content, err := l.Read("dest/sub/deep/c.txt")
+	if err != nil || string(content) != "c" {
+		t.Error("failed asserting the copied content. ", err)
+	}
+	if ok, _ := l.Exists("src/sub/b.txt"); !ok {
+		t.Error("failed asserting the source is kept")
+	}
+	if s, err := os.Stat(filepath.Join(root, "dest/empty")); err != nil || !s.IsDir() {
+		t.Error("failed asserting the empty directory is copied. ", err)
+	}
+	if s, _ := os.Stat(filepath.Join(root, "dest/a.txt")); s.Mode().Perm() != 0600 || !s.ModTime().Equal(mtime) {
+		t.Errorf("failed asserting the file mode and time: %v %v", s.Mode(), s.ModTime())
+	}
+	if s, _ := os.Stat(filepath.Join(root, "dest/sub")); s.Mode().Perm() != 0750 || !s.ModTime().Equal(mtime) {
+		t.Errorf("failed asserting the directory mode and time: %v %v", s.Mode(), s.ModTime())
+	}
+}
+
+func TestCopyDirectoryConflicts(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+	l.Create("dest/a.txt", []byte("existing"))
+
+	if _, err := l.CopyDirectory("src", "dest", DirectoryOpts{}); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting the default fail policy. ", err)
+	}
+	if ok, _ := l.Exists("dest/sub"); ok {
+		t.Error("failed asserting the fail policy copies nothing")
+	}
+
+	result, err := l.CopyDirectory("src", "dest", DirectoryOpts{Conflict: Skip})
+	if err != nil || result.Skipped != 1 || result.Created != 2 {
+		t.Errorf("failed asserting the skip policy: %+v %v", result, err)
+	}
+	if content, _ := l.Read("dest/a.txt"); string(content) != "existing" {
+		t.Error("failed asserting the skipped file is kept")
+	}
+
+	result, err = l.CopyDirectory("src", "dest", DirectoryOpts{Conflict: RenameWithSuffix})
+	if err != nil || result.Renamed != 3 {
+		t.Errorf("failed asserting the rename policy: %+v %v", result, err)
+	}
+	if content, _ := l.Read("dest/a (1).txt"); string(content) != "aaa" {
+		t.Error("failed asserting the renamed file")
+	}
+
+	result, err = l.CopyDirectory("src", "dest", DirectoryOpts{Conflict: Overwrite})
+	if err != nil || result.Overwritten != 3 {
+		t.Errorf("failed asserting the overwrite policy: %+v %v", result, err)
+	}
+	if content, _ := l.Read("dest/a.txt"); string(content) != "aaa" {
+		t.Error("failed asserting the overwritten file")
+	}
+}
+
+func TestCopyDirectoryErrors(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+
+	tests := []struct {
+		src  string
+		dest string
+		err  error
+	}{
+		{"missing", "dest", ErrNotFound},
+		{"src/a.txt", "dest", syscall.ENOTDIR},
+		{"src", "src/sub/inner", syscall.EINVAL},
+		{"src", "src", syscall.EINVAL},
+		{"../outside", "dest", ErrOutsideRoot},
+	}
+	for _, tt := range tests {
+		_, err := l.CopyDirectory(tt.src, tt.dest, DirectoryOpts{})
+		var pathErr *PathError
+		if !errors.Is(err, tt.err) || !errors.As(err, &pathErr) {
+			t.Errorf("failed asserting the error of copying %s to %s: %v", tt.src, tt.dest, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.CopyDirectoryCtx(ctx, "src", "dest", DirectoryOpts{}); !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting a canceled copy. ", err)
+	}
+}
+
+func TestCopyDirectorySymlinks(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+	outside := t.TempDir()
+	os.Symlink("a.txt", filepath.Join(root, "src/link.txt"))
+	os.Symlink("..", filepath.Join(root, "src/sub/loop"))
+	os.Symlink(outside, filepath.Join(root, "src/outside"))
+
+	if _, err := l.CopyDirectory("src", "skipped", DirectoryOpts{}); err != nil {
+		t.Fatal("failed asserting copy skipping symlinks. ", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "skipped/link.txt")); !os.IsNotExist(err) {
+		t.Error("failed asserting the symlink is skipped")
+	}
+
+	if _, err := l.CopyDirectory("src", "followed", DirectoryOpts{Symlinks: FollowSymlinks}); err != nil {
+		t.Fatal("failed asserting copy following symlinks. ", err)
+	}
+	if s, err := os.Lstat(filepath.Join(root, "followed/link.txt")); err != nil || !s.Mode().IsRegular() {
+		t.Error("failed asserting the followed symlink is copied as a file. ", err)
+	}
+	for _, p := range []string{"followed/sub/loop", "followed/outside"} {
+		if _, err := os.Lstat(filepath.Join(root, p)); !os.IsNotExist(err) {
+			t.Errorf("failed asserting %s is left out", p)
+		}
+	}
+
+	if _, err := l.CopyDirectory("src", "preserved", DirectoryOpts{Symlinks: PreserveSymlinks}); err != nil {
+		t.Fatal("failed asserting copy preserving symlinks. ", err)
+	}
+	if target, err := os.Readlink(filepath.Join(root, "preserved/link.txt")); err != nil || target != "a.txt" {
+		t.Error("failed asserting the preserved symlink. ", err)
+	}
+}
+
+func TestMoveDirectory(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+
+	result, err := l.MoveDirectory("src", "archive/moved", DirectoryOpts{})
+	if err != nil || result.Files != 3 || result.Bytes != 6 {
+		t.Fatalf("failed asserting move directory: %+v %v", result, err)
+	}
+	if ok, _ := l.Exists("archive/moved/sub/deep/c.txt"); !ok {
+		t.Error("failed asserting the moved tree")
+	}
+	if _, err := os.Stat(filepath.Join(root, "src")); !os.IsNotExist(err) {
+		t.Error("failed asserting the source is removed")
+	}
+}
+
+func TestMoveDirectoryAcrossDevices(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	mtime := newTree(t, l, root)
+	restore := SetRename(func(oldpath string, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	})
+	defer restore()
+
+	result, err := l.MoveDirectory("src", "moved", DirectoryOpts{})
+	if err != nil || result.Created != 3 {
+		t.Fatalf("failed asserting move across devices: %+v %v", result, err)
+	}
+	if s, err := os.Stat(filepath.Join(root, "moved/a.txt")); err != nil || s.Mode().Perm() != 0600 || !s.ModTime().Equal(mtime) {
+		t.Error("failed asserting the moved file keeps its mode and time. ", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "src")); !os.IsNotExist(err) {
+		t.Error("failed asserting the source is removed")
+	}
+}
+
+func TestMoveDirectoryMerge(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+	l.Create("dest/a.txt", []byte("existing"))
+
+	result, err := l.MoveDirectory("src", "dest", DirectoryOpts{Conflict: Skip})
+	if err != nil || result.Skipped != 1 || result.Created != 2 {
+		t.Fatalf("failed asserting the merge: %+v %v", result, err)
+	}
+	if ok, _ := l.Exists("src/a.txt"); !ok {
+		t.Error("failed asserting the skipped file stays in the source")
+	}
+	if ok, _ := l.Exists("src/sub/b.txt"); ok {
+		t.Error("failed asserting the moved file is removed from the source")
+	}
+	if _, err := os.Stat(filepath.Join(root, "src/sub")); !os.IsNotExist(err) {
+		t.Error("failed asserting the emptied directory is removed")
+	}
+}
+
+func TestMoveDirectoryRemoveErrors(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+	l.MakeDirectory("dest", 0755)
+
+	// a source file replaced after it's copied can't be removed
+	result, err := l.MoveDirectory("src", "dest", DirectoryOpts{Progress: func(p Progress) {
+		if p.Path == "dest/sub/b.txt" {
+			os.Remove(filepath.Join(root, "src/sub/b.txt"))
+			l.Create("src/sub/b.txt/new.txt", []byte("new"))
+		}
+	}})
+	var errs RemoveErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !strings.Contains(errs[0].Error(), "src/sub/b.txt") {
+		t.Fatalf("failed asserting the remove errors: %v", err)
+	}
+	if result.Created != 3 {
+		t.Errorf("failed asserting the copied files are reported: %+v", result)
+	}
+	if ok, _ := l.Exists("src/a.txt"); ok {
+		t.Error("failed asserting the other moved files are removed")
+	}
+	if ok, _ := l.Exists("src/sub/b.txt/new.txt"); !ok {
+		t.Error("failed asserting the entry that couldn't be removed stays")
+	}
+}
+
+func TestRemoveErrorsMatch(t *testing.T) {
+	var err error = RemoveErrors{
+		fmt.Errorf("remove src/a.txt: %w", fs.ErrPermission),
+		&PathError{Op: "remove", Disk: "local", Path: "src/b.txt", Err: fs.ErrExist},
+	}
+	if !errors.Is(err, fs.ErrPermission) || !errors.Is(err, ErrAlreadyExists) || errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting the errors of the entries match. ", err)
+	}
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "src/b.txt" {
+		t.Error("failed asserting the path error of an entry. ", err)
+	}
+}
+
+func TestMoveDirectorySymlinks(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	newTree(t, l, root)
+	l.Create("shared/s.txt", []byte("shared"))
+	l.Create("shared/inner/i.txt", []byte("inner"))
+	os.Symlink("../shared", filepath.Join(root, "src/shared"))
+	os.Symlink("a.txt", filepath.Join(root, "src/link.txt"))
+
+	result, err := l.MoveDirectory("src", "moved", DirectoryOpts{Symlinks: FollowSymlinks})
+	if err != nil || result.Files != 6 {
+		t.Fatalf("failed asserting move following symlinks: %+v %v", result, err)
+	}
+	for _, p := range []string{"shared/s.txt", "shared/inner/i.txt"} {
+		if ok, _ := l.Exists(p); !ok {
+			t.Errorf("failed asserting the target of the followed symlink %s survives the move", p)
+		}
+	}
+	for _, p := range []string{"moved/shared/s.txt", "moved/shared/inner/i.txt", "moved/link.txt"} {
+		if s, err := os.Lstat(filepath.Join(root, p)); err != nil || !s.Mode().IsRegular() {
+			t.Errorf("failed asserting %s is copied as a file. %v", p, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(root, "src")); !os.IsNotExist(err) {
+		t.Error("failed asserting the source and its symlinks are removed")
+	}
+
+	// renaming the tree would move the symlinks as they are
+	l.Create("src2/a.txt", []byte("a"))
+	os.Symlink("a.txt", filepath.Join(root, "src2/link.txt"))
+	if _, err := l.MoveDirectory("src2", "moved2", DirectoryOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "moved2/link.txt")); !os.IsNotExist(err) {
+		t.Error("failed asserting the skipped symlink isn't moved")
+	}
+	if _, err := os.Lstat(filepath.Join(root, "src2/link.txt")); err != nil {
+		t.Error("failed asserting the skipped symlink stays in the source")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+)
+
+// errors returned by the storage operations wrapped in a *PathError,
+// use errors.Is to match them, ErrNotFound and ErrAlreadyExists are
+// the same values as fs.ErrNotExist and fs.ErrExist
+var (
+	ErrNotFound      = fs.ErrNotExist
+	ErrAlreadyExists = fs.ErrExist
+	ErrNotRegular    = errors.New("file is not a regular file")
+	ErrIsDirectory   = errors.New("file is a directory")
+	ErrOutsideRoot   = errors.New("path is outside the root folder")
+)
+
+// PathError records an error and the operation, the disk
+// and the path that caused it
+type PathError struct {
+	Op   string
+	Disk string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Op + " " + e.Disk + ":" + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// pathError wraps the given error into a *PathError, the standard library
+// errors are mapped onto the package errors, context errors and errors
+// that are already wrapped are returned as they are
+func (l *LocalStorage) pathError(op string, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		err = ErrAlreadyExists
+	default:
+		// drop the os path, it's replaced with the path within the disk
+		var fsErr *fs.PathError
+		if errors.As(err, &fsErr) {
+			err = fsErr.Err
+		}
+	}
+
+	return &PathError{Op: op, Disk: l.name, Path: filePath, Err: err}
+}
+
+// checkRegular makes sure the given file is a regular file
+func checkRegular(s fs.FileInfo) error {
+	if s.IsDir() {
+		return ErrIsDirectory
+	}
+	if !s.Mode().IsRegular() {
+		return ErrNotRegular
+	}
+
+	return nil
+}
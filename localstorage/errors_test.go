@@ -0,0 +1,82 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+func TestErrors(t *testing.T) {
+	root := t.TempDir()
+	l := NewWithOpts(root, Opts{Name: "uploads"})
+	l.Create("file.md", []byte("this is a test file"))
+	l.MakeDirectory("dir", 0755)
+
+	cases := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{"fileinfo missing", second(l.FileInfo("missing.md")), ErrNotFound},
+		{"read missing", second(l.Read("missing.md")), ErrNotFound},
+		{"read directory", second(l.Read("dir")), ErrIsDirectory},
+		{"delete missing", l.Delete("missing.md"), ErrNotFound},
+		{"delete directory", l.Delete("dir"), ErrIsDirectory},
+		{"rename missing", l.Rename("missing.md", "new.md"), ErrNotFound},
+		{"append missing", l.Append("missing.md", []byte("x")), ErrNotFound},
+		{"create existing", l.Create("file.md", []byte("x")), ErrAlreadyExists},
+		{"create over directory", l.Create("dir", []byte("x")), ErrIsDirectory},
+		{"copy missing", l.Copy("missing.md", "dir"), ErrNotFound},
+		{"copy existing", l.CopyAs("file.md", "/", "file.md"), ErrAlreadyExists},
+		{"move existing", l.Move("file.md", "/"), ErrAlreadyExists},
+		{"put missing", l.Put(filepath.Join(root, "missing.md")), ErrNotFound},
+		{"put directory", l.Put(filepath.Join(root, "dir")), ErrIsDirectory},
+		{"files missing", second(l.Files("missingdir")), ErrNotFound},
+		{"all files missing", second(l.AllFiles("missingdir")), ErrNotFound},
+		{"directories missing", second(l.Directories("missingdir")), ErrNotFound},
+		{"read outside root", second(l.Read("../file.md")), ErrOutsideRoot},
+	}
+	for _, c := range cases {
+		if !errors.Is(c.err, c.target) {
+			t.Errorf("failed asserting %s error: %v", c.name, c.err)
+		}
+		var pathErr *PathError
+		if !errors.As(c.err, &pathErr) || pathErr.Disk != "uploads" {
+			t.Errorf("failed asserting %s error is a path error: %v", c.name, c.err)
+		}
+	}
+
+	// the standard library errors still match
+	_, err := l.Read("missing.md")
+	if !errors.Is(err, fs.ErrNotExist) || !errors.Is(err, os.ErrNotExist) {
+		t.Error("failed asserting not found error matches fs.ErrNotExist")
+	}
+}
+
+func TestPathError(t *testing.T) {
+	l := New(t.TempDir())
+
+	_, err := l.Read("sub/missing.md")
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatal("failed asserting path error: ", err)
+	}
+	if pathErr.Op != "read" || pathErr.Disk != "local" || pathErr.Path != "sub/missing.md" {
+		t.Error("failed asserting path error fields: ", pathErr)
+	}
+	if err.Error() != "read local:sub/missing.md: file does not exist" {
+		t.Error("failed asserting path error message: ", err)
+	}
+}
+
+func second(_ interface{}, err error) error {
+	return err
+}
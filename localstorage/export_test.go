@@ -0,0 +1,34 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SetRename replaces the function renaming the directories
+// and returns a function restoring it
+func SetRename(f func(oldpath string, newpath string) error) (restore func()) {
+	previous := rename
+	rename = f
+	return func() { rename = previous }
+}
+
+// SetNow replaces the function returning the current time
+// of the versions and returns a function restoring it
+func SetNow(f func() time.Time) (restore func()) {
+	previous := now
+	now = f
+	return func() { now = previous }
+}
+
+// OpenResolved opens the file at the given path joined to the root folder
+// without the check of resolve, like an operation whose path was swapped
+// for a symlink after it was resolved
+func (l *LocalStorage) OpenResolved(filePath string) (*os.File, error) {
+	return l.openFile(filepath.Join(l.rootFolder, filepath.FromSlash(filePath)), os.O_RDONLY, 0)
+}
@@ -5,6 +5,8 @@
 package localstorage
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"io/fs"
@@ -13,13 +15,57 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
+
+	"github.com/harranali/stowage/internal/ctxio"
 )
 
 // LocalStorage local storage
 type LocalStorage struct {
-	rootFolder string
+	rootFolder       string
+	name             string
+	syncDirectory    bool
+	listingChecksums []ChecksumAlgorithm
+	checksums        *checksumCache
+	contentTypes     map[string]string
+	baseURL          string
+	signingKeys      []SigningKey
+	versioning       VersioningOpts
+	trash            TrashOpts
+	trashMu          sync.Mutex
+	root             rootHandle
+}
+
+// Opts options for initiating local storage
+type Opts struct {
+	// Name identifies the disk in the returned errors,
+	// it defaults to "local"
+	Name string
+	// SyncDirectory syncs the parent directory after a file is
+	// moved into place, so the new file survives a crash of the
+	// system at the cost of slower writes
+	SyncDirectory bool
+	// Checksums are computed with the given algorithms and filled in
+	// FileInfo.Checksums by FileInfo, Files and AllFiles, every listed
+	// file is read unless its checksums are cached
+	Checksums []ChecksumAlgorithm
+	// ContentTypes maps extensions without the dot to content types,
+	// they take precedence over the built-in table
+	ContentTypes map[string]string
+	// BaseURL is the url the files are served under, it's
+	// the base of the signed urls, for example "/files"
+	BaseURL string
+	// SigningKeys sign the urls, the first key signs
+	// the new urls while all of them verify the urls
+	SigningKeys []SigningKey
+	// Versioning keeps the prior content of the overwritten, deleted,
+	// moved and renamed files, it's enabled by setting its directory
+	Versioning VersioningOpts
+	// Trash moves the deleted files and directories into the trash
+	// so they can be restored, it's enabled by setting its directory
+	Trash TrashOpts
 }
 
 // FileInfo provides file information
@@ -32,34 +78,71 @@ type FileInfo struct {
 	Path                 string
 	IsDirectory          bool
 	FsFileInfo           fs.FileInfo //golang's fs file info
+	// Checksums are the hex encoded checksums of the file content,
+	// they are filled only for the algorithms asked in the options
+	Checksums map[ChecksumAlgorithm]string
+	// ContentType is the MIME type of the file found by its extension
+	// or by sniffing its content, it's empty for directories
+	ContentType string
 }
 
-var local *LocalStorage
+// copyBufferSize is the size of the buffer used when streaming files content
+const copyBufferSize = 32 * 1024
 
 // New initiate local storage
 func New(path string) *LocalStorage {
-	local = &LocalStorage{
-		rootFolder: path,
+	return NewWithOpts(path, Opts{})
+}
+
+// NewWithOpts initiate local storage with the given options
+func NewWithOpts(path string, opts Opts) *LocalStorage {
+	if opts.Name == "" {
+		opts.Name = "local"
+	}
+	return &LocalStorage{
+		rootFolder:       path,
+		name:             opts.Name,
+		syncDirectory:    opts.SyncDirectory,
+		listingChecksums: opts.Checksums,
+		checksums:        &checksumCache{},
+		contentTypes:     opts.ContentTypes,
+		baseURL:          opts.BaseURL,
+		signingKeys:      opts.SigningKeys,
+		versioning:       opts.Versioning,
+		trash:            opts.Trash,
 	}
+}
 
-	return local
+// Name returns the name of the disk
+func (l *LocalStorage) Name() string {
+	return l.name
 }
 
-//FileInfo returns information about the given file or an error incase there is any
+// FileInfo returns information about the given file or an error incase there is any
 func (l *LocalStorage) FileInfo(filepath string) (fileinfo FileInfo, err error) {
-	fullpath := path.Join(l.rootFolder, filepath)
-	// make sure the file exists
-	if _, err := os.Stat(fullpath); os.IsNotExist(err) {
-		return FileInfo{}, errors.New("file does not exist")
-	} else if err != nil {
+	return l.FileInfoCtx(context.Background(), filepath)
+}
+
+// FileInfoCtx is the context aware variant of FileInfo
+func (l *LocalStorage) FileInfoCtx(ctx context.Context, filepath string) (fileinfo FileInfo, err error) {
+	if err := ctx.Err(); err != nil {
+		return FileInfo{}, err
+	}
+
+	fullpath, err := l.resolve("fileinfo", filepath)
+	if err != nil {
 		return FileInfo{}, err
 	}
 
+	// make sure the file exists
 	info, err := os.Stat(fullpath)
+	if err != nil {
+		return FileInfo{}, l.pathError("fileinfo", filepath, err)
+	}
 
 	fileinfo = FileInfo{
 		Name:                 info.Name(),
-		Extension:            removeFirstChar(path.Ext(fullpath)),
+		Extension:            Extension(fullpath),
 		NameWithoutExtension: removeExtension(info.Name(), path.Ext(fullpath)),
 		Size:                 info.Size(),
 		Path:                 path.Dir(fullpath),
@@ -67,6 +150,15 @@ func (l *LocalStorage) FileInfo(filepath string) (fileinfo FileInfo, err error)
 		IsDirectory:          info.IsDir(),
 		FsFileInfo:           info,
 	}
+	if !info.IsDir() {
+		fileinfo.ContentType = l.contentType(fullpath, info.Mode())
+	}
+	if len(l.listingChecksums) > 0 && info.Mode().IsRegular() {
+		fileinfo.Checksums, err = l.checksumsOf(ctx, fullpath, info)
+		if err != nil {
+			return FileInfo{}, l.pathError("fileinfo", filepath, err)
+		}
+	}
 
 	return fileinfo, nil
 }
@@ -75,50 +167,18 @@ func (l *LocalStorage) FileInfo(filepath string) (fileinfo FileInfo, err error)
 // from external locations, filePath is the full path to the file
 // you would like to put, it returns error incase there is any
 func (l *LocalStorage) Put(filePath string) error {
+	return l.PutCtx(context.Background(), filePath)
+}
+
+// PutCtx is the context aware variant of Put
+func (l *LocalStorage) PutCtx(ctx context.Context, filePath string) error {
 	// make sure the source file exists
 	s, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
-
-	// make sure there is no file with the same name in destFile
-	_, err = os.Stat(path.Join(l.rootFolder, s.Name()))
-	if err == nil {
-		return errors.New("the file is already exists")
-	}
-
-	// open the source file
-	srcFile, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return l.pathError("put", filePath, err)
 	}
-	defer srcFile.Close()
 
-	// create a file in destination with the same name of source fil
-	destFile, err := os.Create(path.Join(l.rootFolder, s.Name()))
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	// copy the file content
-	buf := make([]byte, 100)
-	for {
-		n, err := srcFile.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
-		}
-		if n == 0 {
-			break
-		}
-		if _, err := destFile.Write(buf[:n]); err != nil {
-			return err
-		}
-	}
-	return err
+	return l.PutAsCtx(ctx, filePath, s.Name())
 }
 
 // PutAs helps you copy files into the root directory
@@ -127,49 +187,13 @@ func (l *LocalStorage) Put(filePath string) error {
 // the second param 'fileName' is the name you would
 // like to give to the file, it returns error incase there is any
 func (l *LocalStorage) PutAs(filePath string, filename string) error {
-	// make sure the source file exists
-	s, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
-
-	// make sure there is no file with the same name in destFile
-	_, err = os.Stat(path.Join(l.rootFolder, filename))
-	if err == nil {
-		return errors.New("the file is already exists")
-	}
-
-	// open the source file
-	srcFile, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
+	return l.PutAsCtx(context.Background(), filePath, filename)
+}
 
-	// create a file in destination with the same name of source fil
-	destFile, err := os.Create(path.Join(l.rootFolder, filename))
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
+// PutAsCtx is the context aware variant of PutAs
+func (l *LocalStorage) PutAsCtx(ctx context.Context, filePath string, filename string) error {
+	_, err := l.PutAsWithCtx(ctx, filePath, filename, Fail)
 
-	// copy the file content
-	buf := make([]byte, 100)
-	for {
-		n, err := srcFile.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
-		}
-		if n == 0 {
-			break
-		}
-		if _, err := destFile.Write(buf[:n]); err != nil {
-			return err
-		}
-	}
 	return err
 }
 
@@ -180,53 +204,12 @@ func (l *LocalStorage) PutAs(filePath string, filename string) error {
 // and the destination folder starting from the root folder,
 // it returns an error incase there is any
 func (l *LocalStorage) Copy(filePath string, destPath string) error {
-	//unify slashes
-	filePath = filepath.ToSlash(filePath)
-	destPath = filepath.ToSlash(destPath)
-
-	// construct the full paths
-	srcFileFullPath := filepath.Join(l.rootFolder, filePath)
-	DestFullPath := filepath.Join(l.rootFolder, destPath)
-
-	// make sure the path of dest folder exists
-	os.MkdirAll(DestFullPath, 0755)
-
-	// make sure the source file exists
-	s, err := os.Stat(srcFileFullPath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
-
-	// make sure there is no file with the same name in dest folder
-	_, err = os.Stat(path.Join(DestFullPath, s.Name()))
-	if err == nil {
-		return errors.New("the file already exists in dest folder")
-	}
-
-	// open the source file
-	srcFile, err := os.Open(srcFileFullPath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	// create a file in destination with the same name of source fil
-	destFile, err := os.Create(path.Join(DestFullPath, s.Name()))
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	// copy the file content
-	_, err = io.Copy(destFile, srcFile)
-	if err != nil {
-		return err
-	}
+	return l.CopyCtx(context.Background(), filePath, destPath)
+}
 
-	return nil
+// CopyCtx is the context aware variant of Copy
+func (l *LocalStorage) CopyCtx(ctx context.Context, filePath string, destPath string) error {
+	return l.CopyAsCtx(ctx, filePath, destPath, path.Base(filepath.ToSlash(filePath)))
 }
 
 // CopyAs helps you copy files within the root folder,
@@ -236,60 +219,13 @@ func (l *LocalStorage) Copy(filePath string, destPath string) error {
 // starting from the root folder, and the new file name,
 // it returns an error incase there is any
 func (l *LocalStorage) CopyAs(filePath string, destfolder string, newFilePath string) error {
-	//unify slashes
-	filePath = filepath.ToSlash(filePath)
-	destfolder = filepath.ToSlash(destfolder)
-
-	// construct the full paths
-	srcFileFullPath := filepath.Join(l.rootFolder, filePath)
-	DestFileFullPath := filepath.Join(l.rootFolder, destfolder)
-
-	// make sure the path of dest folder exists
-	os.MkdirAll(DestFileFullPath, 0755)
-
-	// make sure the source file exists
-	s, err := os.Stat(srcFileFullPath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
-
-	// make sure there is no file with the same name in dest folder
-	_, err = os.Stat(path.Join(DestFileFullPath, newFilePath))
-	if err == nil {
-		return errors.New("the file is already exists")
-	}
-
-	// open the source file
-	srcFile, err := os.Open(srcFileFullPath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
+	return l.CopyAsCtx(context.Background(), filePath, destfolder, newFilePath)
+}
 
-	// create a file in destination with the same name of source fil
-	destFile, err := os.Create(path.Join(DestFileFullPath, newFilePath))
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
+// CopyAsCtx is the context aware variant of CopyAs
+func (l *LocalStorage) CopyAsCtx(ctx context.Context, filePath string, destfolder string, newFilePath string) error {
+	_, err := l.CopyAsWithCtx(ctx, filePath, destfolder, newFilePath, Fail)
 
-	// copy the file content
-	buf := make([]byte, 100)
-	for {
-		n, err := srcFile.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
-		}
-		if n == 0 {
-			break
-		}
-		if _, err := destFile.Write(buf[:n]); err != nil {
-			return err
-		}
-	}
 	return err
 }
 
@@ -300,65 +236,12 @@ func (l *LocalStorage) CopyAs(filePath string, destfolder string, newFilePath st
 // folder starting from the root folder,
 // it returns an error incase there any
 func (l *LocalStorage) Move(filePath string, destFolder string) error {
-	//unify slashes
-	filePath = filepath.ToSlash(filePath)
-	destFolder = filepath.ToSlash(destFolder)
-
-	// construct the full paths
-	srcFileFullPath := filepath.Join(l.rootFolder, filePath)
-	DestFileFullPath := filepath.Join(l.rootFolder, destFolder)
-
-	// make sure the path of dest folder exists
-	os.MkdirAll(DestFileFullPath, 0755)
-
-	// make sure the source file exists
-	s, err := os.Stat(srcFileFullPath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
-
-	// make sure there is no file with the same name in dest folder
-	_, err = os.Stat(path.Join(DestFileFullPath, s.Name()))
-	if err == nil {
-		return errors.New("the file is already exists")
-	}
-
-	// open the source file
-	srcFile, err := os.Open(srcFileFullPath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	// create a file in destination with the same name of source fil
-	destFile, err := os.Create(path.Join(DestFileFullPath, s.Name()))
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	// copy the file content
-	buf := make([]byte, 100)
-	for {
-		n, err := srcFile.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
-		}
-		if n == 0 {
-			break
-		}
-		if _, err := destFile.Write(buf[:n]); err != nil {
-			return err
-		}
-	}
+	return l.MoveCtx(context.Background(), filePath, destFolder)
+}
 
-	// remove the source file
-	srcFile.Close()
-	os.Remove(srcFileFullPath)
-	return err
+// MoveCtx is the context aware variant of Move
+func (l *LocalStorage) MoveCtx(ctx context.Context, filePath string, destFolder string) error {
+	return l.MoveAsCtx(ctx, filePath, destFolder, path.Base(filepath.ToSlash(filePath)))
 }
 
 // MoveAs helps you Move files within the root folder,
@@ -368,187 +251,209 @@ func (l *LocalStorage) Move(filePath string, destFolder string) error {
 // folder starting from the root folder,
 // and the new file name, it returns an error incase there any
 func (l *LocalStorage) MoveAs(filePath string, destFolder string, newFilePath string) error {
-	//unify slashes
-	filePath = filepath.ToSlash(filePath)
-	destFolder = filepath.ToSlash(destFolder)
-
-	// construct the full paths
-	srcFileFullPath := filepath.Join(l.rootFolder, filePath)
-	DestFileFullPath := filepath.Join(l.rootFolder, destFolder)
-
-	// make sure the path of dest folder exists
-	os.MkdirAll(DestFileFullPath, 0755)
-
-	// make sure the source file exists
-	s, err := os.Stat(srcFileFullPath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
-
-	// make sure there is no file with the same name in dest folder
-	_, err = os.Stat(path.Join(DestFileFullPath, newFilePath))
-	if !os.IsNotExist(err) {
-		return errors.New("the file is already exists")
-	}
-
-	// open the source file
-	srcFile, err := os.Open(srcFileFullPath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
+	return l.MoveAsCtx(context.Background(), filePath, destFolder, newFilePath)
+}
 
-	// create a file in destination with the same name of source fil
-	destFile, err := os.Create(path.Join(DestFileFullPath, newFilePath))
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
+// MoveAsCtx is the context aware variant of MoveAs
+func (l *LocalStorage) MoveAsCtx(ctx context.Context, filePath string, destFolder string, newFilePath string) error {
+	_, err := l.MoveAsWithCtx(ctx, filePath, destFolder, newFilePath, Fail)
 
-	// copy the file content
-	buf := make([]byte, 100)
-	for {
-		n, err := srcFile.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
-		}
-		if n == 0 {
-			break
-		}
-		if _, err := destFile.Write(buf[:n]); err != nil {
-			return err
-		}
-	}
-
-	// remove the source file
-	srcFile.Close()
-	os.Remove(srcFileFullPath)
 	return err
 }
 
 // Rename renames the given file as first parameter to the name
-// given as a second parameter,
+// given as a second parameter, an existing file with the new name
+// is replaced, use RenameWith for the other conflict policies,
 // it returns error incase there is any
 func (l *LocalStorage) Rename(filePath string, newFilePath string) error {
-	srcFileFullPath := filepath.Join(l.rootFolder, filePath)
-	destFileFullPath := filepath.Join(l.rootFolder, newFilePath)
-
-	// make sure the source file exists
-	s, err := os.Stat(srcFileFullPath)
-	if os.IsNotExist(err) {
-		return err
-	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
-	}
+	return l.RenameCtx(context.Background(), filePath, newFilePath)
+}
 
-	err = os.Rename(srcFileFullPath, destFileFullPath)
+// RenameCtx is the context aware variant of Rename
+func (l *LocalStorage) RenameCtx(ctx context.Context, filePath string, newFilePath string) error {
+	_, err := l.RenameWithCtx(ctx, filePath, newFilePath, Overwrite)
 
 	return err
 }
 
 // Delete deletes the given file it returns error incase there is any
 func (l *LocalStorage) Delete(filePath string) error {
-	srcFileFullPath := filepath.Join(l.rootFolder, filePath)
+	return l.DeleteCtx(context.Background(), filePath)
+}
+
+// DeleteCtx is the context aware variant of Delete
+func (l *LocalStorage) DeleteCtx(ctx context.Context, filePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	srcFileFullPath, err := l.resolve("delete", filePath)
+	if err != nil {
+		return err
+	}
 
 	// make sure the source file exists
 	s, err := os.Stat(srcFileFullPath)
-	if os.IsNotExist(err) {
-		return err
+	if err != nil {
+		return l.pathError("delete", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return l.pathError("delete", filePath, err)
+	}
+	if l.trash.Dir != "" {
+		return l.pathError("delete", filePath, l.moveToTrash(filePath, srcFileFullPath, s))
 	}
-	if !s.Mode().IsRegular() {
-		return errors.New("File is not in regular mode")
+	if err := l.keepVersion(filePath, srcFileFullPath, false); err != nil {
+		return l.pathError("delete", filePath, err)
 	}
 
-	os.Remove(srcFileFullPath)
+	err = l.remove(srcFileFullPath)
 
-	return err
+	return l.pathError("delete", filePath, err)
 }
 
 // DeleteMultiple deltes multiple files given as slice of strings
 // of file paths, it returns error incase there is any
 func (l *LocalStorage) DeleteMultiple(filePaths []string) (err error) {
+	return l.DeleteMultipleCtx(context.Background(), filePaths)
+}
+
+// DeleteMultipleCtx is the context aware variant of DeleteMultiple,
+// it stops before deleting the next file once the context is done,
+// the missing files and the directories are skipped, it stops at
+// the first file that fails to be deleted
+func (l *LocalStorage) DeleteMultipleCtx(ctx context.Context, filePaths []string) (err error) {
 	for _, file := range filePaths {
-		srcFileFullPath := filepath.Join(l.rootFolder, file)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		srcFileFullPath, err := l.resolve("delete", file)
+		if err != nil {
+			return err
+		}
 
 		// make sure the source file exists
 		s, err := os.Stat(srcFileFullPath)
 		if os.IsNotExist(err) {
 			continue
 		}
-		if !s.Mode().IsRegular() {
+		if err != nil {
+			return l.pathError("delete", file, err)
+		}
+		if checkRegular(s) != nil {
+			continue
+		}
+		if l.trash.Dir != "" {
+			if err := l.moveToTrash(file, srcFileFullPath, s); err != nil {
+				return l.pathError("delete", file, err)
+			}
 			continue
 		}
+		if err := l.keepVersion(file, srcFileFullPath, false); err != nil {
+			return l.pathError("delete", file, err)
+		}
 
-		os.Remove(srcFileFullPath)
+		if err := l.remove(srcFileFullPath); err != nil && !os.IsNotExist(err) {
+			return l.pathError("delete", file, err)
+		}
 	}
 
-	return err
+	return nil
 }
 
 // Create helps you create new a file and add content to it,
 // it returns error incase there is any
 func (l *LocalStorage) Create(filePath string, content []byte) error {
-	// make sure the path of dest folder exists
-	fileFullPath := path.Join(l.rootFolder, filePath)
-	fileFullPath = filepath.ToSlash(fileFullPath)
-	os.MkdirAll(path.Dir(fileFullPath), 0755)
-
-	// check if the file exists
-	_, err := os.Stat(fileFullPath)
-	if err == nil {
-		return errors.New("file already exists")
-	}
+	return l.CreateCtx(context.Background(), filePath, content)
+}
 
-	// create the file
-	file, err := os.Create(fileFullPath)
-	if err != nil {
-		return err
-	}
-	// add the content
-	_, err = file.Write(content)
-	file.Close()
+// CreateCtx is the context aware variant of Create
+func (l *LocalStorage) CreateCtx(ctx context.Context, filePath string, content []byte) error {
+	_, err := l.WriteStreamCtx(ctx, filePath, bytes.NewReader(content))
 
 	return err
 }
 
+// WriteStream creates a new file and streams into it the content
+// read from the given reader until EOF, the content is copied
+// through a bounded buffer so large files are never held in memory,
+// it's written to a temp file which is moved into place once complete
+// so a failed write never leaves a partial file behind, it returns
+// the number of bytes written and an error incase there is any
+func (l *LocalStorage) WriteStream(filePath string, r io.Reader) (int64, error) {
+	return l.WriteStreamCtx(context.Background(), filePath, r)
+}
+
+// WriteStreamCtx is the context aware variant of WriteStream,
+// if the context is done while streaming nothing is written
+func (l *LocalStorage) WriteStreamCtx(ctx context.Context, filePath string, r io.Reader) (int64, error) {
+	result, err := l.WriteStreamWithCtx(ctx, filePath, r, Fail)
+
+	return result.Size, err
+}
+
 // Append helps you append content to a file,
 // it returns error incase there is any
 func (l *LocalStorage) Append(filePath string, content []byte) error {
-	fileFullPath := path.Join(l.rootFolder, filePath)
+	return l.AppendCtx(context.Background(), filePath, content)
+}
 
-	// check if the file exists
-	_, err := os.Stat(fileFullPath)
-	if os.IsNotExist(err) {
+// AppendCtx is the context aware variant of Append
+func (l *LocalStorage) AppendCtx(ctx context.Context, filePath string, content []byte) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	// create the file
-	file, err := os.OpenFile(fileFullPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	fileFullPath, err := l.resolve("append", filePath)
 	if err != nil {
 		return err
 	}
+
+	// check if the file exists
+	s, err := os.Stat(fileFullPath)
+	if err != nil {
+		return l.pathError("append", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return l.pathError("append", filePath, err)
+	}
+
+	// open the file
+	file, err := l.openFile(fileFullPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return l.pathError("append", filePath, err)
+	}
 	defer file.Close()
 
 	// add the content
 	_, err = file.Write(content)
 
-	return err
+	return l.pathError("append", filePath, err)
 }
 
 // Exists checks if a file exists withn the root folder,
 // it returns a bool and an error incase any
 func (l *LocalStorage) Exists(filePath string) (bool, error) {
-	fileFullPath := path.Join(l.rootFolder, filePath)
+	return l.ExistsCtx(context.Background(), filePath)
+}
 
-	_, err := os.Stat(fileFullPath)
+// ExistsCtx is the context aware variant of Exists
+func (l *LocalStorage) ExistsCtx(ctx context.Context, filePath string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	fileFullPath, err := l.resolve("exists", filePath)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(fileFullPath)
 	if os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
-		return false, err
+		return false, l.pathError("exists", filePath, err)
 	}
 
 	return true, nil
@@ -557,9 +462,21 @@ func (l *LocalStorage) Exists(filePath string) (bool, error) {
 // Missing checks if a file is missing in the root folder,
 // it returns a bool and an error incase any
 func (l *LocalStorage) Missing(filePath string) (bool, error) {
-	fileFullPath := path.Join(l.rootFolder, filePath)
+	return l.MissingCtx(context.Background(), filePath)
+}
+
+// MissingCtx is the context aware variant of Missing
+func (l *LocalStorage) MissingCtx(ctx context.Context, filePath string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	fileFullPath, err := l.resolve("missing", filePath)
+	if err != nil {
+		return false, err
+	}
 
-	_, err := os.Stat(fileFullPath)
+	_, err = os.Stat(fileFullPath)
 	if err != nil {
 		// there is an error
 		if os.IsNotExist(err) {
@@ -567,7 +484,7 @@ func (l *LocalStorage) Missing(filePath string) (bool, error) {
 			return true, nil
 		}
 		// another errors
-		return false, err
+		return false, l.pathError("missing", filePath, err)
 	}
 
 	return false, nil
@@ -575,51 +492,155 @@ func (l *LocalStorage) Missing(filePath string) (bool, error) {
 
 // Read helps you grap the content of a file,
 // it returns the data in a slice of bytes and an error
-// incase there is any
+// incase there is any, for large files consider using
+// the method `ReadStream(filePath string)`
 func (l *LocalStorage) Read(filePath string) ([]byte, error) {
-	fileFullPath := path.Join(l.rootFolder, filePath)
+	return l.ReadCtx(context.Background(), filePath)
+}
 
-	_, err := os.Stat(fileFullPath)
-	if os.IsNotExist(err) {
-		// not exist error
+// ReadCtx is the context aware variant of Read
+func (l *LocalStorage) ReadCtx(ctx context.Context, filePath string) ([]byte, error) {
+	file, err := l.ReadStreamCtx(ctx, filePath)
+	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	content, err := ioutil.ReadFile(fileFullPath)
+	content, err := ioutil.ReadAll(file)
 	if err != nil {
-		return nil, err
+		return nil, l.pathError("read", filePath, err)
 	}
 
 	return content, nil
 }
 
+// ReadStream opens the given file for reading and returns
+// an io.ReadCloser streaming its content, the caller is
+// responsible for closing it, it returns an error incase there is any
+func (l *LocalStorage) ReadStream(filePath string) (io.ReadCloser, error) {
+	return l.ReadStreamCtx(context.Background(), filePath)
+}
+
+// ReadStreamCtx is the context aware variant of ReadStream,
+// reading from the returned stream fails with the context
+// error once the context is done
+func (l *LocalStorage) ReadStreamCtx(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fileFullPath, err := l.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the source file exists
+	s, err := os.Stat(fileFullPath)
+	if err != nil {
+		return nil, l.pathError("read", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return nil, l.pathError("read", filePath, err)
+	}
+
+	file, err := l.openFile(fileFullPath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, l.pathError("read", filePath, err)
+	}
+
+	// a context that is never done needs no checks, the file
+	// is returned as it is so callers can seek it
+	if ctx.Done() == nil {
+		return file, nil
+	}
+
+	return &ctxReadCloser{ctx: ctx, ReadCloser: file}, nil
+}
+
+// ReadRange returns a reader of length bytes of the given file starting at
+// offset, a negative length reads up to the end of the file, a range past
+// the end of the file is cut at the end, the caller must close it,
+// it returns an error incase there is any
+func (l *LocalStorage) ReadRange(filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	return l.ReadRangeCtx(context.Background(), filePath, offset, length)
+}
+
+// ReadRangeCtx is the context aware variant of ReadRange
+func (l *LocalStorage) ReadRangeCtx(ctx context.Context, filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, l.pathError("read", filePath, fs.ErrInvalid)
+	}
+
+	// the file is opened without the context so it can seek
+	r, err := l.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	file := r.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, l.pathError("read", filePath, err)
+	}
+
+	var rc io.ReadCloser = file
+	if length >= 0 {
+		rc = &limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}
+	}
+	if ctx.Done() == nil {
+		return rc, nil
+	}
+
+	return &ctxReadCloser{ctx: ctx, ReadCloser: rc}, nil
+}
+
 // Files returns a list of files in a given directory,
 // the file type is LocalStorage.FileInfo
-//  NOT the standard library fs.FileInfo,
+// NOT the standard library fs.FileInfo,
 // and it returns an error incase any occurred,
 // if you want a list of files including
 // the files in sub directories, consider using the method
 // `AllFiles(DirectoryPath string)`
 func (l *LocalStorage) Files(DirectoryPath string) (files []FileInfo, err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, DirectoryPath)
+	return l.FilesCtx(context.Background(), DirectoryPath)
+}
 
-	_, err = os.Stat(DirectoryFullPath)
-	if os.IsNotExist(err) {
-		// not exist error
+// FilesCtx is the context aware variant of Files
+func (l *LocalStorage) FilesCtx(ctx context.Context, DirectoryPath string) (files []FileInfo, err error) {
+	if err := ctx.Err(); err != nil {
 		return []FileInfo{}, err
 	}
 
+	DirectoryFullPath, err := l.resolve("files", DirectoryPath)
+	if err != nil {
+		return []FileInfo{}, err
+	}
+
+	_, err = os.Stat(DirectoryFullPath)
+	if err != nil {
+		return []FileInfo{}, l.pathError("files", DirectoryPath, err)
+	}
+
 	res, err := ioutil.ReadDir(DirectoryFullPath)
 	for _, val := range res {
+		if err := ctx.Err(); err != nil {
+			return []FileInfo{}, err
+		}
 		if !val.IsDir() {
 			// assign the result var
 			p := path.Join(DirectoryPath, val.Name())
-			f, _ := l.FileInfo(p)
+			f, err := l.FileInfoCtx(ctx, p)
+			if err != nil {
+				// skip entries that can't be resolved like symlinks leading outside the root
+				continue
+			}
 			files = append(files, f)
 		}
 	}
 
-	return files, err
+	return files, l.pathError("files", DirectoryPath, err)
 }
 
 // AllFiles returns a list of files in the given directory
@@ -627,31 +648,60 @@ func (l *LocalStorage) Files(DirectoryPath string) (files []FileInfo, err error)
 // the file type in the list is LocalStorage.FileInfo
 // NOT the standard library fs.FileInfo
 func (l *LocalStorage) AllFiles(DirectoryPath string) (files []FileInfo, err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, DirectoryPath)
+	return l.AllFilesCtx(context.Background(), DirectoryPath)
+}
 
-	_, err = os.Stat(DirectoryFullPath)
-	if os.IsNotExist(err) {
-		// not exist error
+// AllFilesCtx is the context aware variant of AllFiles,
+// the walk stops as soon as the context is done
+func (l *LocalStorage) AllFilesCtx(ctx context.Context, DirectoryPath string) (files []FileInfo, err error) {
+	if err := ctx.Err(); err != nil {
+		return []FileInfo{}, err
+	}
+
+	DirectoryFullPath, err := l.resolve("allfiles", DirectoryPath)
+	if err != nil {
 		return []FileInfo{}, err
 	}
 
+	_, err = os.Stat(DirectoryFullPath)
+	if err != nil {
+		return []FileInfo{}, l.pathError("allfiles", DirectoryPath, err)
+	}
+
 	err = filepath.Walk(DirectoryFullPath, func(filePath string, info fs.FileInfo, err error) error {
 		if err != nil {
+			if filePath != DirectoryFullPath && os.IsNotExist(err) {
+				// removed while listing, like the temporary files of the writes
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 		if !info.IsDir() {
-			// trim root path
-			trimedPath := strings.ReplaceAll(filePath, l.rootFolder, "")
-			f, _ := l.FileInfo(trimedPath)
+			relPath, err := filepath.Rel(l.rootFolder, filePath)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			f, err := l.FileInfoCtx(ctx, relPath)
+			if errors.Is(err, ErrOutsideRoot) || errors.Is(err, fs.ErrNotExist) {
+				// skip symlinks leading outside the root and files removed while listing
+				return nil
+			}
+			if err != nil {
+				return l.pathError("allfiles", relPath, err)
+			}
 			files = append(files, f)
 		}
 		return nil
 	})
 	if err != nil {
-		return []FileInfo{}, err
+		return []FileInfo{}, l.pathError("allfiles", DirectoryPath, err)
 	}
 
-	return files, err
+	return files, nil
 }
 
 // Directories returns a slice of string containing
@@ -660,40 +710,73 @@ func (l *LocalStorage) AllFiles(DirectoryPath string) (files []FileInfo, err err
 // consider using the method "AllDirectories(DirectoryPath string)",
 // it returns an error incase is any
 func (l *LocalStorage) Directories(DirectoryPath string) (SubDirectoryPaths []string, err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, DirectoryPath)
+	return l.DirectoriesCtx(context.Background(), DirectoryPath)
+}
 
-	_, err = os.Stat(DirectoryFullPath)
-	if os.IsNotExist(err) {
-		// not exist error
+// DirectoriesCtx is the context aware variant of Directories
+func (l *LocalStorage) DirectoriesCtx(ctx context.Context, DirectoryPath string) (SubDirectoryPaths []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return []string{}, err
+	}
+
+	DirectoryFullPath, err := l.resolve("directories", DirectoryPath)
+	if err != nil {
 		return []string{}, err
 	}
 
+	_, err = os.Stat(DirectoryFullPath)
+	if err != nil {
+		return []string{}, l.pathError("directories", DirectoryPath, err)
+	}
+
 	res, err := ioutil.ReadDir(DirectoryFullPath)
 	for _, val := range res {
+		if err := ctx.Err(); err != nil {
+			return []string{}, err
+		}
 		if val.IsDir() {
 			// assign the result var
-			p := path.Join(l.rootFolder, DirectoryPath, val.Name())
+			p := filepath.Join(DirectoryFullPath, val.Name())
 			p = filepath.ToSlash(p)
 			SubDirectoryPaths = append(SubDirectoryPaths, p)
 		}
 	}
 
-	return SubDirectoryPaths, err
+	return SubDirectoryPaths, l.pathError("directories", DirectoryPath, err)
 }
 
 // AllDirectories returns a list of directories including
 // sub directories, it returns an error incase is any
 func (l *LocalStorage) AllDirectories(SubDirectoryPath string) (directoryPaths []string, err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, SubDirectoryPath)
+	return l.AllDirectoriesCtx(context.Background(), SubDirectoryPath)
+}
 
-	_, err = os.Stat(DirectoryFullPath)
-	if os.IsNotExist(err) {
-		// not exist error
+// AllDirectoriesCtx is the context aware variant of AllDirectories,
+// the walk stops as soon as the context is done
+func (l *LocalStorage) AllDirectoriesCtx(ctx context.Context, SubDirectoryPath string) (directoryPaths []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return []string{}, err
+	}
+
+	DirectoryFullPath, err := l.resolve("alldirectories", SubDirectoryPath)
+	if err != nil {
 		return []string{}, err
 	}
 
+	_, err = os.Stat(DirectoryFullPath)
+	if err != nil {
+		return []string{}, l.pathError("alldirectories", SubDirectoryPath, err)
+	}
+
 	err = filepath.Walk(DirectoryFullPath, func(filePath string, info fs.FileInfo, err error) error {
 		if err != nil {
+			if filePath != DirectoryFullPath && os.IsNotExist(err) {
+				// removed while listing, like the temporary files of the writes
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 		if info.IsDir() && filePath != DirectoryFullPath {
@@ -703,10 +786,10 @@ func (l *LocalStorage) AllDirectories(SubDirectoryPath string) (directoryPaths [
 		return nil
 	})
 	if err != nil {
-		return []string{}, err
+		return []string{}, l.pathError("alldirectories", SubDirectoryPath, err)
 	}
 
-	return directoryPaths, err
+	return directoryPaths, nil
 }
 
 // MakeDirectory creates a new directory and the necessary
@@ -714,27 +797,148 @@ func (l *LocalStorage) AllDirectories(SubDirectoryPath string) (directoryPaths [
 // permissions could be (example: 0777) or any linux based permissions,
 // it returns an error incase is any
 func (l *LocalStorage) MakeDirectory(DirectoryPath string, perm int) (err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, DirectoryPath)
+	return l.MakeDirectoryCtx(context.Background(), DirectoryPath, perm)
+}
+
+// MakeDirectoryCtx is the context aware variant of MakeDirectory
+func (l *LocalStorage) MakeDirectoryCtx(ctx context.Context, DirectoryPath string, perm int) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	DirectoryFullPath, err := l.resolve("mkdir", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
 	err = os.MkdirAll(DirectoryFullPath, fs.FileMode(perm))
-	return err
+	return l.pathError("mkdir", DirectoryPath, err)
 }
 
 // RenameDirectory changes the name of directory to new name,
 // it returns an error incase there is any
 func (l *LocalStorage) RenameDirectory(DirectoryPath string, NewDirectoryPath string) (err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, DirectoryPath)
-	NewDirectoryFullPath := path.Join(l.rootFolder, NewDirectoryPath)
+	return l.RenameDirectoryCtx(context.Background(), DirectoryPath, NewDirectoryPath)
+}
+
+// RenameDirectoryCtx is the context aware variant of RenameDirectory
+func (l *LocalStorage) RenameDirectoryCtx(ctx context.Context, DirectoryPath string, NewDirectoryPath string) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	DirectoryFullPath, err := l.resolve("rename", DirectoryPath)
+	if err != nil {
+		return err
+	}
+	NewDirectoryFullPath, err := l.resolve("rename", NewDirectoryPath)
+	if err != nil {
+		return err
+	}
+
 	err = os.Rename(DirectoryFullPath, NewDirectoryFullPath)
 
-	return err
+	return l.pathError("rename", DirectoryPath, err)
 }
 
 // DeleteDirectory deletes the given directory
 func (l *LocalStorage) DeleteDirectory(DirectoryPath string) (err error) {
-	DirectoryFullPath := path.Join(l.rootFolder, DirectoryPath)
-	err = os.RemoveAll(DirectoryFullPath)
+	return l.DeleteDirectoryCtx(context.Background(), DirectoryPath)
+}
 
-	return err
+// DeleteDirectoryCtx is the context aware variant of DeleteDirectory,
+// the directory tree is removed entry by entry so the deletion stops
+// as soon as the context is done, leaving the remaining entries in place
+func (l *LocalStorage) DeleteDirectoryCtx(ctx context.Context, DirectoryPath string) (err error) {
+	DirectoryFullPath, err := l.resolve("delete", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	if l.trash.Dir != "" {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s, err := os.Lstat(DirectoryFullPath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return l.pathError("delete", DirectoryPath, err)
+		}
+		if rel, _ := cleanRelative(DirectoryPath); rel == "." {
+			// the root folder can't be moved into the trash
+			return l.pathError("delete", DirectoryPath, ErrOutsideRoot)
+		}
+
+		return l.pathError("delete", DirectoryPath, l.moveToTrash(DirectoryPath, DirectoryFullPath, s))
+	}
+
+	err = l.removeAll(ctx, DirectoryFullPath)
+
+	return l.pathError("delete", DirectoryPath, err)
+}
+
+// ctxReadCloser fails reading once its context is done
+type ctxReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *ctxReadCloser) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// limitedReadCloser reads a part of a file and closes the file
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// copyStream copies from src to dst through a buffer
+// of a fixed size, the copy stops once the context is done,
+// it returns the number of bytes copied
+func copyStream(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	return io.CopyBuffer(dst, ctxio.NewReader(ctx, src), buf)
+}
+
+// removeAll works like os.RemoveAll but checks the context
+// before removing each entry
+func (l *LocalStorage) removeAll(ctx context.Context, fullPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if s.IsDir() {
+		entries, err := ioutil.ReadDir(fullPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := l.removeAll(ctx, filepath.Join(fullPath, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return l.remove(fullPath)
+}
+
+// Extension returns the extension of the file name without
+// the dot as reported in the Extension of the FileInfo
+func Extension(name string) string {
+	return removeFirstChar(path.Ext(name))
 }
 
 func removeFirstChar(s string) string {
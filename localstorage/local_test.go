@@ -5,7 +5,10 @@
 package localstorage_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -428,6 +431,69 @@ func TestRead(t *testing.T) {
 
 }
 
+func TestReadStream(t *testing.T) {
+	//create full path to the root folder
+	root, _ := filepath.Abs("./testdata/root")
+	// initiate the loal storage
+	l := New(root)
+
+	stream, err := l.ReadStream("filetoread.md")
+	if err != nil {
+		t.Error("failed assert reading file stream: ", err)
+	}
+	defer stream.Close()
+
+	content, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Error("failed assert reading file stream: ", err)
+	}
+	if string(content) != "contentToRead" {
+		t.Error("failed assert reading file stream")
+	}
+
+	// assert reading a missing file
+	_, err = l.ReadStream("missingfile.md")
+	if err == nil {
+		t.Error("failed assert reading missing file stream")
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	//create full path to the root folder
+	root, _ := filepath.Abs("./testdata/root")
+	// initiate the loal storage
+	l := New(root)
+
+	content := strings.Repeat("streamed content\n", 10000)
+	n, err := l.WriteStream("sub1/filetostream.md", strings.NewReader(content))
+	if err != nil {
+		t.Error("failed assert writing file stream: ", err)
+	}
+	if n != int64(len(content)) {
+		t.Error("failed assert writing file stream: written bytes")
+	}
+
+	fileContent, err := ioutil.ReadFile(path.Join(root, "sub1/filetostream.md"))
+	if err != nil {
+		t.Error("failed assert writing file stream: ", err)
+	}
+	if string(fileContent) != content {
+		t.Error("failed assert writing file stream: content")
+	}
+
+	// assert writing to an existing file
+	_, err = l.WriteStream("sub1/filetostream.md", strings.NewReader(content))
+	if err == nil {
+		t.Error("failed assert writing file stream: file already exists")
+	}
+
+	// cleanup
+	err = os.RemoveAll(path.Join(root, "sub1"))
+	if err != nil {
+		t.Error("failed assert writing file stream: ", err)
+	}
+}
+
 func TestFiles(t *testing.T) {
 	//create full path to the root folder
 	root, _ := filepath.Abs("./testdata/root")
@@ -456,6 +522,12 @@ func TestAllFiles(t *testing.T) {
 	if count != 3 {
 		t.Error("failed asserting list all files")
 	}
+
+	// a root folder that isn't clean is trimmed from the listed paths
+	files, err = New("./testdata/root").AllFiles("files")
+	if err != nil || len(files) != 3 {
+		t.Errorf("failed asserting list all files of a relative root: %d %v", len(files), err)
+	}
 }
 
 func TestDirectories(t *testing.T) {
@@ -550,6 +622,111 @@ func TestDeleteDirectory(t *testing.T) {
 		t.Error("failed asserting delete directory")
 	}
 
-	l.MakeDirectory(path.Join(root, "dirtodelete"), 0777)
-	l.Create(path.Join(root, "dirtodelete/.gitkeep"), []byte(""))
+	l.MakeDirectory("dirtodelete", 0777)
+	l.Create("dirtodelete/.gitkeep", []byte(""))
+}
+
+func TestCopyCtx(t *testing.T) {
+	//create full path to the root folder
+	root, _ := filepath.Abs("./testdata/root")
+	// initiate the loal storage
+	l := New(root)
+
+	// execute copy with a canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := l.CopyCtx(ctx, "filetocopy.md", "/sub1")
+	if !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting copy with canceled context. ", err)
+	}
+	_, err = os.Stat(path.Join(root, "sub1/filetocopy.md"))
+	if err == nil {
+		t.Error("failed asserting copy with canceled context: file copied")
+	}
+
+	// execute copy with a live context
+	err = l.CopyCtx(context.Background(), "filetocopy.md", "/sub1")
+	if err != nil {
+		t.Error("failed asserting copy with context. ", err)
+	}
+
+	// cleanup
+	os.RemoveAll(path.Join(root, "sub1"))
+}
+
+func TestWriteStreamCtx(t *testing.T) {
+	//create full path to the root folder
+	root, _ := filepath.Abs("./testdata/root")
+	// initiate the loal storage
+	l := New(root)
+
+	// cancel the context in the middle of the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	r := io.MultiReader(strings.NewReader("first part"), cancelingReader(cancel), strings.NewReader("second part"))
+	_, err := l.WriteStreamCtx(ctx, "filetostreamctx.md", r)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting write stream with canceled context. ", err)
+	}
+
+	// assert the partial file is removed
+	_, err = os.Stat(path.Join(root, "filetostreamctx.md"))
+	if err == nil {
+		t.Error("failed asserting write stream with canceled context: partial file exists")
+		os.Remove(path.Join(root, "filetostreamctx.md"))
+	}
+}
+
+func TestAllFilesCtx(t *testing.T) {
+	//create full path to the root folder
+	root, _ := filepath.Abs("./testdata/root")
+	// initiate the loal storage
+	l := New(root)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err := l.AllFilesCtx(ctx, "files")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("failed asserting list all files with expired context. ", err)
+	}
+
+	files, err := l.AllFilesCtx(context.Background(), "files")
+	if err != nil || len(files) != 3 {
+		t.Error("failed asserting list all files with context. ", err)
+	}
+}
+
+func TestDeleteDirectoryCtx(t *testing.T) {
+	//create full path to the root folder
+	root, _ := filepath.Abs("./testdata/root")
+	// initiate the loal storage
+	l := New(root)
+	l.Create("dirtodeletectx/sub/file.md", []byte("this is a test file"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := l.DeleteDirectoryCtx(ctx, "dirtodeletectx")
+	if !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting delete directory with canceled context. ", err)
+	}
+	_, err = os.Stat(path.Join(root, "dirtodeletectx/sub/file.md"))
+	if err != nil {
+		t.Error("failed asserting delete directory with canceled context: file deleted")
+	}
+
+	err = l.DeleteDirectoryCtx(context.Background(), "dirtodeletectx")
+	if err != nil {
+		t.Error("failed asserting delete directory with context. ", err)
+	}
+	_, err = os.Stat(path.Join(root, "dirtodeletectx"))
+	if err == nil {
+		t.Error("failed asserting delete directory with context: directory exists")
+	}
+}
+
+// cancelingReader cancels the context when read from
+type cancelingReader context.CancelFunc
+
+func (c cancelingReader) Read(p []byte) (int, error) {
+	c()
+	return 0, io.EOF
 }
@@ -0,0 +1,441 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides what a write does when
+// the destination file already exists
+type ConflictPolicy int
+
+const (
+	// Fail returns ErrAlreadyExists, it's the policy of the plain writes
+	Fail ConflictPolicy = iota
+	// Overwrite replaces the existing file atomically
+	Overwrite
+	// Skip keeps the existing file and writes nothing
+	Skip
+	// RenameWithSuffix writes to the first free name
+	// with a number suffix, like "file (1).txt"
+	RenameWithSuffix
+	// KeepNewer replaces the existing file only if the source was
+	// modified after it, the content of Create and WriteStream is
+	// always newer
+	KeepNewer
+)
+
+// Action is the action taken by a write
+type Action int
+
+const (
+	// Created means the file didn't exist and was written
+	Created Action = iota
+	// Overwritten means the existing file was replaced
+	Overwritten
+	// Skipped means the existing file was kept and nothing was written
+	Skipped
+	// Renamed means the file was written under a new name
+	Renamed
+)
+
+// String returns the name of the action
+func (a Action) String() string {
+	switch a {
+	case Created:
+		return "created"
+	case Overwritten:
+		return "overwritten"
+	case Skipped:
+		return "skipped"
+	case Renamed:
+		return "renamed"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// WriteResult reports the outcome of a write with a conflict policy
+type WriteResult struct {
+	Action Action
+	// Path is the path of the written file, it differs
+	// from the requested path when the file was renamed
+	Path string
+	// Size is the number of bytes written
+	Size int64
+}
+
+// maxSuffix limits the number suffixes tried by RenameWithSuffix
+const maxSuffix = 10000
+
+// PutWith is the variant of Put applying the given conflict policy,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) PutWith(filePath string, policy ConflictPolicy) (WriteResult, error) {
+	return l.PutWithCtx(context.Background(), filePath, policy)
+}
+
+// PutWithCtx is the context aware variant of PutWith
+func (l *LocalStorage) PutWithCtx(ctx context.Context, filePath string, policy ConflictPolicy) (WriteResult, error) {
+	return l.PutAsWithCtx(ctx, filePath, filepath.Base(filePath), policy)
+}
+
+// PutAsWith is the variant of PutAs applying the given conflict policy,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) PutAsWith(filePath string, filename string, policy ConflictPolicy) (WriteResult, error) {
+	return l.PutAsWithCtx(context.Background(), filePath, filename, policy)
+}
+
+// PutAsWithCtx is the context aware variant of PutAsWith
+func (l *LocalStorage) PutAsWithCtx(ctx context.Context, filePath string, filename string, policy ConflictPolicy) (WriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return WriteResult{}, err
+	}
+
+	// make sure the source file exists
+	s, err := os.Stat(filePath)
+	if err != nil {
+		return WriteResult{}, l.pathError("put", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return WriteResult{}, l.pathError("put", filePath, err)
+	}
+
+	// open the source file
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return WriteResult{}, l.pathError("put", filePath, err)
+	}
+	defer srcFile.Close()
+
+	return l.writeWith(ctx, filename, srcFile, policy, s.ModTime())
+}
+
+// CopyWith is the variant of Copy applying the given conflict policy,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) CopyWith(filePath string, destfolder string, policy ConflictPolicy) (WriteResult, error) {
+	return l.CopyWithCtx(context.Background(), filePath, destfolder, policy)
+}
+
+// CopyWithCtx is the context aware variant of CopyWith
+func (l *LocalStorage) CopyWithCtx(ctx context.Context, filePath string, destfolder string, policy ConflictPolicy) (WriteResult, error) {
+	return l.CopyAsWithCtx(ctx, filePath, destfolder, path.Base(filepath.ToSlash(filePath)), policy)
+}
+
+// CopyAsWith is the variant of CopyAs applying the given conflict policy,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) CopyAsWith(filePath string, destfolder string, newFilePath string, policy ConflictPolicy) (WriteResult, error) {
+	return l.CopyAsWithCtx(context.Background(), filePath, destfolder, newFilePath, policy)
+}
+
+// CopyAsWithCtx is the context aware variant of CopyAsWith
+func (l *LocalStorage) CopyAsWithCtx(ctx context.Context, filePath string, destfolder string, newFilePath string, policy ConflictPolicy) (WriteResult, error) {
+	//unify slashes
+	filePath = filepath.ToSlash(filePath)
+	destfolder = filepath.ToSlash(destfolder)
+
+	// the modification time of the source is needed by KeepNewer
+	srcFullPath, err := l.resolve("read", filePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	s, err := os.Stat(srcFullPath)
+	if err != nil {
+		return WriteResult{}, l.pathError("read", filePath, err)
+	}
+
+	// open the source file
+	srcFile, err := l.ReadStreamCtx(ctx, filePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	defer srcFile.Close()
+
+	// stream the content to the destination
+	return l.writeWith(ctx, path.Join(destfolder, newFilePath), srcFile, policy, s.ModTime())
+}
+
+// MoveWith is the variant of Move applying the given conflict policy,
+// a skipped move keeps the source file,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) MoveWith(filePath string, destFolder string, policy ConflictPolicy) (WriteResult, error) {
+	return l.MoveWithCtx(context.Background(), filePath, destFolder, policy)
+}
+
+// MoveWithCtx is the context aware variant of MoveWith
+func (l *LocalStorage) MoveWithCtx(ctx context.Context, filePath string, destFolder string, policy ConflictPolicy) (WriteResult, error) {
+	return l.MoveAsWithCtx(ctx, filePath, destFolder, path.Base(filepath.ToSlash(filePath)), policy)
+}
+
+// MoveAsWith is the variant of MoveAs applying the given conflict policy,
+// a skipped move keeps the source file, a move onto the source file
+// itself fails with the Fail policy and is skipped with the others,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) MoveAsWith(filePath string, destFolder string, newFilePath string, policy ConflictPolicy) (WriteResult, error) {
+	return l.MoveAsWithCtx(context.Background(), filePath, destFolder, newFilePath, policy)
+}
+
+// MoveAsWithCtx is the context aware variant of MoveAsWith
+func (l *LocalStorage) MoveAsWithCtx(ctx context.Context, filePath string, destFolder string, newFilePath string, policy ConflictPolicy) (WriteResult, error) {
+	destFilePath := path.Join(filepath.ToSlash(destFolder), newFilePath)
+	srcFileFullPath, err := l.resolve("move", filePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	destFileFullPath, err := l.resolve("move", destFilePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+
+	// copying the file onto itself and removing the source loses the file
+	if s, err := os.Stat(srcFileFullPath); err == nil && sameFile(s, destFileFullPath) {
+		if policy == Fail {
+			return WriteResult{}, l.pathError("move", destFilePath, ErrAlreadyExists)
+		}
+		return WriteResult{Action: Skipped, Path: destFilePath}, nil
+	}
+
+	result, err := l.CopyAsWithCtx(ctx, filePath, destFolder, newFilePath, policy)
+	if err != nil || result.Action == Skipped {
+		return result, err
+	}
+
+	// remove the source file
+	if err := l.keepVersion(filePath, srcFileFullPath, false); err != nil {
+		return result, l.pathError("move", filePath, err)
+	}
+
+	return result, l.pathError("move", filePath, l.remove(srcFileFullPath))
+}
+
+// RenameWith is the variant of Rename applying the given conflict policy,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) RenameWith(filePath string, newFilePath string, policy ConflictPolicy) (WriteResult, error) {
+	return l.RenameWithCtx(context.Background(), filePath, newFilePath, policy)
+}
+
+// RenameWithCtx is the context aware variant of RenameWith
+func (l *LocalStorage) RenameWithCtx(ctx context.Context, filePath string, newFilePath string, policy ConflictPolicy) (WriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return WriteResult{}, err
+	}
+
+	srcFileFullPath, err := l.resolve("rename", filePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	destFileFullPath, err := l.resolve("rename", newFilePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+
+	// make sure the source file exists
+	s, err := os.Stat(srcFileFullPath)
+	if err != nil {
+		return WriteResult{}, l.pathError("rename", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return WriteResult{}, l.pathError("rename", filePath, err)
+	}
+
+	result := WriteResult{Path: newFilePath, Size: s.Size()}
+	result.Action, err = conflict(destFileFullPath, policy, s.ModTime())
+	if err != nil || result.Action == Skipped {
+		result.Size = 0
+		return result, l.pathError("rename", filePath, err)
+	}
+
+	// renaming a file onto itself loses no content, linking
+	// the live file into the versions would let them change
+	if !sameFile(s, destFileFullPath) {
+		// the content stays in use under the new name so the version is a copy
+		if err := l.keepVersion(filePath, srcFileFullPath, true); err != nil {
+			return WriteResult{}, l.pathError("rename", filePath, err)
+		}
+		if result.Action == Overwritten {
+			if err := l.keepVersion(newFilePath, destFileFullPath, false); err != nil {
+				return WriteResult{}, l.pathError("rename", newFilePath, err)
+			}
+		}
+	}
+
+	placed, err := place(srcFileFullPath, destFileFullPath, policy, &result)
+	if err == nil && !placed {
+		// the source was linked into place
+		err = l.remove(srcFileFullPath)
+	}
+
+	return result, l.pathError("rename", filePath, err)
+}
+
+// CreateWith is the variant of Create applying the given conflict policy,
+// it returns the action taken and an error incase there is any
+func (l *LocalStorage) CreateWith(filePath string, content []byte, policy ConflictPolicy) (WriteResult, error) {
+	return l.CreateWithCtx(context.Background(), filePath, content, policy)
+}
+
+// CreateWithCtx is the context aware variant of CreateWith
+func (l *LocalStorage) CreateWithCtx(ctx context.Context, filePath string, content []byte, policy ConflictPolicy) (WriteResult, error) {
+	return l.WriteStreamWithCtx(ctx, filePath, bytes.NewReader(content), policy)
+}
+
+// WriteStreamWith is the variant of WriteStream applying the given
+// conflict policy, it returns the action taken and an error incase there is any
+func (l *LocalStorage) WriteStreamWith(filePath string, r io.Reader, policy ConflictPolicy) (WriteResult, error) {
+	return l.WriteStreamWithCtx(context.Background(), filePath, r, policy)
+}
+
+// WriteStreamWithCtx is the context aware variant of WriteStreamWith
+func (l *LocalStorage) WriteStreamWithCtx(ctx context.Context, filePath string, r io.Reader, policy ConflictPolicy) (WriteResult, error) {
+	return l.writeWith(ctx, filePath, r, policy, time.Now())
+}
+
+// writeWith writes the content atomically applying the conflict policy,
+// srcModTime is the modification time of the source compared by KeepNewer
+func (l *LocalStorage) writeWith(ctx context.Context, filePath string, r io.Reader, policy ConflictPolicy, srcModTime time.Time) (WriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return WriteResult{}, err
+	}
+
+	fileFullPath, err := l.resolve("write", filePath)
+	if err != nil {
+		return WriteResult{}, err
+	}
+
+	// make sure the path of dest folder exists
+	os.MkdirAll(filepath.Dir(fileFullPath), 0755)
+
+	result := WriteResult{Path: filePath}
+	result.Action, err = conflict(fileFullPath, policy, srcModTime)
+	if err != nil || result.Action == Skipped {
+		return result, l.pathError("write", filePath, err)
+	}
+
+	result.Size, err = l.writeAtomic(ctx, fileFullPath, r, func(tmpPath string) error {
+		if result.Action == Overwritten {
+			// the fresh temp file replaces the destination, it has
+			// to keep the permissions of the file it overwrites
+			if info, err := os.Stat(fileFullPath); err == nil {
+				if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+					return err
+				}
+			}
+			if err := l.keepVersion(filePath, fileFullPath, false); err != nil {
+				return err
+			}
+		}
+		_, err := place(tmpPath, fileFullPath, policy, &result)
+		return err
+	})
+	if err != nil || result.Action == Skipped {
+		result.Size = 0
+	}
+
+	return result, l.pathError("write", filePath, err)
+}
+
+// conflict checks the destination and decides the action
+// of the policy, the actions are confirmed by place
+func conflict(fullPath string, policy ConflictPolicy, srcModTime time.Time) (Action, error) {
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Created, nil
+	}
+	if err != nil {
+		return Created, err
+	}
+
+	switch policy {
+	case Skip:
+		return Skipped, nil
+	case RenameWithSuffix:
+		return Renamed, nil
+	}
+	if info.IsDir() {
+		return Created, ErrIsDirectory
+	}
+	switch policy {
+	case Overwrite:
+		return Overwritten, nil
+	case KeepNewer:
+		if srcModTime.After(info.ModTime()) {
+			return Overwritten, nil
+		}
+		return Skipped, nil
+	}
+
+	return Created, ErrAlreadyExists
+}
+
+// place moves the source into the destination according to the action,
+// files are replaced with a rename, new files are linked so an existing
+// file is never replaced even if it was created in the meantime, the
+// result is updated with the final action and path, it reports whether
+// the source was renamed rather than linked
+func place(src string, dest string, policy ConflictPolicy, result *WriteResult) (renamed bool, err error) {
+	if result.Action == Overwritten {
+		return true, os.Rename(src, dest)
+	}
+
+	for i := 0; i < maxSuffix; i++ {
+		candidate := dest
+		if i > 0 {
+			candidate = withSuffix(dest, i)
+		}
+		renamed, err = link(src, candidate)
+		if err == nil {
+			if candidate != dest {
+				result.Action = Renamed
+				result.Path = path.Join(path.Dir(filepath.ToSlash(result.Path)), filepath.Base(candidate))
+			} else {
+				result.Action = Created
+			}
+			return renamed, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+		switch policy {
+		case Skip:
+			// created in the meantime
+			result.Action = Skipped
+			result.Size = 0
+			return false, nil
+		case RenameWithSuffix:
+			continue
+		}
+		return false, ErrAlreadyExists
+	}
+
+	return false, ErrAlreadyExists
+}
+
+// sameFile reports whether the file at the given path is the given file
+func sameFile(info fs.FileInfo, fullPath string) bool {
+	other, err := os.Stat(fullPath)
+	return err == nil && os.SameFile(info, other)
+}
+
+// withSuffix adds the number suffix to the file name
+// before its extension, like "file (1).txt"
+func withSuffix(fullPath string, n int) string {
+	dir, name := filepath.Split(fullPath)
+	ext := filepath.Ext(name)
+	if ext == name {
+		// hidden files like ".env" have no extension
+		ext = ""
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext))
+}
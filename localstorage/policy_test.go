@@ -0,0 +1,217 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+func TestCreateWith(t *testing.T) {
+	root := t.TempDir()
+	l := New(root)
+	l.Create("docs/file.txt", []byte("original"))
+
+	tests := []struct {
+		policy  ConflictPolicy
+		action  Action
+		path    string
+		content string
+	}{
+		{Skip, Skipped, "docs/file.txt", "original"},
+		{RenameWithSuffix, Renamed, "docs/file (1).txt", "renamed"},
+		{RenameWithSuffix, Renamed, "docs/file (2).txt", "renamed again"},
+		{Overwrite, Overwritten, "docs/file.txt", "overwritten"},
+		{KeepNewer, Overwritten, "docs/file.txt", "newer"},
+	}
+	for _, tt := range tests {
+		result, err := l.CreateWith("docs/file.txt", []byte(tt.content), tt.policy)
+		if err != nil {
+			t.Fatalf("failed asserting create with policy %d: %v", tt.policy, err)
+		}
+		if result.Action != tt.action || result.Path != tt.path {
+			t.Errorf("failed asserting the result of policy %d: %+v", tt.policy, result)
+		}
+		content, _ := l.Read(tt.path)
+		if string(content) != tt.content && tt.action != Skipped {
+			t.Errorf("failed asserting the content of policy %d: %s", tt.policy, content)
+		}
+	}
+
+	if _, err := l.CreateWith("docs/file.txt", []byte("x"), Fail); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting fail policy. ", err)
+	}
+	result, err := l.CreateWith("docs/new.txt", []byte("new"), Fail)
+	if err != nil || result.Action != Created || result.Size != 3 {
+		t.Errorf("failed asserting create of a new file: %+v %v", result, err)
+	}
+	if _, err := l.CreateWith("docs", []byte("x"), Overwrite); !errors.Is(err, ErrIsDirectory) {
+		t.Error("failed asserting overwrite of a directory. ", err)
+	}
+	if result.Action.String() != "created" || Renamed.String() != "renamed" {
+		t.Error("failed asserting action names")
+	}
+
+	// no temp files are left behind
+	entries, _ := ioutil.ReadDir(filepath.Join(root, "docs"))
+	if len(entries) != 4 {
+		t.Error("failed asserting the directory entries. ", len(entries))
+	}
+}
+
+func TestCreateWithKeepsMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no permission bits")
+	}
+	root := t.TempDir()
+	l := New(root)
+	l.Create("private.txt", []byte("secret"))
+	os.Chmod(filepath.Join(root, "private.txt"), 0600)
+
+	if _, err := l.CreateWith("private.txt", []byte("new secret"), Overwrite); err != nil {
+		t.Fatal("failed asserting the overwrite. ", err)
+	}
+	info, err := os.Stat(filepath.Join(root, "private.txt"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("failed asserting the mode is kept across an overwrite: %v %v", info.Mode(), err)
+	}
+}
+
+func TestPutWithKeepNewer(t *testing.T) {
+	l := New(t.TempDir())
+	src := filepath.Join(t.TempDir(), "file.txt")
+	ioutil.WriteFile(src, []byte("older source"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(src, old, old)
+	l.Create("file.txt", []byte("current"))
+
+	result, err := l.PutWith(src, KeepNewer)
+	if err != nil || result.Action != Skipped || result.Size != 0 {
+		t.Errorf("failed asserting an older source is skipped: %+v %v", result, err)
+	}
+	content, _ := l.Read("file.txt")
+	if string(content) != "current" {
+		t.Error("failed asserting the existing file is kept")
+	}
+
+	newer := time.Now().Add(time.Hour)
+	os.Chtimes(src, newer, newer)
+	result, err = l.PutAsWith(src, "file.txt", KeepNewer)
+	if err != nil || result.Action != Overwritten {
+		t.Errorf("failed asserting a newer source overwrites: %+v %v", result, err)
+	}
+	content, _ = l.Read("file.txt")
+	if string(content) != "older source" {
+		t.Error("failed asserting the overwritten content")
+	}
+}
+
+func TestCopyAndMoveWith(t *testing.T) {
+	l := New(t.TempDir())
+	l.Create("src.txt", []byte("source"))
+	l.Create("dest/src.txt", []byte("existing"))
+
+	result, err := l.CopyWith("src.txt", "dest", RenameWithSuffix)
+	if err != nil || result.Action != Renamed || result.Path != "dest/src (1).txt" {
+		t.Errorf("failed asserting copy with rename: %+v %v", result, err)
+	}
+
+	result, err = l.MoveWith("src.txt", "dest", Skip)
+	if err != nil || result.Action != Skipped {
+		t.Errorf("failed asserting skipped move: %+v %v", result, err)
+	}
+	if yes, _ := l.Exists("src.txt"); !yes {
+		t.Error("failed asserting a skipped move keeps the source")
+	}
+
+	result, err = l.MoveAsWith("src.txt", "dest", "src.txt", Overwrite)
+	if err != nil || result.Action != Overwritten {
+		t.Errorf("failed asserting move with overwrite: %+v %v", result, err)
+	}
+	if yes, _ := l.Exists("src.txt"); yes {
+		t.Error("failed asserting the moved source is removed")
+	}
+	content, _ := l.Read("dest/src.txt")
+	if string(content) != "source" {
+		t.Error("failed asserting the moved content")
+	}
+}
+
+func TestMoveWithOntoItself(t *testing.T) {
+	l := New(t.TempDir())
+	l.Create("a.txt", []byte("hello"))
+
+	moves := []struct {
+		destFolder string
+		policy     ConflictPolicy
+	}{{"", Overwrite}, {"/", RenameWithSuffix}, {".", KeepNewer}, {"docs/..", Skip}}
+	for _, m := range moves {
+		result, err := l.MoveWith("a.txt", m.destFolder, m.policy)
+		if err != nil || result.Action != Skipped {
+			t.Errorf("failed asserting a move onto itself into %q is skipped: %+v %v", m.destFolder, result, err)
+		}
+	}
+	if _, err := l.MoveWith("a.txt", "", Fail); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting a move onto itself with the fail policy. ", err)
+	}
+	if content, err := l.Read("a.txt"); err != nil || string(content) != "hello" {
+		t.Errorf("failed asserting the file moved onto itself is kept: %q %v", content, err)
+	}
+	if files, _ := l.Files("."); len(files) != 1 {
+		t.Errorf("failed asserting no file was added: %d", len(files))
+	}
+}
+
+func TestRenameWith(t *testing.T) {
+	l := New(t.TempDir())
+	l.Create("a.txt", []byte("a"))
+	l.Create("b.txt", []byte("b"))
+
+	if _, err := l.RenameWith("a.txt", "b.txt", Fail); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting rename with fail policy. ", err)
+	}
+	result, err := l.RenameWith("a.txt", "b.txt", RenameWithSuffix)
+	if err != nil || result.Action != Renamed || result.Path != "b (1).txt" {
+		t.Errorf("failed asserting rename with suffix: %+v %v", result, err)
+	}
+	if yes, _ := l.Exists("a.txt"); yes {
+		t.Error("failed asserting the renamed source is removed")
+	}
+	content, _ := l.Read("b.txt")
+	if string(content) != "b" {
+		t.Error("failed asserting the existing file is kept")
+	}
+
+	// the plain rename keeps replacing the existing file
+	if err := l.Rename("b (1).txt", "b.txt"); err != nil {
+		t.Error("failed asserting rename. ", err)
+	}
+	content, _ = l.Read("b.txt")
+	if string(content) != "a" {
+		t.Error("failed asserting rename replaces the existing file")
+	}
+}
+
+func TestRenameWithSuffixNames(t *testing.T) {
+	l := New(t.TempDir())
+	for _, name := range []string{".env", "archive.tar.gz", "noext"} {
+		l.Create(name, []byte("1"))
+	}
+
+	want := map[string]string{".env": ".env (1)", "archive.tar.gz": "archive.tar (1).gz", "noext": "noext (1)"}
+	for name, renamed := range want {
+		result, err := l.CreateWith(name, []byte("2"), RenameWithSuffix)
+		if err != nil || result.Path != renamed {
+			t.Errorf("failed asserting the suffixed name of %s: %+v %v", name, result, err)
+		}
+	}
+}
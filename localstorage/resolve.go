@@ -0,0 +1,57 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// resolve converts the given path relative to the root folder into a full
+// path, the paths leading outside of it are rejected with ErrOutsideRoot
+func (l *LocalStorage) resolve(op string, filePath string) (string, error) {
+	rel, ok := cleanRelative(filePath)
+	if !ok {
+		return "", &PathError{Op: op, Disk: l.name, Path: filePath, Err: ErrOutsideRoot}
+	}
+
+	// make sure no symlink on the way leads outside the root folder
+	outside, err := l.escapesRoot(rel)
+	if err != nil {
+		return "", l.pathError(op, filePath, err)
+	}
+	if outside {
+		return "", &PathError{Op: op, Disk: l.name, Path: filePath, Err: ErrOutsideRoot}
+	}
+
+	return filepath.Join(l.rootFolder, filepath.FromSlash(rel)), nil
+}
+
+// cleanRelative cleans the given path and makes it relative to the
+// root folder, it reports false if the path climbs above the root folder
+func cleanRelative(filePath string) (string, bool) {
+	p := path.Clean(filepath.ToSlash(filePath))
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		p = "."
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+
+	return p, true
+}
+
+// isWithin reports whether the given path is the root or is under it
+func isWithin(root string, fullPath string) bool {
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !go1.24
+// +build !go1.24
+
+package localstorage
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// rootHandle is only used with os.Root, which isn't available before go1.24
+type rootHandle struct{}
+
+// escapesRoot reports whether the given path relative to the root folder
+// leads outside of it once its symlinks are evaluated, os.Root isn't
+// available before go1.24, only the longest part of the path that
+// exists is evaluated since the rest can't be symlinks, a dangling
+// symlink is reported as outside since its target may be created later
+func (l *LocalStorage) escapesRoot(rel string) (bool, error) {
+	realRoot, err := filepath.EvalSymlinks(l.rootFolder)
+	if os.IsNotExist(err) {
+		// nothing exists yet, so there is no symlink to follow
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for p := rel; ; p = path.Dir(p) {
+		fullPath := filepath.Join(l.rootFolder, filepath.FromSlash(p))
+		_, err := os.Lstat(fullPath)
+		if err == nil {
+			resolved, err := filepath.EvalSymlinks(fullPath)
+			if os.IsNotExist(err) {
+				// dangling symlink
+				return true, nil
+			} else if err != nil {
+				return false, err
+			}
+			return !isWithin(realRoot, resolved), nil
+		}
+		if p == "." {
+			return false, nil
+		}
+	}
+}
+
+// openFile works like os.OpenFile, before go1.24 the
+// files rely on the check of resolve only
+func (l *LocalStorage) openFile(fullPath string, flag int, perm fs.FileMode) (*os.File, error) {
+	return os.OpenFile(fullPath, flag, perm)
+}
+
+// remove works like os.Remove, before go1.24 the
+// entries rely on the check of resolve only
+func (l *LocalStorage) remove(fullPath string) error {
+	return os.Remove(fullPath)
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.24
+// +build go1.24
+
+package localstorage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// rootHandle keeps the os.Root of the root folder open
+// between the operations of the disk
+type rootHandle struct {
+	mu   sync.Mutex
+	root *os.Root
+	info fs.FileInfo
+}
+
+// escapesRoot reports whether the given path relative to the root folder
+// leads outside of it, it relies on os.Root which refuses to follow
+// symlinks out of the root folder
+func (l *LocalStorage) escapesRoot(rel string) (bool, error) {
+	root, err := l.openRoot()
+	if os.IsNotExist(err) {
+		// nothing exists yet, so there is no symlink to follow
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = root.Stat(filepath.FromSlash(rel))
+
+	// any other failure is left for the operation itself to report
+	return errors.Is(rootError(err), ErrOutsideRoot), nil
+}
+
+// openFile works like os.OpenFile, the files within the root folder are
+// opened through its os.Root so a symlink swapped in after the path was
+// resolved can't lead outside of it
+func (l *LocalStorage) openFile(fullPath string, flag int, perm fs.FileMode) (*os.File, error) {
+	root, rel := l.rooted(fullPath)
+	if root == nil {
+		return os.OpenFile(fullPath, flag, perm)
+	}
+	file, err := root.OpenFile(rel, flag, perm)
+
+	return file, rootError(err)
+}
+
+// remove works like os.Remove, the entries within the
+// root folder are removed through its os.Root
+func (l *LocalStorage) remove(fullPath string) error {
+	root, rel := l.rooted(fullPath)
+	if root == nil || rel == "." {
+		return os.Remove(fullPath)
+	}
+
+	return rootError(root.Remove(rel))
+}
+
+// rooted returns the os.Root of the root folder and the given full path
+// relative to it, the root is nil for the paths outside the root folder,
+// like the ones of the trash and the versions, and while the root folder
+// doesn't exist
+func (l *LocalStorage) rooted(fullPath string) (*os.Root, string) {
+	rel, err := filepath.Rel(l.rootFolder, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, ""
+	}
+	root, err := l.openRoot()
+	if err != nil {
+		return nil, ""
+	}
+
+	return root, rel
+}
+
+// rootError reports the errors of os.Root for the paths escaping the root
+// folder as ErrOutsideRoot, os.Root doesn't export them and any other
+// failure comes from the system as a syscall.Errno
+func rootError(err error) error {
+	var errno syscall.Errno
+	if err == nil || errors.Is(err, fs.ErrNotExist) || errors.As(err, &errno) {
+		return err
+	}
+
+	return ErrOutsideRoot
+}
+
+// openRoot returns the os.Root of the root folder, it's opened once and
+// opened again only if the root folder is replaced, the replaced one
+// is closed by its finalizer as other operations may still use it
+func (l *LocalStorage) openRoot() (*os.Root, error) {
+	info, err := os.Stat(l.rootFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	l.root.mu.Lock()
+	defer l.root.mu.Unlock()
+	if l.root.root != nil && os.SameFile(l.root.info, info) {
+		return l.root.root, nil
+	}
+	root, err := os.OpenRoot(l.rootFolder)
+	if err != nil {
+		return nil, err
+	}
+	l.root.root, l.root.info = root, info
+
+	return root, nil
+}
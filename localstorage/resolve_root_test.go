@@ -0,0 +1,49 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.24
+// +build go1.24
+
+package localstorage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+func TestSwappedSymlinkIsContained(t *testing.T) {
+	root, outside := newTraversalRoot(t)
+	l := New(root)
+	if _, err := l.Read("sub/file.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the directory is swapped for a symlink leading outside after the check
+	if err := os.RemoveAll(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := l.OpenResolved("sub/secret.md"); !errors.Is(err, ErrOutsideRoot) {
+		if f != nil {
+			f.Close()
+		}
+		t.Error("failed asserting the swapped symlink isn't followed: ", err)
+	}
+	l.Create("docs/file.md", []byte("inside"))
+	if err := os.Symlink("docs", filepath.Join(root, "docslink")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := l.OpenResolved("docslink/file.md")
+	if err != nil {
+		t.Fatal("failed asserting symlinks within the root are followed: ", err)
+	}
+	f.Close()
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+// newTraversalRoot creates a root folder with a secret file next to it,
+// and symlinks inside the root pointing both inside and outside of it
+func newTraversalRoot(t *testing.T) (root string, outside string) {
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "sub/file.md"):  "inside",
+		filepath.Join(outside, "secret.md"): "secret",
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"escdir":     "../outside",
+		"escfile.md": "../outside/secret.md",
+		"escabs":     outside,
+		"dangling":   "../outside/missing",
+		"insidedir":  "sub",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip("symlinks are not supported: ", err)
+		}
+	}
+
+	return root, outside
+}
+
+func TestTraversalIsRejected(t *testing.T) {
+	root, outside := newTraversalRoot(t)
+	l := New(root)
+
+	paths := []string{
+		"../outside/secret.md",
+		"../../etc/passwd",
+		"sub/../../outside/secret.md",
+		"..",
+		"escdir/secret.md",
+		"escdir/newfile.md",
+		"escfile.md",
+		"escabs/secret.md",
+		"dangling",
+		"dangling/newfile.md",
+	}
+	for _, p := range paths {
+		if _, err := l.Read(p); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting read of %q is rejected: %v", p, err)
+		}
+		if _, err := l.FileInfo(p); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting file info of %q is rejected: %v", p, err)
+		}
+		if err := l.Create(p, []byte("pwned")); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting create of %q is rejected: %v", p, err)
+		}
+		if err := l.Append(p, []byte("pwned")); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting append to %q is rejected: %v", p, err)
+		}
+		if err := l.Delete(p); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting delete of %q is rejected: %v", p, err)
+		}
+		if err := l.CopyAs("sub/file.md", p, "copied.md"); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting copy into %q is rejected: %v", p, err)
+		}
+		if err := l.DeleteDirectory(p); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting delete directory %q is rejected: %v", p, err)
+		}
+	}
+
+	// make sure nothing outside the root was touched
+	content, err := os.ReadFile(filepath.Join(outside, "secret.md"))
+	if err != nil || string(content) != "secret" {
+		t.Error("failed asserting the file outside the root is untouched")
+	}
+	entries, _ := os.ReadDir(outside)
+	if len(entries) != 1 {
+		t.Error("failed asserting nothing was created outside the root")
+	}
+}
+
+func TestTraversalWithinRoot(t *testing.T) {
+	root, _ := newTraversalRoot(t)
+	l := New(root)
+
+	// paths that stay within the root are allowed
+	paths := []string{
+		"sub/file.md",
+		"/sub/file.md",
+		"sub/../sub/file.md",
+		"insidedir/file.md",
+	}
+	for _, p := range paths {
+		content, err := l.Read(p)
+		if err != nil || string(content) != "inside" {
+			t.Errorf("failed asserting read of %q: %v", p, err)
+		}
+	}
+
+	// files that don't exist yet are allowed
+	if err := l.Create("new/dir/file.md", []byte("new")); err != nil {
+		t.Error("failed asserting create within root: ", err)
+	}
+
+	// listings skip entries leading outside the root
+	files, err := l.Files("/")
+	if err != nil {
+		t.Error("failed asserting listing the root: ", err)
+	}
+	for _, f := range files {
+		if f.Name == "escfile.md" {
+			t.Error("failed asserting listing skips symlinks leading outside the root")
+		}
+	}
+}
+
+func TestTraversalErrorIsPathError(t *testing.T) {
+	root, _ := newTraversalRoot(t)
+	l := New(root)
+
+	_, err := l.Read("../outside/secret.md")
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatal("failed asserting traversal error is a path error: ", err)
+	}
+	if pathErr.Op != "read" || pathErr.Disk != "local" || pathErr.Path != "../outside/secret.md" {
+		t.Error("failed asserting traversal error details: ", pathErr)
+	}
+}
+
+func TestTraversalAfterRootIsReplaced(t *testing.T) {
+	root, outside := newTraversalRoot(t)
+	l := New(root)
+	if _, err := l.Read("sub/file.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the root folder is moved away and a new one takes its place
+	if err := os.Rename(root, root+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Read("sub/secret.md"); !errors.Is(err, ErrOutsideRoot) {
+		t.Error("failed asserting the replaced root is checked: ", err)
+	}
+}
+
+func TestTraversalOnlyEscapesAreRejected(t *testing.T) {
+	root, _ := newTraversalRoot(t)
+	l := New(root)
+	if err := os.Symlink("loop", filepath.Join(root, "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failures of the system are reported by the operations themselves
+	paths := []string{"sub/file.md/below.md", "loop", "loop/file.md", "sub/missing/file.md"}
+	for _, p := range paths {
+		_, err := l.Read(p)
+		if err == nil || errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("failed asserting %q isn't taken for an escape: %v", p, err)
+		}
+	}
+	if _, err := l.Read("escdir/secret.md"); !errors.Is(err, ErrOutsideRoot) {
+		t.Error("failed asserting an escape is rejected: ", err)
+	}
+}
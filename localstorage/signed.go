@@ -0,0 +1,170 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errors returned by the signed urls
+var (
+	ErrNoSigningKey     = errors.New("no signing key is set")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature has expired")
+)
+
+// SigningKey is a secret used to sign urls, the ID is sent
+// along with the signature so keys can be rotated
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// SignedURLOpts options bound to a signed url
+type SignedURLOpts struct {
+	// Method binds the url to the given method, GET also allows HEAD,
+	// by default GET and HEAD are allowed
+	Method string
+	// Disposition binds the url to the given content disposition,
+	// "inline" or "attachment", by default the server decides
+	Disposition string
+}
+
+// the query parameters of the signed urls
+const (
+	expiresParam     = "expires"
+	keyIDParam       = "keyId"
+	methodParam      = "method"
+	dispositionParam = "disposition"
+	signatureParam   = "signature"
+)
+
+// SignedURL returns a url of the file under the base url signed with the
+// first signing key, it's valid for the given duration, the url can be
+// checked with VerifySignedURL, it returns an error incase there is any
+func (l *LocalStorage) SignedURL(filePath string, ttl time.Duration, opts SignedURLOpts) (string, error) {
+	if len(l.signingKeys) == 0 {
+		return "", l.pathError("signedurl", filePath, ErrNoSigningKey)
+	}
+	if ttl <= 0 {
+		return "", l.pathError("signedurl", filePath, errors.New("ttl must be positive"))
+	}
+	if opts.Disposition != "" && opts.Disposition != "inline" && opts.Disposition != "attachment" {
+		return "", l.pathError("signedurl", filePath, errors.New("disposition must be inline or attachment"))
+	}
+
+	fullPath, err := l.resolve("signedurl", filePath)
+	if err != nil {
+		return "", err
+	}
+	s, err := os.Stat(fullPath)
+	if err != nil {
+		return "", l.pathError("signedurl", filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return "", l.pathError("signedurl", filePath, err)
+	}
+	rel, _ := cleanRelative(filePath)
+
+	u, err := url.Parse(l.baseURL)
+	if err != nil {
+		return "", l.pathError("signedurl", filePath, err)
+	}
+	urlPath := "/" + rel
+	u.Path = strings.TrimSuffix(u.Path, "/") + urlPath
+
+	key := l.signingKeys[0]
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{expiresParam: {expires}, keyIDParam: {key.ID}}
+	if opts.Method != "" {
+		query.Set(methodParam, strings.ToUpper(opts.Method))
+	}
+	if opts.Disposition != "" {
+		query.Set(dispositionParam, opts.Disposition)
+	}
+	query.Set(signatureParam, sign(key, urlPath, query))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// VerifySignedURL checks the signature and the expiry of a signed url
+// requested with the given method, the path of the url must be relative
+// to the base url the url was signed with, any of the keys can match,
+// it returns the options bound to the url or ErrInvalidSignature or
+// ErrExpiredSignature
+func VerifySignedURL(keys []SigningKey, method string, u *url.URL, now time.Time) (SignedURLOpts, error) {
+	query := u.Query()
+	opts := SignedURLOpts{Method: query.Get(methodParam), Disposition: query.Get(dispositionParam)}
+
+	var key *SigningKey
+	for i := range keys {
+		if keys[i].ID == query.Get(keyIDParam) {
+			key = &keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return opts, ErrInvalidSignature
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get(signatureParam))
+	if err != nil {
+		return opts, ErrInvalidSignature
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(sign(*key, path.Clean("/"+u.Path), query))
+	if !hmac.Equal(signature, expected) {
+		return opts, ErrInvalidSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get(expiresParam), 10, 64)
+	if err != nil {
+		return opts, ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return opts, ErrExpiredSignature
+	}
+	if !methodAllowed(opts.Method, method) {
+		return opts, ErrInvalidSignature
+	}
+
+	return opts, nil
+}
+
+// sign returns the signature of the path and the bound parameters
+func sign(key SigningKey, urlPath string, query url.Values) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(strings.Join([]string{
+		"v1",
+		query.Get(methodParam),
+		urlPath,
+		query.Get(expiresParam),
+		query.Get(dispositionParam),
+		query.Get(keyIDParam),
+	}, "\n")))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// methodAllowed reports whether the request method is allowed by the bound one
+func methodAllowed(bound string, method string) bool {
+	switch bound {
+	case "":
+		return method == http.MethodGet || method == http.MethodHead
+	case http.MethodGet:
+		return method == http.MethodGet || method == http.MethodHead
+	}
+
+	return method == bound
+}
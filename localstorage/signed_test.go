@@ -0,0 +1,121 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+var (
+	oldKey = SigningKey{ID: "2020", Secret: []byte("old secret")}
+	newKey = SigningKey{ID: "2021", Secret: []byte("new secret")}
+)
+
+func TestSignedURL(t *testing.T) {
+	l := NewWithOpts(t.TempDir(), Opts{BaseURL: "https://cdn.example.com/files/", SigningKeys: []SigningKey{newKey, oldKey}})
+	l.Create("docs/report 2021.pdf", []byte("report"))
+
+	signed, err := l.SignedURL("docs/../docs/report 2021.pdf", time.Hour, SignedURLOpts{})
+	if err != nil {
+		t.Fatal("failed asserting signed url. ", err)
+	}
+	u, _ := url.Parse(signed)
+	if u.Host != "cdn.example.com" || u.Path != "/files/docs/report 2021.pdf" || u.Query().Get("keyId") != "2021" {
+		t.Fatalf("failed asserting the signed url: %s", signed)
+	}
+
+	// the server sees the path without the base url
+	u.Path = strings.TrimPrefix(u.Path, "/files")
+	if _, err := VerifySignedURL([]SigningKey{oldKey, newKey}, http.MethodGet, u, time.Now()); err != nil {
+		t.Error("failed asserting verification. ", err)
+	}
+	if _, err := VerifySignedURL([]SigningKey{newKey}, http.MethodHead, u, time.Now()); err != nil {
+		t.Error("failed asserting verification of HEAD. ", err)
+	}
+	if _, err := VerifySignedURL([]SigningKey{newKey}, http.MethodGet, u, time.Now().Add(2*time.Hour)); !errors.Is(err, ErrExpiredSignature) {
+		t.Error("failed asserting an expired url. ", err)
+	}
+	if _, err := VerifySignedURL([]SigningKey{newKey}, http.MethodDelete, u, time.Now()); !errors.Is(err, ErrInvalidSignature) {
+		t.Error("failed asserting the method is not allowed. ", err)
+	}
+	// the key was removed
+	if _, err := VerifySignedURL([]SigningKey{oldKey}, http.MethodGet, u, time.Now()); !errors.Is(err, ErrInvalidSignature) {
+		t.Error("failed asserting a removed key. ", err)
+	}
+
+	tampered := []func(u *url.URL){
+		func(u *url.URL) { u.Path = "/docs/other.pdf" },
+		func(u *url.URL) { q := u.Query(); q.Set("expires", "9999999999"); u.RawQuery = q.Encode() },
+		func(u *url.URL) { q := u.Query(); q.Set("disposition", "attachment"); u.RawQuery = q.Encode() },
+		func(u *url.URL) { q := u.Query(); q.Set("signature", "%%%"); u.RawQuery = q.Encode() },
+		func(u *url.URL) { q := u.Query(); q.Del("keyId"); u.RawQuery = q.Encode() },
+	}
+	for i, tamper := range tampered {
+		c := *u
+		tamper(&c)
+		if _, err := VerifySignedURL([]SigningKey{newKey}, http.MethodGet, &c, time.Now()); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("failed asserting tampered url %d. %v", i, err)
+		}
+	}
+}
+
+func TestSignedURLBinding(t *testing.T) {
+	l := NewWithOpts(t.TempDir(), Opts{SigningKeys: []SigningKey{newKey}})
+	l.Create("file.txt", []byte("content"))
+
+	signed, err := l.SignedURL("file.txt", time.Minute, SignedURLOpts{Method: "put", Disposition: "attachment"})
+	if err != nil {
+		t.Fatal("failed asserting signed url. ", err)
+	}
+	u, _ := url.Parse(signed)
+	if u.Path != "/file.txt" {
+		t.Errorf("failed asserting the url without a base: %s", signed)
+	}
+	opts, err := VerifySignedURL([]SigningKey{newKey}, http.MethodPut, u, time.Now())
+	if err != nil || opts.Method != http.MethodPut || opts.Disposition != "attachment" {
+		t.Errorf("failed asserting the bound options: %+v %v", opts, err)
+	}
+	if _, err := VerifySignedURL([]SigningKey{newKey}, http.MethodGet, u, time.Now()); !errors.Is(err, ErrInvalidSignature) {
+		t.Error("failed asserting the bound method. ", err)
+	}
+}
+
+func TestSignedURLErrors(t *testing.T) {
+	l := NewWithOpts(t.TempDir(), Opts{SigningKeys: []SigningKey{newKey}})
+	l.Create("file.txt", []byte("content"))
+	l.MakeDirectory("dir", 0755)
+
+	tests := []struct {
+		path string
+		ttl  time.Duration
+		opts SignedURLOpts
+		err  error
+	}{
+		{"missing.txt", time.Minute, SignedURLOpts{}, ErrNotFound},
+		{"dir", time.Minute, SignedURLOpts{}, ErrIsDirectory},
+		{"../file.txt", time.Minute, SignedURLOpts{}, ErrOutsideRoot},
+	}
+	for _, tt := range tests {
+		if _, err := l.SignedURL(tt.path, tt.ttl, tt.opts); !errors.Is(err, tt.err) {
+			t.Errorf("failed asserting the error of signing %s: %v", tt.path, err)
+		}
+	}
+	if _, err := l.SignedURL("file.txt", 0, SignedURLOpts{}); err == nil {
+		t.Error("failed asserting a zero ttl")
+	}
+	if _, err := l.SignedURL("file.txt", time.Minute, SignedURLOpts{Disposition: "download"}); err == nil {
+		t.Error("failed asserting an unknown disposition")
+	}
+	if _, err := New(t.TempDir()).SignedURL("file.txt", time.Minute, SignedURLOpts{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Error("failed asserting signing without keys. ", err)
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrTrashDisabled is returned by the trash
+// operations when no trash directory is set
+var ErrTrashDisabled = errors.New("trash is disabled")
+
+// TrashOpts options of the trash, it's enabled by setting
+// the directory the deleted entries are moved into
+type TrashOpts struct {
+	// Dir is the directory the deleted files and directories are moved
+	// into, it should be outside the root folder so the trash doesn't
+	// show up in the listings, the deleted entries aren't versioned
+	// as they can be restored from the trash
+	Dir string
+}
+
+// TrashEntry is a file or a directory moved into the trash
+type TrashEntry struct {
+	// ID identifies the entry in the trash, the IDs
+	// sort in the order the entries were deleted
+	ID string `json:"id"`
+	// Path is the path the entry was deleted from
+	Path        string    `json:"path"`
+	DeletedAt   time.Time `json:"deletedAt"`
+	IsDirectory bool      `json:"isDirectory"`
+	// Size is the size of the file or the total size of the
+	// files of the directory
+	Size int64 `json:"size"`
+}
+
+// the layout of the trash entries, each entry is a directory holding
+// the information about the entry and the deleted file or directory,
+// the entries being purged or restored are renamed with a prefix
+const (
+	trashIDLayout  = "20060102T150405.000000000Z"
+	trashInfo      = "info.json"
+	trashData      = "data"
+	trashPurging   = ".purging-"
+	trashRestoring = ".restoring-"
+)
+
+// Trash lists, restores and purges the deleted entries of a local storage
+type Trash struct {
+	l *LocalStorage
+}
+
+// Trash returns the trash of the local storage, its operations
+// return ErrTrashDisabled unless the trash is enabled in the options
+func (l *LocalStorage) Trash() *Trash {
+	return &Trash{l: l}
+}
+
+// List returns the entries in the trash, the most recently deleted
+// first, it returns an error incase there is any
+func (t *Trash) List() ([]TrashEntry, error) {
+	return t.ListCtx(context.Background())
+}
+
+// ListCtx is the context aware variant of List
+func (t *Trash) ListCtx(ctx context.Context) ([]TrashEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return []TrashEntry{}, err
+	}
+	if t.l.trash.Dir == "" {
+		return []TrashEntry{}, t.l.pathError("trash", ".", ErrTrashDisabled)
+	}
+
+	dirs, err := ioutil.ReadDir(t.l.trash.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TrashEntry{}, nil
+	}
+	if err != nil {
+		return []TrashEntry{}, t.l.pathError("trash", ".", err)
+	}
+
+	entries := []TrashEntry{}
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return []TrashEntry{}, err
+		}
+		if !validTrashID(dir.Name()) {
+			continue
+		}
+		entry, err := t.entry(dir.Name())
+		if err != nil {
+			// skip the entries still being moved into the trash,
+			// their information is written last
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+
+	return entries, nil
+}
+
+// Restore moves the given entry back to the path it was deleted from,
+// the missing parent directories are created, it fails with
+// ErrAlreadyExists if the path is taken, it returns the restored entry
+// and an error incase there is any
+func (t *Trash) Restore(id string) (TrashEntry, error) {
+	return t.RestoreCtx(context.Background(), id)
+}
+
+// RestoreCtx is the context aware variant of Restore
+func (t *Trash) RestoreCtx(ctx context.Context, id string) (TrashEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return TrashEntry{}, err
+	}
+	if t.l.trash.Dir == "" {
+		return TrashEntry{}, t.l.pathError("restore", id, ErrTrashDisabled)
+	}
+	if !validTrashID(id) {
+		return TrashEntry{}, t.l.pathError("restore", id, ErrNotFound)
+	}
+
+	// the entry is claimed under the lock and moved without it
+	t.l.trashMu.Lock()
+	entry, err := t.entry(id)
+	if err != nil {
+		t.l.trashMu.Unlock()
+		return TrashEntry{}, t.l.pathError("restore", id, err)
+	}
+	fullPath, err := t.l.resolve("restore", entry.Path)
+	if err != nil {
+		t.l.trashMu.Unlock()
+		return TrashEntry{}, err
+	}
+	entryDir, err := t.claim(trashRestoring, id)
+	t.l.trashMu.Unlock()
+	if err != nil {
+		return TrashEntry{}, t.l.pathError("restore", entry.Path, err)
+	}
+
+	if _, err := os.Lstat(fullPath); err == nil {
+		t.unclaim(trashRestoring, entry)
+		return TrashEntry{}, t.l.pathError("restore", entry.Path, ErrAlreadyExists)
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.unclaim(trashRestoring, entry)
+		return TrashEntry{}, t.l.pathError("restore", entry.Path, err)
+	}
+	if err := moveEntry(filepath.Join(entryDir, trashData), fullPath); err != nil {
+		t.unclaim(trashRestoring, entry)
+		return TrashEntry{}, t.l.pathError("restore", entry.Path, err)
+	}
+
+	return entry, t.l.pathError("restore", entry.Path, os.RemoveAll(entryDir))
+}
+
+// Purge removes permanently the entries deleted longer than the given
+// duration ago, zero empties the trash, it returns the removed entries
+// and an error incase there is any
+func (t *Trash) Purge(olderThan time.Duration) ([]TrashEntry, error) {
+	return t.PurgeCtx(context.Background(), olderThan)
+}
+
+// PurgeCtx is the context aware variant of Purge,
+// it stops before removing the next entry once the context is done
+func (t *Trash) PurgeCtx(ctx context.Context, olderThan time.Duration) ([]TrashEntry, error) {
+	// the entries are listed and claimed under the lock, so the ones being
+	// moved into the trash are left out, and removed without it
+	t.l.trashMu.Lock()
+	entries, err := t.ListCtx(ctx)
+	if err != nil {
+		t.l.trashMu.Unlock()
+		return []TrashEntry{}, err
+	}
+	claimed := []TrashEntry{}
+	for _, entry := range entries {
+		if now().Sub(entry.DeletedAt) < olderThan {
+			continue
+		}
+		if _, err := t.claim(trashPurging, entry.ID); err != nil {
+			t.l.trashMu.Unlock()
+			t.unclaim(trashPurging, claimed...)
+			return []TrashEntry{}, t.l.pathError("purge", entry.Path, err)
+		}
+		claimed = append(claimed, entry)
+	}
+	t.l.trashMu.Unlock()
+
+	purged := []TrashEntry{}
+	for i, entry := range claimed {
+		if err := t.l.removeAll(ctx, filepath.Join(t.l.trash.Dir, trashPurging+entry.ID)); err != nil {
+			t.unclaim(trashPurging, claimed[i:]...)
+			return purged, t.l.pathError("purge", entry.Path, err)
+		}
+		purged = append(purged, entry)
+	}
+
+	return purged, nil
+}
+
+// SchedulePurge purges the entries deleted longer than olderThan ago
+// every interval until the returned function is called, the stop
+// function waits for a running purge to finish, the errors of the
+// purges are passed to onError when it's set
+func (t *Trash) SchedulePurge(interval time.Duration, olderThan time.Duration, onError func(error)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := t.PurgeCtx(ctx, olderThan)
+				if err != nil && ctx.Err() == nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+// entry reads the information about the given entry
+func (t *Trash) entry(id string) (TrashEntry, error) {
+	entryDir := filepath.Join(t.l.trash.Dir, id)
+	if _, err := os.Lstat(filepath.Join(entryDir, trashData)); err != nil {
+		return TrashEntry{}, err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(entryDir, trashInfo))
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	entry := TrashEntry{}
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return TrashEntry{}, err
+	}
+	entry.ID = id
+
+	return entry, nil
+}
+
+// claim renames the entry to a private name starting with the given
+// prefix, so the other operations leave it out while it's restored or
+// purged without the lock, the caller must hold the lock
+func (t *Trash) claim(prefix string, id string) (string, error) {
+	claimed := filepath.Join(t.l.trash.Dir, prefix+id)
+
+	return claimed, os.Rename(filepath.Join(t.l.trash.Dir, id), claimed)
+}
+
+// unclaim gives the claimed entries back to the trash
+// once their restore or their purge failed
+func (t *Trash) unclaim(prefix string, entries ...TrashEntry) {
+	t.l.trashMu.Lock()
+	defer t.l.trashMu.Unlock()
+
+	for _, entry := range entries {
+		os.Rename(filepath.Join(t.l.trash.Dir, prefix+entry.ID), filepath.Join(t.l.trash.Dir, entry.ID))
+	}
+}
+
+// moveToTrash moves the file or the directory into a new entry of the
+// trash recording the path it was deleted from, the information is
+// written once the entry is moved so the entries without it are
+// skipped, the entry is moved back when it can't be written
+func (l *LocalStorage) moveToTrash(filePath string, fullPath string, info fs.FileInfo) error {
+	rel, _ := cleanRelative(filePath)
+	entry := TrashEntry{Path: rel, DeletedAt: now().UTC(), IsDirectory: info.IsDir(), Size: info.Size()}
+	if info.IsDir() {
+		entry.Size = 0
+		filepath.Walk(fullPath, func(_ string, info fs.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				entry.Size += info.Size()
+			}
+			return nil
+		})
+	}
+
+	l.trashMu.Lock()
+	defer l.trashMu.Unlock()
+
+	if err := os.MkdirAll(l.trash.Dir, 0755); err != nil {
+		return err
+	}
+	entryDir, err := createTrashEntry(l.trash.Dir, entry.DeletedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID = filepath.Base(entryDir)
+
+	dataPath := filepath.Join(entryDir, trashData)
+	if err := moveEntry(fullPath, dataPath); err != nil {
+		os.RemoveAll(entryDir)
+		return err
+	}
+	content, err := json.Marshal(entry)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(entryDir, trashInfo), content, 0644)
+	}
+	if err != nil {
+		if moveEntry(dataPath, fullPath) == nil {
+			os.RemoveAll(entryDir)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// createTrashEntry creates the directory of a new entry, the ID is the
+// time of the deletion followed by a random suffix
+func createTrashEntry(dir string, deletedAt time.Time) (string, error) {
+	for {
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		entryDir := filepath.Join(dir, deletedAt.Format(trashIDLayout)+"-"+hex.EncodeToString(suffix))
+		err := os.Mkdir(entryDir, 0755)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+
+		return entryDir, err
+	}
+}
+
+// validTrashID reports whether the given id is the id of a trash entry,
+// so the ids can't point outside the trash
+func validTrashID(id string) bool {
+	stamp := len(trashIDLayout)
+	if len(id) != stamp+9 || id[stamp] != '-' {
+		return false
+	}
+	if _, err := time.Parse(trashIDLayout, id[:stamp]); err != nil {
+		return false
+	}
+	_, err := hex.DecodeString(id[stamp+1:])
+
+	return err == nil
+}
+
+// moveEntry renames the file or the directory, when the destination is
+// on another device it's copied and the source is removed
+func moveEntry(src string, dest string) error {
+	err := rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyTree(src, dest); err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// copyTree copies the file or the directory with its modes,
+// its modification times and its symlinks
+func copyTree(src string, dest string) error {
+	dirs := []string{}
+	err := filepath.Walk(src, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, rel)
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+
+		return copyExclusive(p, target)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the modification times of the directories change while their
+	// content is copied, so they're set deepest first at the end
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Stat(filepath.Join(src, dirs[i]))
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(filepath.Join(dest, dirs[i]), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
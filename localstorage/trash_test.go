@@ -0,0 +1,379 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+// newTrashed returns a local storage keeping its trash next to the root folder
+func newTrashed(t *testing.T) *LocalStorage {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+
+	return NewWithOpts(root, Opts{Trash: TrashOpts{Dir: filepath.Join(dir, "trash")}})
+}
+
+func TestTrash(t *testing.T) {
+	l := newTrashed(t)
+	l.Create("a.txt", []byte("a"))
+	l.Create("b.txt", []byte("b"))
+	l.Create("customers/acme/report.txt", []byte("report"))
+	l.Create("customers/acme/data/rows.csv", []byte("1,2"))
+
+	if err := l.Delete("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	l.DeleteMultiple([]string{"b.txt", "missing.txt"})
+	if err := l.DeleteDirectory("customers/acme"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := l.Exists("a.txt"); exists {
+		t.Error("failed asserting the deleted file is gone")
+	}
+	if dirs, _ := l.Directories("customers"); len(dirs) != 0 {
+		t.Error("failed asserting the deleted directory is gone. ", dirs)
+	}
+
+	entries, err := l.Trash().List()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("failed asserting the trash entries: %v %v", entries, err)
+	}
+	dir := entries[0]
+	if dir.Path != "customers/acme" || !dir.IsDirectory || dir.Size != 9 || dir.DeletedAt.IsZero() || entries[2].Path != "a.txt" {
+		t.Errorf("failed asserting the trash entry: %+v", entries)
+	}
+
+	if _, err := l.Trash().Restore(dir.ID); err != nil {
+		t.Fatal("failed asserting restore of a directory. ", err)
+	}
+	if content, _ := l.Read("customers/acme/data/rows.csv"); string(content) != "1,2" {
+		t.Errorf("failed asserting the restored directory: %s", content)
+	}
+
+	l.Create("a.txt", []byte("new a"))
+	if _, err := l.Trash().Restore(entries[2].ID); !errors.Is(err, ErrAlreadyExists) {
+		t.Error("failed asserting restore over an existing file. ", err)
+	}
+	if _, err := l.Trash().Restore("../root"); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting restore of an invalid id. ", err)
+	}
+	if _, err := l.Trash().Restore(dir.ID); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting restore of a restored entry. ", err)
+	}
+	if err := l.DeleteDirectory("."); !errors.Is(err, ErrOutsideRoot) {
+		t.Error("failed asserting the root folder isn't trashed. ", err)
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	current := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	defer SetNow(func() time.Time { return current })()
+
+	l := newTrashed(t)
+	l.Create("old.txt", []byte("old"))
+	l.Create("new.txt", []byte("new"))
+	l.Delete("old.txt")
+	current = current.Add(2 * time.Hour)
+	l.Delete("new.txt")
+
+	purged, err := l.Trash().Purge(time.Hour)
+	if err != nil || len(purged) != 1 || purged[0].Path != "old.txt" {
+		t.Fatalf("failed asserting the purge: %v %v", purged, err)
+	}
+	if entries, _ := l.Trash().List(); len(entries) != 1 || entries[0].Path != "new.txt" {
+		t.Errorf("failed asserting the remaining entries: %v", entries)
+	}
+	if purged, _ := l.Trash().Purge(0); len(purged) != 1 {
+		t.Errorf("failed asserting emptying the trash: %v", purged)
+	}
+}
+
+func TestTrashIncompleteEntries(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	l := NewWithOpts(root, Opts{Trash: TrashOpts{Dir: filepath.Join(dir, "trash")}})
+	l.Create("a.txt", []byte("a"))
+	l.Delete("a.txt")
+	entries, _ := l.Trash().List()
+
+	// an entry whose information isn't written yet
+	id := entries[0].ID
+	incomplete := filepath.Join(dir, "trash", id[:len(id)-8]+"00000000")
+	os.MkdirAll(filepath.Join(incomplete, "data"), 0755)
+
+	if entries, _ := l.Trash().List(); len(entries) != 1 {
+		t.Errorf("failed asserting the incomplete entry is skipped: %v", entries)
+	}
+	if purged, err := l.Trash().Purge(0); err != nil || len(purged) != 1 {
+		t.Errorf("failed asserting the purge: %v %v", purged, err)
+	}
+	if _, err := os.Stat(incomplete); err != nil {
+		t.Error("failed asserting the incomplete entry is left to its move. ", err)
+	}
+}
+
+func TestTrashConcurrentPurge(t *testing.T) {
+	// copying the entries makes the moves slower than a rename
+	defer SetRename(func(oldpath string, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	})()
+
+	l := newTrashed(t)
+	for i := 0; i < 20; i++ {
+		l.Create(fmt.Sprintf("dir%d/file.txt", i), []byte("content"))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- l.DeleteDirectory(fmt.Sprintf("dir%d", i))
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	purged := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		entries, err := l.Trash().Purge(0)
+		if err != nil {
+			t.Fatal("failed asserting the purge. ", err)
+		}
+		purged += len(entries)
+	}
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error("failed asserting the delete. ", err)
+		}
+	}
+	if purged != 20 {
+		t.Errorf("failed asserting every entry is purged once: %d", purged)
+	}
+}
+
+// claimedContext blocks the purge once it has claimed its entries,
+// so the trash can be used while the entries are removed, then
+// it reports the given error
+type claimedContext struct {
+	context.Context
+	trashDir string
+	blocked  chan struct{}
+	release  chan struct{}
+	err      error
+	once     sync.Once
+}
+
+func newClaimedContext(trashDir string, err error) *claimedContext {
+	return &claimedContext{Context: context.Background(), trashDir: trashDir, blocked: make(chan struct{}), release: make(chan struct{}), err: err}
+}
+
+func (c *claimedContext) Err() error {
+	if claimed, _ := filepath.Glob(filepath.Join(c.trashDir, ".purging-*")); len(claimed) == 0 {
+		return nil
+	}
+	c.once.Do(func() {
+		close(c.blocked)
+		<-c.release
+	})
+
+	return c.err
+}
+
+func TestTrashPurgeWithoutLock(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	l := NewWithOpts(root, Opts{Trash: TrashOpts{Dir: filepath.Join(dir, "trash")}})
+	l.Create("a.txt", []byte("a"))
+	l.Create("b.txt", []byte("b"))
+	l.Delete("a.txt")
+
+	ctx := newClaimedContext(filepath.Join(dir, "trash"), nil)
+	result := make(chan []TrashEntry, 1)
+	go func() {
+		purged, err := l.Trash().PurgeCtx(ctx, 0)
+		if err != nil {
+			t.Error("failed asserting the purge. ", err)
+		}
+		result <- purged
+	}()
+	select {
+	case <-ctx.blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed asserting the purge claims its entries")
+	}
+
+	deleted := make(chan error, 1)
+	go func() { deleted <- l.Delete("b.txt") }()
+	select {
+	case err := <-deleted:
+		if err != nil {
+			t.Error("failed asserting the delete. ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed asserting the delete doesn't wait for the purge")
+	}
+	if entries, _ := l.Trash().List(); len(entries) != 1 || entries[0].Path != "b.txt" {
+		t.Errorf("failed asserting the claimed entry is left out: %v", entries)
+	}
+
+	close(ctx.release)
+	if purged := <-result; len(purged) != 1 || purged[0].Path != "a.txt" {
+		t.Errorf("failed asserting the purged entries: %v", purged)
+	}
+}
+
+func TestTrashPurgeCanceled(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	l := NewWithOpts(root, Opts{Trash: TrashOpts{Dir: filepath.Join(dir, "trash")}})
+	l.Create("a.txt", []byte("a"))
+	l.Delete("a.txt")
+
+	// the purge is canceled once it has claimed the entry
+	ctx := newClaimedContext(filepath.Join(dir, "trash"), context.Canceled)
+	close(ctx.release)
+	if _, err := l.Trash().PurgeCtx(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting the canceled purge. ", err)
+	}
+	if entries, _ := l.Trash().List(); len(entries) != 1 {
+		t.Errorf("failed asserting the entries are kept: %v", entries)
+	}
+}
+
+func TestTrashSchedulePurge(t *testing.T) {
+	l := newTrashed(t)
+	l.Create("a.txt", []byte("a"))
+	l.Delete("a.txt")
+
+	stop := l.Trash().SchedulePurge(10*time.Millisecond, 0, func(err error) { t.Error(err) })
+	defer stop()
+	for i := 0; i < 100; i++ {
+		if entries, _ := l.Trash().List(); len(entries) == 0 {
+			stop()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("failed asserting the scheduled purge")
+}
+
+func TestTrashAcrossDevices(t *testing.T) {
+	defer SetRename(func(oldpath string, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	})()
+
+	l := newTrashed(t)
+	l.Create("docs/guide/intro.md", []byte("intro"))
+	if err := l.DeleteDirectory("docs"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := l.Trash().List()
+	if _, err := l.Trash().Restore(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := l.Read("docs/guide/intro.md"); string(content) != "intro" {
+		t.Errorf("failed asserting the copied entry: %s", content)
+	}
+}
+
+func TestTrashRestoreWithoutLock(t *testing.T) {
+	l := newTrashed(t)
+	l.Create("a.txt", []byte("a"))
+	l.Create("b.txt", []byte("b"))
+	l.Delete("a.txt")
+	entries, _ := l.Trash().List()
+
+	// the restore blocks in its move out of the trash
+	blocked, release := make(chan struct{}), make(chan struct{})
+	defer SetRename(func(oldpath string, newpath string) error {
+		if filepath.Base(newpath) == "a.txt" {
+			close(blocked)
+			<-release
+		}
+		return os.Rename(oldpath, newpath)
+	})()
+	restored := make(chan error, 1)
+	go func() {
+		_, err := l.Trash().Restore(entries[0].ID)
+		restored <- err
+	}()
+	<-blocked
+
+	deleted := make(chan error, 1)
+	go func() { deleted <- l.Delete("b.txt") }()
+	select {
+	case err := <-deleted:
+		if err != nil {
+			t.Error("failed asserting the delete. ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed asserting the delete doesn't wait for the restore")
+	}
+
+	close(release)
+	if err := <-restored; err != nil {
+		t.Error("failed asserting the restore. ", err)
+	}
+	if content, _ := l.Read("a.txt"); string(content) != "a" {
+		t.Errorf("failed asserting the restored file: %s", content)
+	}
+	if entries, _ := l.Trash().List(); len(entries) != 1 || entries[0].Path != "b.txt" {
+		t.Errorf("failed asserting the remaining entries: %v", entries)
+	}
+}
+
+func TestTrashDisabled(t *testing.T) {
+	l := New(t.TempDir())
+	if _, err := l.Trash().List(); !errors.Is(err, ErrTrashDisabled) {
+		t.Error("failed asserting the disabled trash. ", err)
+	}
+}
+
+func TestTrashDeleteMultipleErrors(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	// the trash can't be created over a file
+	ioutil.WriteFile(filepath.Join(dir, "trash"), []byte("file"), 0644)
+	l := NewWithOpts(root, Opts{Trash: TrashOpts{Dir: filepath.Join(dir, "trash")}})
+	l.Create("a.txt", []byte("a"))
+
+	if err := l.DeleteMultiple([]string{"a.txt"}); err == nil {
+		t.Error("failed asserting the failed move into the trash is reported")
+	}
+	if exists, _ := l.Exists("a.txt"); !exists {
+		t.Error("failed asserting the file stays when it can't be trashed")
+	}
+
+	if err := l.DeleteMultiple([]string{"a.txt/b.txt"}); err == nil {
+		t.Error("failed asserting a path that can't be stat-ed is reported")
+	}
+}
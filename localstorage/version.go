@@ -0,0 +1,357 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrVersioningDisabled is returned by the versions
+// operations when no versions directory is set
+var ErrVersioningDisabled = errors.New("versioning is disabled")
+
+// VersioningOpts options of the versioning, it's enabled by setting
+// the directory the versions are kept in
+type VersioningOpts struct {
+	// Dir is the directory the versions are kept in, the versions of a
+	// file are kept under its path within this directory, it should be
+	// outside the root folder so the versions don't show up in the listings
+	Dir string
+	// MaxVersions caps the number of versions kept for each file, the
+	// oldest versions are removed first, zero keeps all of them
+	MaxVersions int
+	// MaxAge removes the versions kept longer than the given duration,
+	// zero keeps them regardless of their age
+	MaxAge time.Duration
+}
+
+// Version is a prior content of a file kept when the file
+// was overwritten, deleted, moved or renamed
+type Version struct {
+	// ID identifies the version among the versions of the file,
+	// the IDs sort in the order the versions were kept
+	ID string
+	// Path is the path of the file the version belongs to
+	Path string
+	// Created is the time the version was kept
+	Created time.Time
+	// LastModified is the modification time of the content
+	LastModified time.Time
+	Size         int64
+}
+
+// versionIDLayout is the layout of the version IDs, they
+// are the UTC time the versions were kept
+const versionIDLayout = "20060102T150405.000000000Z"
+
+// now returns the current time, it's replaced by the tests
+var now = time.Now
+
+// Versions returns the versions of the given file newest first, a file
+// without versions has an empty list, it returns an error incase there is any
+func (l *LocalStorage) Versions(filePath string) ([]Version, error) {
+	return l.VersionsCtx(context.Background(), filePath)
+}
+
+// VersionsCtx is the context aware variant of Versions
+func (l *LocalStorage) VersionsCtx(ctx context.Context, filePath string) ([]Version, error) {
+	if err := ctx.Err(); err != nil {
+		return []Version{}, err
+	}
+
+	dir, rel, err := l.versionsDir("versions", filePath)
+	if err != nil {
+		return []Version{}, err
+	}
+	versions, err := listVersions(dir, rel)
+	if err != nil {
+		return []Version{}, l.pathError("versions", filePath, err)
+	}
+
+	return versions, nil
+}
+
+// ReadVersion reads the content of the given version of the file,
+// it returns an error incase there is any
+func (l *LocalStorage) ReadVersion(filePath string, id string) ([]byte, error) {
+	return l.ReadVersionCtx(context.Background(), filePath, id)
+}
+
+// ReadVersionCtx is the context aware variant of ReadVersion
+func (l *LocalStorage) ReadVersionCtx(ctx context.Context, filePath string, id string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	versionPath, err := l.versionPath("readversion", filePath, id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(versionPath)
+	if err != nil {
+		return nil, l.pathError("readversion", filePath, err)
+	}
+
+	return content, nil
+}
+
+// Restore writes the content of the given version back to the file
+// with its modification time, the current content of the file is kept
+// as a new version, it returns an error incase there is any
+func (l *LocalStorage) Restore(filePath string, id string) error {
+	return l.RestoreCtx(context.Background(), filePath, id)
+}
+
+// RestoreCtx is the context aware variant of Restore
+func (l *LocalStorage) RestoreCtx(ctx context.Context, filePath string, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	versionPath, err := l.versionPath("restore", filePath, id)
+	if err != nil {
+		return err
+	}
+	version, err := os.Open(versionPath)
+	if err != nil {
+		return l.pathError("restore", filePath, err)
+	}
+	defer version.Close()
+	s, err := version.Stat()
+	if err != nil {
+		return l.pathError("restore", filePath, err)
+	}
+
+	if _, err := l.writeWith(ctx, filePath, version, Overwrite, s.ModTime()); err != nil {
+		return err
+	}
+	fullPath, err := l.resolve("restore", filePath)
+	if err != nil {
+		return err
+	}
+
+	return l.pathError("restore", filePath, os.Chtimes(fullPath, s.ModTime(), s.ModTime()))
+}
+
+// PruneVersions applies the retention policy to the versions of all
+// files, the versions are otherwise pruned only when a new version of
+// the same file is kept, it returns an error incase there is any
+func (l *LocalStorage) PruneVersions() error {
+	return l.PruneVersionsCtx(context.Background())
+}
+
+// PruneVersionsCtx is the context aware variant of PruneVersions,
+// it stops as soon as the context is done
+func (l *LocalStorage) PruneVersionsCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.versioning.Dir == "" {
+		return l.pathError("pruneversions", ".", ErrVersioningDisabled)
+	}
+
+	err := filepath.Walk(l.versioning.Dir, func(dir string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return l.pruneVersions(dir)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		// nothing was kept yet
+		return nil
+	}
+
+	return l.pathError("pruneversions", ".", err)
+}
+
+// keepVersion keeps the current content of the file as a version before
+// it's replaced or removed, the file is linked into the versions so no
+// content is copied, unless it's shared with a file that stays in use
+// as appending to it would change the version, or the versions are on
+// another file system, nothing is kept when the versioning is disabled
+func (l *LocalStorage) keepVersion(filePath string, fullPath string, shared bool) error {
+	if l.versioning.Dir == "" {
+		return nil
+	}
+
+	dir, _, err := l.versionsDir("version", filePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	created := now().UTC()
+	for {
+		versionPath := filepath.Join(dir, created.Format(versionIDLayout))
+		if shared {
+			err = copyExclusive(fullPath, versionPath)
+		} else if err = os.Link(fullPath, versionPath); err != nil && !errors.Is(err, fs.ErrExist) && !errors.Is(err, fs.ErrNotExist) {
+			// the versions are on another file system
+			err = copyExclusive(fullPath, versionPath)
+		}
+		if errors.Is(err, fs.ErrExist) {
+			// kept within the same nanosecond
+			created = created.Add(time.Nanosecond)
+			continue
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed in the meantime, there is nothing to keep
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	// the retention is best effort, it's applied again with the next version
+	l.pruneVersions(dir)
+
+	return nil
+}
+
+// pruneVersions removes the versions in the given directory that exceed
+// the maximum number of versions or the maximum age
+func (l *LocalStorage) pruneVersions(dir string) error {
+	if l.versioning.MaxVersions <= 0 && l.versioning.MaxAge <= 0 {
+		return nil
+	}
+
+	versions, err := listVersions(dir, "")
+	if err != nil {
+		return err
+	}
+	for i, version := range versions {
+		tooMany := l.versioning.MaxVersions > 0 && i >= l.versioning.MaxVersions
+		tooOld := l.versioning.MaxAge > 0 && now().Sub(version.Created) > l.versioning.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, version.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// versionsDir returns the directory of the versions of the given file
+// and the path of the file relative to the root folder
+func (l *LocalStorage) versionsDir(op string, filePath string) (string, string, error) {
+	if l.versioning.Dir == "" {
+		return "", "", l.pathError(op, filePath, ErrVersioningDisabled)
+	}
+	rel, ok := cleanRelative(filePath)
+	if !ok || rel == "." {
+		return "", "", &PathError{Op: op, Disk: l.name, Path: filePath, Err: ErrOutsideRoot}
+	}
+
+	return filepath.Join(l.versioning.Dir, filepath.FromSlash(rel)), rel, nil
+}
+
+// versionPath returns the path of the given version of the file,
+// an invalid id is reported as a missing version
+func (l *LocalStorage) versionPath(op string, filePath string, id string) (string, error) {
+	dir, _, err := l.versionsDir(op, filePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := time.Parse(versionIDLayout, id); err != nil {
+		return "", l.pathError(op, filePath, ErrNotFound)
+	}
+	versionPath := filepath.Join(dir, id)
+	s, err := os.Stat(versionPath)
+	if err != nil {
+		return "", l.pathError(op, filePath, err)
+	}
+	if err := checkRegular(s); err != nil {
+		return "", l.pathError(op, filePath, err)
+	}
+
+	return versionPath, nil
+}
+
+// listVersions lists the versions in the given directory newest first,
+// the entries that aren't versions, like the directories of the
+// files below the path of the file, are skipped
+func listVersions(dir string, filePath string) ([]Version, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Version{}, nil
+	}
+	if err != nil {
+		return []Version{}, err
+	}
+
+	versions := []Version{}
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		created, err := time.Parse(versionIDLayout, entry.Name())
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{
+			ID:           entry.Name(),
+			Path:         filePath,
+			Created:      created,
+			LastModified: entry.ModTime(),
+			Size:         entry.Size(),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+
+	return versions, nil
+}
+
+// copyExclusive copies the file to the destination failing if the
+// destination exists, the mode and the modification time are kept
+func copyExclusive(fullPath string, destPath string) error {
+	src, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	s, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, s.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyBuffer(dest, src, make([]byte, copyBufferSize))
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(destPath, s.ModTime(), s.ModTime())
+	}
+	if err != nil {
+		os.Remove(destPath)
+	}
+
+	return err
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package localstorage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage/localstorage"
+)
+
+// newVersioned returns a local storage keeping its versions next
+// to the root folder, and the root folder
+func newVersioned(t *testing.T, opts VersioningOpts) (*LocalStorage, string) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	opts.Dir = filepath.Join(dir, "versions")
+	os.Mkdir(root, 0755)
+
+	return NewWithOpts(root, Opts{Versioning: opts}), root
+}
+
+// contents reads the content of all the versions of the file
+func contents(t *testing.T, l *LocalStorage, file string) []string {
+	versions, err := l.Versions(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []string{}
+	for _, v := range versions {
+		content, err := l.ReadVersion(file, v.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, string(content))
+	}
+
+	return result
+}
+
+func TestVersions(t *testing.T) {
+	l, root := newVersioned(t, VersioningOpts{})
+	l.Create("docs/a.txt", []byte("one"))
+	if versions, err := l.Versions("docs/a.txt"); err != nil || len(versions) != 0 {
+		t.Errorf("failed asserting no versions of a new file: %v %v", versions, err)
+	}
+
+	modTime := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(root, "docs", "a.txt"), modTime, modTime)
+	l.CreateWith("docs/a.txt", []byte("two!"), Overwrite)
+	l.WriteStreamWith("docs/a.txt", strings.NewReader("three"), Overwrite)
+
+	versions, err := l.Versions("docs/a.txt")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("failed asserting the versions of overwrites: %v %v", versions, err)
+	}
+	if versions[0].Size != 4 || versions[0].Path != "docs/a.txt" || !versions[1].LastModified.Equal(modTime) || !versions[0].Created.After(versions[1].Created) {
+		t.Errorf("failed asserting the version information: %+v", versions)
+	}
+	if got := contents(t, l, "docs/a.txt"); len(got) != 2 || got[0] != "two!" || got[1] != "one" {
+		t.Errorf("failed asserting the versions content: %v", got)
+	}
+
+	// an overwrite failing with the Fail policy keeps nothing
+	l.Create("docs/a.txt", []byte("four"))
+	if got := contents(t, l, "docs/a.txt"); len(got) != 2 {
+		t.Errorf("failed asserting a failed write keeps no version: %v", got)
+	}
+	if _, err := l.ReadVersion("docs/a.txt", "20210601T100000.000000000Z"); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting reading a missing version. ", err)
+	}
+	if _, err := l.ReadVersion("docs/a.txt", "../../a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting reading an invalid version. ", err)
+	}
+	if _, err := l.Versions("../a.txt"); !errors.Is(err, ErrOutsideRoot) {
+		t.Error("failed asserting versions outside the root. ", err)
+	}
+}
+
+func TestVersionsOfDeleteMoveAndRename(t *testing.T) {
+	l, _ := newVersioned(t, VersioningOpts{})
+	l.Create("a.txt", []byte("a"))
+	l.Create("b.txt", []byte("b"))
+	l.Create("c.txt", []byte("c"))
+	l.Create("d.txt", []byte("d"))
+	l.Create("e.txt", []byte("e"))
+
+	if err := l.Delete("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	l.DeleteMultiple([]string{"b.txt"})
+	if err := l.Move("c.txt", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rename("d.txt", "e.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c", "d.txt": "d", "e.txt": "e"}
+	for file, content := range expected {
+		if got := contents(t, l, file); len(got) != 1 || got[0] != content {
+			t.Errorf("failed asserting the version of %s: %v", file, got)
+		}
+	}
+
+	// appending to the renamed file leaves its version as it was
+	l.Append("e.txt", []byte(" appended"))
+	if got := contents(t, l, "d.txt"); got[0] != "d" {
+		t.Errorf("failed asserting the version of a renamed file is a copy: %v", got)
+	}
+}
+
+func TestVersionsOfRenameOntoItself(t *testing.T) {
+	l, _ := newVersioned(t, VersioningOpts{})
+	l.Create("a.txt", []byte("a"))
+
+	for _, newPath := range []string{"a.txt", "/a.txt", "docs/../a.txt"} {
+		if _, err := l.RenameWith("a.txt", newPath, Overwrite); err != nil {
+			t.Fatalf("failed asserting renaming onto %s: %v", newPath, err)
+		}
+	}
+	if versions, err := l.Versions("a.txt"); err != nil || len(versions) != 0 {
+		t.Errorf("failed asserting no versions of a file renamed onto itself: %v %v", versions, err)
+	}
+
+	// the live file isn't linked into the versions
+	l.Append("a.txt", []byte(" appended"))
+	if content, _ := l.Read("a.txt"); string(content) != "a appended" {
+		t.Errorf("failed asserting the content of the file: %q", content)
+	}
+	if got := contents(t, l, "a.txt"); len(got) != 0 {
+		t.Errorf("failed asserting no versions after appending: %v", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	l, root := newVersioned(t, VersioningOpts{})
+	l.Create("a.txt", []byte("one"))
+	modTime := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(root, "a.txt"), modTime, modTime)
+	l.Delete("a.txt")
+
+	versions, _ := l.Versions("a.txt")
+	if err := l.Restore("a.txt", versions[0].ID); err != nil {
+		t.Fatal("failed asserting restore of a deleted file. ", err)
+	}
+	info, _ := l.FileInfo("a.txt")
+	if content, _ := l.Read("a.txt"); string(content) != "one" || !info.LastModified.Equal(modTime) {
+		t.Errorf("failed asserting the restored file: %s %v", content, info.LastModified)
+	}
+
+	l.CreateWith("a.txt", []byte("two"), Overwrite)
+	if err := l.Restore("a.txt", versions[0].ID); err != nil {
+		t.Fatal("failed asserting restore over a file. ", err)
+	}
+	if content, _ := l.Read("a.txt"); string(content) != "one" {
+		t.Errorf("failed asserting the restored content: %s", content)
+	}
+	if got := contents(t, l, "a.txt"); len(got) != 3 || got[0] != "two" {
+		t.Errorf("failed asserting the replaced content is kept: %v", got)
+	}
+	if err := l.Restore("a.txt", "20210601T100000.000000000Z"); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting restore of a missing version. ", err)
+	}
+}
+
+func TestVersionsRetention(t *testing.T) {
+	current := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	defer SetNow(func() time.Time { return current })()
+
+	l, _ := newVersioned(t, VersioningOpts{MaxVersions: 2})
+	l.Create("a.txt", []byte("0"))
+	for _, content := range []string{"1", "2", "3"} {
+		current = current.Add(time.Minute)
+		l.CreateWith("a.txt", []byte(content), Overwrite)
+	}
+	if got := contents(t, l, "a.txt"); len(got) != 2 || got[0] != "2" || got[1] != "1" {
+		t.Errorf("failed asserting the maximum number of versions: %v", got)
+	}
+
+	l, _ = newVersioned(t, VersioningOpts{MaxAge: time.Hour})
+	l.Create("a.txt", []byte("0"))
+	l.Create("b.txt", []byte("0"))
+	l.CreateWith("a.txt", []byte("1"), Overwrite)
+	l.CreateWith("b.txt", []byte("1"), Overwrite)
+	current = current.Add(30 * time.Minute)
+	l.CreateWith("a.txt", []byte("2"), Overwrite)
+	current = current.Add(45 * time.Minute)
+	l.CreateWith("a.txt", []byte("3"), Overwrite)
+	if got := contents(t, l, "a.txt"); len(got) != 2 || got[0] != "2" || got[1] != "1" {
+		t.Errorf("failed asserting the maximum age: %v", got)
+	}
+
+	// the versions of the files that don't change are pruned by PruneVersions
+	if got := contents(t, l, "b.txt"); len(got) != 1 {
+		t.Errorf("failed asserting the versions aren't pruned yet: %v", got)
+	}
+	if err := l.PruneVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, l, "b.txt"); len(got) != 0 {
+		t.Errorf("failed asserting PruneVersions: %v", got)
+	}
+}
+
+func TestVersioningDisabled(t *testing.T) {
+	l := New(t.TempDir())
+	l.Create("a.txt", []byte("one"))
+	l.CreateWith("a.txt", []byte("two"), Overwrite)
+
+	if _, err := l.Versions("a.txt"); !errors.Is(err, ErrVersioningDisabled) {
+		t.Error("failed asserting versions without versioning. ", err)
+	}
+	if err := l.PruneVersions(); !errors.Is(err, ErrVersioningDisabled) {
+		t.Error("failed asserting prune without versioning. ", err)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package memstorage_test
+
+import (
+	"testing"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/memstorage"
+	"github.com/harranali/stowage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.RunConformance(t, func() stowage.Disk {
+		return New()
+	})
+}
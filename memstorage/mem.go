@@ -0,0 +1,793 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package memstorage provides an in-memory implementation of
+// stowage.Disk, it keeps the same semantics as the local storage
+// which makes it a fast replacement for the file system in tests
+package memstorage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+)
+
+// make sure the memory storage supports all operations
+var (
+	_ stowage.Disk      = (*MemStorage)(nil)
+	_ stowage.RangeDisk = (*MemStorage)(nil)
+)
+
+// MemStorage memory storage, it's safe for concurrent use
+type MemStorage struct {
+	name         string
+	contentTypes map[string]string
+	mu           sync.RWMutex
+	nodes        map[string]*node
+}
+
+// Opts options for initiating memory storage
+type Opts struct {
+	// Name identifies the disk in the returned errors,
+	// it defaults to "memory"
+	Name string
+	// ContentTypes maps extensions without the dot to content types,
+	// they take precedence over the built-in table
+	ContentTypes map[string]string
+}
+
+// node is a file or a directory, it's keyed by its path
+// relative to the root, the root itself is keyed by "."
+type node struct {
+	isDir   bool
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+// New initiate memory storage
+func New() *MemStorage {
+	return NewWithOpts(Opts{})
+}
+
+// NewWithOpts initiate memory storage with the given options
+func NewWithOpts(opts Opts) *MemStorage {
+	if opts.Name == "" {
+		opts.Name = "memory"
+	}
+
+	return &MemStorage{
+		name:         opts.Name,
+		contentTypes: opts.ContentTypes,
+		nodes: map[string]*node{
+			".": {isDir: true, mode: fs.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+// Name returns the name of the disk
+func (m *MemStorage) Name() string {
+	return m.name
+}
+
+// FileInfo returns information about the given file or an error incase there is any
+func (m *MemStorage) FileInfo(filePath string) (fileinfo localstorage.FileInfo, err error) {
+	rel, err := m.resolve("fileinfo", filePath)
+	if err != nil {
+		return localstorage.FileInfo{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return localstorage.FileInfo{}, m.pathError("fileinfo", filePath, stowage.ErrNotFound)
+	}
+
+	return m.fileInfo(rel, n), nil
+}
+
+// Put helps you copy files into the memory storage
+// from the file system, filePath is the full path to the file
+// you would like to put, it returns error incase there is any
+func (m *MemStorage) Put(filePath string) error {
+	return m.PutAs(filePath, filepath.Base(filePath))
+}
+
+// PutAs helps you copy files into the memory storage from the file
+// system with the given name, it returns error incase there is any
+func (m *MemStorage) PutAs(filePath string, filename string) error {
+	// make sure the source file exists
+	s, err := os.Stat(filePath)
+	if err != nil {
+		return m.pathError("put", filePath, err)
+	}
+	if err := checkRegular(s.IsDir(), s.Mode()); err != nil {
+		return m.pathError("put", filePath, err)
+	}
+
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return m.pathError("put", filePath, err)
+	}
+	defer srcFile.Close()
+
+	_, err = m.WriteStream(filename, srcFile)
+
+	return err
+}
+
+// Copy helps you copy files within the memory storage
+// into the given destination folder,
+// it returns an error incase there is any
+func (m *MemStorage) Copy(filePath string, destfolder string) error {
+	return m.CopyAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// CopyAs helps you copy files within the memory storage into the
+// given destination folder with the given new name,
+// it returns an error incase there is any
+func (m *MemStorage) CopyAs(filePath string, destfolder string, newFilePath string) error {
+	content, err := m.Read(filePath)
+	if err != nil {
+		return err
+	}
+
+	return m.Create(path.Join(filepath.ToSlash(destfolder), newFilePath), content)
+}
+
+// Move helps you move files within the memory storage
+// into the given destination folder,
+// it returns an error incase there any
+func (m *MemStorage) Move(filePath string, destfolder string) error {
+	return m.MoveAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// MoveAs helps you move files within the memory storage into the
+// given destination folder with the given new name,
+// it returns an error incase there any
+func (m *MemStorage) MoveAs(filePath string, destFolder string, newFilePath string) error {
+	err := m.CopyAs(filePath, destFolder, newFilePath)
+	if err != nil {
+		return err
+	}
+
+	rel, err := m.resolve("move", filePath)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.nodes, rel)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Rename renames the given file as first parameter to the name
+// given as a second parameter, an existing file with the new
+// name is replaced, it returns error incase there is any
+func (m *MemStorage) Rename(filePath string, newFilePath string) error {
+	rel, err := m.resolve("rename", filePath)
+	if err != nil {
+		return err
+	}
+	newRel, err := m.resolve("rename", newFilePath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return m.pathError("rename", filePath, stowage.ErrNotFound)
+	}
+	if err := checkRegular(n.isDir, n.mode); err != nil {
+		return m.pathError("rename", filePath, err)
+	}
+	if err := m.checkParent(newRel); err != nil {
+		return m.pathError("rename", filePath, err)
+	}
+	if target, ok := m.nodes[newRel]; ok && target.isDir {
+		return m.pathError("rename", filePath, stowage.ErrIsDirectory)
+	}
+	delete(m.nodes, rel)
+	m.nodes[newRel] = n
+
+	return nil
+}
+
+// Delete deletes the given file it returns error incase there is any
+func (m *MemStorage) Delete(filePath string) error {
+	rel, err := m.resolve("delete", filePath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return m.pathError("delete", filePath, stowage.ErrNotFound)
+	}
+	if err := checkRegular(n.isDir, n.mode); err != nil {
+		return m.pathError("delete", filePath, err)
+	}
+	delete(m.nodes, rel)
+
+	return nil
+}
+
+// DeleteMultiple deletes multiple files given as slice of strings
+// of file paths, missing files are skipped,
+// it returns error incase there is any
+func (m *MemStorage) DeleteMultiple(filePaths []string) error {
+	for _, file := range filePaths {
+		rel, err := m.resolve("delete", file)
+		if err != nil {
+			return err
+		}
+
+		m.mu.Lock()
+		if n, ok := m.nodes[rel]; ok && !n.isDir {
+			delete(m.nodes, rel)
+		}
+		m.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Create helps you create new a file and add content to it,
+// the parent directories are created as needed,
+// it returns error incase there is any
+func (m *MemStorage) Create(filePath string, content []byte) error {
+	_, err := m.WriteStream(filePath, bytes.NewReader(content))
+
+	return err
+}
+
+// WriteStream creates a new file with the content read from the
+// given reader until EOF, the parent directories are created as needed,
+// it returns the number of bytes written and an error incase there is any
+func (m *MemStorage) WriteStream(filePath string, r io.Reader) (int64, error) {
+	rel, err := m.resolve("write", filePath)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.checkWritable(rel); err != nil {
+		return 0, m.pathError("write", filePath, err)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(content)), m.pathError("write", filePath, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// check again, the file may have been created while reading
+	if err := m.checkWritableLocked(rel); err != nil {
+		return 0, m.pathError("write", filePath, err)
+	}
+	if err := m.mkdirAllLocked(path.Dir(rel), 0755); err != nil {
+		return 0, m.pathError("write", filePath, err)
+	}
+	m.nodes[rel] = &node{mode: 0644, modTime: time.Now(), data: content}
+
+	return int64(len(content)), nil
+}
+
+// Append helps you append content to a file,
+// it returns error incase there is any
+func (m *MemStorage) Append(filePath string, content []byte) error {
+	rel, err := m.resolve("append", filePath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return m.pathError("append", filePath, stowage.ErrNotFound)
+	}
+	if err := checkRegular(n.isDir, n.mode); err != nil {
+		return m.pathError("append", filePath, err)
+	}
+
+	// never modify the data in place, streams may be reading it
+	data := make([]byte, 0, len(n.data)+len(content))
+	data = append(data, n.data...)
+	n.data = append(data, content...)
+	n.modTime = time.Now()
+
+	return nil
+}
+
+// Exists checks if a file exists within the memory storage,
+// it returns a bool and an error incase any
+func (m *MemStorage) Exists(filePath string) (bool, error) {
+	rel, err := m.resolve("exists", filePath)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.nodes[rel]
+
+	return ok, nil
+}
+
+// Missing checks if a file is missing in the memory storage,
+// it returns a bool and an error incase any
+func (m *MemStorage) Missing(filePath string) (bool, error) {
+	exists, err := m.Exists(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// Read helps you grap the content of a file,
+// it returns the data in a slice of bytes and an error
+// incase there is any
+func (m *MemStorage) Read(filePath string) ([]byte, error) {
+	rel, err := m.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return nil, m.pathError("read", filePath, stowage.ErrNotFound)
+	}
+	if err := checkRegular(n.isDir, n.mode); err != nil {
+		return nil, m.pathError("read", filePath, err)
+	}
+
+	content := make([]byte, len(n.data))
+	copy(content, n.data)
+
+	return content, nil
+}
+
+// ReadStream opens the given file for reading and returns
+// an io.ReadCloser streaming its content,
+// it returns an error incase there is any
+func (m *MemStorage) ReadStream(filePath string) (io.ReadCloser, error) {
+	rel, err := m.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return nil, m.pathError("read", filePath, stowage.ErrNotFound)
+	}
+	if err := checkRegular(n.isDir, n.mode); err != nil {
+		return nil, m.pathError("read", filePath, err)
+	}
+
+	// the data is never modified in place so it's safe to share it
+	return ioutil.NopCloser(bytes.NewReader(n.data)), nil
+}
+
+// ReadRange returns a reader of length bytes of the given file starting at
+// offset, a negative length reads up to the end of the file, a range past
+// the end of the file is cut at the end, it returns an error incase there is any
+func (m *MemStorage) ReadRange(filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, m.pathError("read", filePath, fs.ErrInvalid)
+	}
+	rel, err := m.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return nil, m.pathError("read", filePath, stowage.ErrNotFound)
+	}
+	if err := checkRegular(n.isDir, n.mode); err != nil {
+		return nil, m.pathError("read", filePath, err)
+	}
+
+	data := n.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Files returns a list of files in a given directory,
+// if you want a list of files including the files
+// in sub directories, consider using the method
+// `AllFiles(DirectoryPath string)`
+func (m *MemStorage) Files(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	rel, err := m.resolveDir("files", DirectoryPath)
+	if err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, child := range m.childrenLocked(rel) {
+		if n := m.nodes[child]; !n.isDir {
+			files = append(files, m.fileInfo(child, n))
+		}
+	}
+
+	return files, nil
+}
+
+// AllFiles returns a list of files in the given directory
+// including files in sub directories
+func (m *MemStorage) AllFiles(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	rel, err := m.resolveDir("allfiles", DirectoryPath)
+	if err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.walkLocked(rel, func(p string, n *node) {
+		if !n.isDir {
+			files = append(files, m.fileInfo(p, n))
+		}
+	})
+
+	return files, nil
+}
+
+// Directories returns a slice of string containing
+// the paths of the sub directories, if you want the list of
+// directories including nested sub directories consider using
+// the method "AllDirectories(DirectoryPath string)"
+func (m *MemStorage) Directories(DirectoryPath string) (SubDirectoryPaths []string, err error) {
+	rel, err := m.resolveDir("directories", DirectoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, child := range m.childrenLocked(rel) {
+		if m.nodes[child].isDir {
+			SubDirectoryPaths = append(SubDirectoryPaths, fullPath(child))
+		}
+	}
+
+	return SubDirectoryPaths, nil
+}
+
+// AllDirectories returns a list of directories including
+// sub directories, it returns an error incase is any
+func (m *MemStorage) AllDirectories(SubDirectoryPath string) (directoryPaths []string, err error) {
+	rel, err := m.resolveDir("alldirectories", SubDirectoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.walkLocked(rel, func(p string, n *node) {
+		if n.isDir && p != rel {
+			directoryPaths = append(directoryPaths, fullPath(p))
+		}
+	})
+
+	return directoryPaths, nil
+}
+
+// MakeDirectory creates a new directory and the necessary
+// parent directories with the given permissions,
+// it returns an error incase is any
+func (m *MemStorage) MakeDirectory(DirectoryPath string, perm int) error {
+	rel, err := m.resolve("mkdir", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pathError("mkdir", DirectoryPath, m.mkdirAllLocked(rel, fs.FileMode(perm)))
+}
+
+// RenameDirectory changes the name of directory to new name,
+// it returns an error incase there is any
+func (m *MemStorage) RenameDirectory(DirectoryPath string, NewDirectoryPath string) error {
+	rel, err := m.resolve("rename", DirectoryPath)
+	if err != nil {
+		return err
+	}
+	newRel, err := m.resolve("rename", NewDirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return m.pathError("rename", DirectoryPath, stowage.ErrNotFound)
+	}
+	if rel == "." || newRel == rel || isUnder(newRel, rel) {
+		return m.pathError("rename", DirectoryPath, syscall.EINVAL)
+	}
+	if err := m.checkParent(newRel); err != nil {
+		return m.pathError("rename", DirectoryPath, err)
+	}
+	if target, ok := m.nodes[newRel]; ok {
+		// like the file system only an empty directory can be replaced
+		if !n.isDir || !target.isDir || len(m.childrenLocked(newRel)) > 0 {
+			return m.pathError("rename", DirectoryPath, stowage.ErrAlreadyExists)
+		}
+	}
+
+	moved := map[string]*node{}
+	m.walkLocked(rel, func(p string, n *node) {
+		moved[p] = n
+	})
+	for p, n := range moved {
+		delete(m.nodes, p)
+		m.nodes[newRel+strings.TrimPrefix(p, rel)] = n
+	}
+
+	return nil
+}
+
+// DeleteDirectory deletes the given directory
+// along with its content
+func (m *MemStorage) DeleteDirectory(DirectoryPath string) error {
+	rel, err := m.resolve("delete", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.nodes[rel]; !ok {
+		return nil
+	}
+	removed := []string{}
+	m.walkLocked(rel, func(p string, n *node) {
+		removed = append(removed, p)
+	})
+	for _, p := range removed {
+		delete(m.nodes, p)
+	}
+	if rel == "." {
+		// the root always exists
+		m.nodes["."] = &node{isDir: true, mode: fs.ModeDir | 0755, modTime: time.Now()}
+	}
+
+	return nil
+}
+
+// resolve cleans the given path and makes it relative to the root,
+// it rejects paths climbing above the root
+func (m *MemStorage) resolve(op string, filePath string) (string, error) {
+	p := path.Clean(filepath.ToSlash(filePath))
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		p = "."
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", m.pathError(op, filePath, stowage.ErrOutsideRoot)
+	}
+
+	return p, nil
+}
+
+// resolveDir resolves the given path and makes sure it's a directory
+func (m *MemStorage) resolveDir(op string, DirectoryPath string) (string, error) {
+	rel, err := m.resolve(op, DirectoryPath)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return "", m.pathError(op, DirectoryPath, stowage.ErrNotFound)
+	}
+	if !n.isDir {
+		return "", m.pathError(op, DirectoryPath, syscall.ENOTDIR)
+	}
+
+	return rel, nil
+}
+
+// checkWritable makes sure a new file can be created at the given path
+func (m *MemStorage) checkWritable(rel string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.checkWritableLocked(rel)
+}
+
+func (m *MemStorage) checkWritableLocked(rel string) error {
+	if n, ok := m.nodes[rel]; ok {
+		if n.isDir {
+			return stowage.ErrIsDirectory
+		}
+		return stowage.ErrAlreadyExists
+	}
+	// none of the parents can be a file
+	for p := path.Dir(rel); p != "."; p = path.Dir(p) {
+		if n, ok := m.nodes[p]; ok && !n.isDir {
+			return syscall.ENOTDIR
+		}
+	}
+
+	return nil
+}
+
+// checkParent makes sure the parent directory of the given path exists,
+// the caller must hold the lock
+func (m *MemStorage) checkParent(rel string) error {
+	parent, ok := m.nodes[path.Dir(rel)]
+	if !ok {
+		return stowage.ErrNotFound
+	}
+	if !parent.isDir {
+		return syscall.ENOTDIR
+	}
+
+	return nil
+}
+
+// mkdirAllLocked creates the directory along with its parents,
+// the caller must hold the lock
+func (m *MemStorage) mkdirAllLocked(rel string, perm fs.FileMode) error {
+	if n, ok := m.nodes[rel]; ok {
+		if !n.isDir {
+			return syscall.ENOTDIR
+		}
+		return nil
+	}
+	if err := m.mkdirAllLocked(path.Dir(rel), perm); err != nil {
+		return err
+	}
+	m.nodes[rel] = &node{isDir: true, mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+
+	return nil
+}
+
+// childrenLocked returns the paths of the direct children of the given
+// directory sorted by name, the caller must hold the lock
+func (m *MemStorage) childrenLocked(dir string) []string {
+	children := []string{}
+	for p := range m.nodes {
+		if p != "." && path.Dir(p) == dir {
+			children = append(children, p)
+		}
+	}
+	sort.Strings(children)
+
+	return children
+}
+
+// walkLocked visits the given node and its descendants in lexical order
+// like filepath.Walk does, the caller must hold the lock
+func (m *MemStorage) walkLocked(rel string, fn func(p string, n *node)) {
+	n := m.nodes[rel]
+	fn(rel, n)
+	if !n.isDir {
+		return
+	}
+	for _, child := range m.childrenLocked(rel) {
+		m.walkLocked(child, fn)
+	}
+}
+
+// pathError wraps the given error into a *stowage.PathError
+func (m *MemStorage) pathError(op string, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pathErr *stowage.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		err = stowage.ErrNotFound
+	} else if fsErr, ok := err.(*fs.PathError); ok {
+		err = fsErr.Err
+	}
+
+	return &stowage.PathError{Op: op, Disk: m.name, Path: filePath, Err: err}
+}
+
+// checkRegular makes sure the node is a regular file
+func checkRegular(isDir bool, mode fs.FileMode) error {
+	if isDir {
+		return stowage.ErrIsDirectory
+	}
+	if !mode.IsRegular() {
+		return stowage.ErrNotRegular
+	}
+
+	return nil
+}
+
+// isUnder reports whether p is a descendant of dir
+func isUnder(p string, dir string) bool {
+	return dir == "." || strings.HasPrefix(p, dir+"/")
+}
+
+// fullPath returns the path of the node as seen from the root
+func fullPath(rel string) string {
+	return path.Join("/", rel)
+}
+
+// fileInfo builds the file information of the given node
+func (m *MemStorage) fileInfo(rel string, n *node) localstorage.FileInfo {
+	full := fullPath(rel)
+	name := path.Base(full)
+	ext := path.Ext(full)
+	info := &memFileInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+	contentType := ""
+	if n.isDir {
+		info.size = 0
+	} else {
+		contentType = localstorage.DetectContentType(name, m.contentTypes, n.data)
+	}
+
+	return localstorage.FileInfo{
+		Name:                 name,
+		Extension:            localstorage.Extension(full),
+		NameWithoutExtension: strings.TrimSuffix(name, ext),
+		Size:                 info.size,
+		Path:                 path.Dir(full),
+		LastModified:         n.modTime,
+		IsDirectory:          n.isDir,
+		FsFileInfo:           info,
+		ContentType:          contentType,
+	}
+}
+
+// memFileInfo implements fs.FileInfo for the nodes
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}   { return nil }
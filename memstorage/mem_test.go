@@ -0,0 +1,89 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package memstorage_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/harranali/stowage/memstorage"
+)
+
+func TestNew(t *testing.T) {
+	m := New()
+	if fmt.Sprintf("%T", m) != "*memstorage.MemStorage" {
+		t.Error("failed initiating memstorage")
+	}
+	if m.Name() != "memory" {
+		t.Error("failed asserting default name")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	m := NewWithOpts(Opts{ContentTypes: map[string]string{"md": "text/x-markdown"}})
+	m.Create("readme.md", []byte("# readme"))
+	m.Create("page", []byte("<html></html>"))
+	if info, _ := m.FileInfo("readme.md"); info.ContentType != "text/x-markdown" {
+		t.Error("failed asserting overridden content type: ", info.ContentType)
+	}
+	if info, _ := m.FileInfo("page"); info.ContentType != "text/html; charset=utf-8" {
+		t.Error("failed asserting sniffed content type: ", info.ContentType)
+	}
+}
+
+func TestStreamIsolation(t *testing.T) {
+	m := New()
+	m.Create("a/b/filetocreate.md", []byte("this is a test file\n"))
+
+	stream, _ := m.ReadStream("a/b/filetocreate.md")
+	if err := m.Append("a/b/filetocreate.md", []byte("appended")); err != nil {
+		t.Error("failed assert append. ", err)
+	}
+
+	// the opened stream keeps the content it was opened with
+	streamed, _ := ioutil.ReadAll(stream)
+	if string(streamed) != "this is a test file\n" {
+		t.Error("failed assert stream isolation")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := New()
+	m.Create("filetoread.md", []byte("contentToRead"))
+	m.MakeDirectory("dirs/dir1/dir3", 0755)
+	m.MakeDirectory("dirs/dir2", 0755)
+
+	data, err := m.Snapshot()
+	if err != nil {
+		t.Fatal("failed asserting snapshot. ", err)
+	}
+
+	restored, err := NewFromSnapshot(data, Opts{Name: "restored"})
+	if err != nil {
+		t.Fatal("failed asserting restore snapshot. ", err)
+	}
+	content, err := restored.Read("filetoread.md")
+	if err != nil || string(content) != "contentToRead" {
+		t.Error("failed asserting restored content. ", err)
+	}
+	dirs, _ := restored.AllDirectories("dirs")
+	if len(dirs) != 3 {
+		t.Error("failed asserting restored directories")
+	}
+
+	// loading replaces the content
+	empty, _ := New().Snapshot()
+	if err := restored.Load(empty); err != nil {
+		t.Error("failed asserting load snapshot. ", err)
+	}
+	if yes, _ := restored.Exists("filetoread.md"); yes {
+		t.Error("failed asserting load replaces content")
+	}
+
+	if err := restored.Load([]byte("garbage")); err == nil {
+		t.Error("failed asserting loading invalid snapshot")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package memstorage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/fs"
+	"time"
+)
+
+// snapshotEntry is the persisted form of a node
+type snapshotEntry struct {
+	Path    string
+	IsDir   bool
+	Mode    fs.FileMode
+	ModTime time.Time
+	Data    []byte
+}
+
+// Snapshot serializes the whole content of the memory storage,
+// the result can be loaded back with `Load(data []byte)` or
+// `NewFromSnapshot(data []byte, opts Opts)`
+func (m *MemStorage) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	entries := make([]snapshotEntry, 0, len(m.nodes))
+	m.walkLocked(".", func(p string, n *node) {
+		entries = append(entries, snapshotEntry{
+			Path:    p,
+			IsDir:   n.isDir,
+			Mode:    n.mode,
+			ModTime: n.modTime,
+			Data:    n.data,
+		})
+	})
+	m.mu.RUnlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entries); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Load replaces the content of the memory storage with
+// the content of the given snapshot,
+// it returns an error incase there is any
+func (m *MemStorage) Load(data []byte) error {
+	var entries []snapshotEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+		return err
+	}
+
+	nodes := make(map[string]*node, len(entries))
+	for _, e := range entries {
+		nodes[e.Path] = &node{isDir: e.IsDir, mode: e.Mode, modTime: e.ModTime, data: e.Data}
+	}
+	if root, ok := nodes["."]; !ok || !root.isDir {
+		nodes["."] = &node{isDir: true, mode: fs.ModeDir | 0755, modTime: time.Now()}
+	}
+
+	m.mu.Lock()
+	m.nodes = nodes
+	m.mu.Unlock()
+
+	return nil
+}
+
+// NewFromSnapshot initiate memory storage with the content
+// of the given snapshot, it returns an error incase there is any
+func NewFromSnapshot(data []byte, opts Opts) (*MemStorage, error) {
+	m := NewWithOpts(opts)
+	if err := m.Load(data); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
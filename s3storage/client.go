@@ -0,0 +1,359 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error response returned by the S3 API
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// request describes a call to the S3 API
+type request struct {
+	method  string
+	key     string
+	query   url.Values
+	header  http.Header
+	body    []byte
+	okCodes []int
+}
+
+// do signs and sends the request, a response with a status code that is
+// not a success is returned as an *Error, the caller must close the body
+func (s *S3Storage) do(ctx context.Context, r request) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + uriEncode(s.bucket, true)
+	if r.key != "" {
+		u.Path += "/" + r.key
+		u.RawPath += "/" + uriEncode(r.key, false)
+	}
+	u.RawQuery = encodeQuery(r.query)
+
+	req, err := http.NewRequest(r.method, u.String(), bytes.NewReader(r.body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(r.body) > 0 {
+		payloadHash = hashHex(r.body)
+	}
+	signV4(req, payloadHash, s.creds, s.region, "s3", s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	for _, code := range r.okCodes {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	return nil, parseError(resp)
+}
+
+// parseError reads the error response of the S3 API
+func parseError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Code      string
+		Message   string
+		RequestID string `xml:"RequestId"`
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(data, &body) == nil {
+		apiErr.Code = body.Code
+		apiErr.Message = body.Message
+		apiErr.RequestID = body.RequestID
+	}
+
+	return apiErr
+}
+
+// encodeQuery encodes the query the same way it's
+// canonicalized for signing, sorted and fully escaped
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	pairs := []string{}
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// object is an entry of a bucket listing
+type object struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+	ETag         string
+}
+
+// listResult is the response of ListObjectsV2
+type listResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []object
+	CommonPrefixes        []struct {
+		Prefix string
+	}
+}
+
+// list lists all the objects under the given prefix, with a delimiter
+// the objects are grouped by the common prefixes, maxKeys limits the
+// number of returned entries when it's greater than zero
+func (s *S3Storage) list(ctx context.Context, prefix string, delimiter string, maxKeys int) (objects []object, prefixes []string, err error) {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if maxKeys > 0 {
+			query.Set("max-keys", strconv.Itoa(maxKeys))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, request{method: http.MethodGet, query: query})
+		if err != nil {
+			return nil, nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		objects = append(objects, result.Contents...)
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !result.IsTruncated || maxKeys > 0 || result.NextContinuationToken == "" {
+			return objects, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// head returns the metadata of the object, it returns
+// an *Error with status 404 incase the object doesn't exist
+func (s *S3Storage) head(ctx context.Context, key string) (object, error) {
+	resp, err := s.do(ctx, request{method: http.MethodHead, key: key})
+	if err != nil {
+		return object{}, err
+	}
+	resp.Body.Close()
+
+	obj := object{Key: key, Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}
+	obj.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return obj, nil
+}
+
+// putObject uploads the content as a single object, when onlyNew is
+// set the upload fails with status 412 if the object already exists
+func (s *S3Storage) putObject(ctx context.Context, key string, content []byte, onlyNew bool) error {
+	header := http.Header{}
+	if onlyNew {
+		header.Set("If-None-Match", "*")
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	resp, err := s.do(ctx, request{method: http.MethodPut, key: key, header: header, body: content})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// copyObject copies the source object to the destination server side
+func (s *S3Storage) copyObject(ctx context.Context, srcKey string, destKey string) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+uriEncode(s.bucket, true)+"/"+uriEncode(srcKey, false))
+	resp, err := s.do(ctx, request{method: http.MethodPut, key: destKey, header: header})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// a copy may fail after the 200 status was sent
+	data, _ := ioutil.ReadAll(resp.Body)
+	var failure struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(data, &failure) == nil && failure.XMLName.Local == "Error" {
+		return &Error{StatusCode: resp.StatusCode, Code: failure.Code, Message: failure.Message}
+	}
+
+	return nil
+}
+
+// deleteObject deletes the object, deleting a missing object succeeds
+func (s *S3Storage) deleteObject(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, request{method: http.MethodDelete, key: key})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// upload streams the content of the reader into the object, content that
+// fits in a single part is uploaded with a single request, larger content
+// is uploaded part by part with a multipart upload so no more than one part
+// is held in memory, when onlyNew is set the upload fails with status 412
+// if the object already exists
+func (s *S3Storage) upload(ctx context.Context, key string, r io.Reader, onlyNew bool) (int64, error) {
+	part := make([]byte, s.partSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return int64(n), s.putObject(ctx, key, part[:n], onlyNew)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// initiate the multipart upload
+	resp, err := s.do(ctx, request{method: http.MethodPost, key: key, query: url.Values{"uploads": {""}}})
+	if err != nil {
+		return 0, err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := s.uploadParts(ctx, key, initiated.UploadID, part[:n], r, onlyNew)
+	if err != nil {
+		// abort to release the uploaded parts
+		abort := url.Values{"uploadId": {initiated.UploadID}}
+		if resp, abortErr := s.do(context.Background(), request{method: http.MethodDelete, key: key, query: abort}); abortErr == nil {
+			resp.Body.Close()
+		}
+		return written, err
+	}
+
+	return written, nil
+}
+
+// completedPart is a part of the complete multipart upload request
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// uploadParts uploads the first part along with the rest of
+// the reader content then completes the multipart upload
+func (s *S3Storage) uploadParts(ctx context.Context, key string, uploadID string, first []byte, r io.Reader, onlyNew bool) (int64, error) {
+	var written int64
+	parts := []completedPart{}
+	data := first
+	for number := 1; ; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, request{method: http.MethodPut, key: key, query: query, body: data})
+		if err != nil {
+			return written, err
+		}
+		resp.Body.Close()
+		written += int64(len(data))
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		buf := make([]byte, s.partSize)
+		n, err := io.ReadFull(r, buf)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return written, err
+		}
+		data = buf[:n]
+	}
+
+	// complete the upload
+	var body bytes.Buffer
+	err := xml.NewEncoder(&body).Encode(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return written, err
+	}
+	header := http.Header{}
+	if onlyNew {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := s.do(ctx, request{method: http.MethodPost, key: key, query: url.Values{"uploadId": {uploadID}}, header: header, body: body.Bytes()})
+	if err != nil {
+		return written, err
+	}
+	defer resp.Body.Close()
+
+	// the completion may fail after the 200 status was sent
+	data, _ = ioutil.ReadAll(resp.Body)
+	var failure struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(data, &failure) == nil && failure.XMLName.Local == "Error" {
+		return written, &Error{StatusCode: resp.StatusCode, Code: failure.Code, Message: failure.Message}
+	}
+
+	return written, nil
+}
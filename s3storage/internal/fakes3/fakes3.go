@@ -0,0 +1,391 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package fakes3 is an in-memory server of the subset of the S3 API
+// used by the s3 storage, it's meant for the tests only
+package fakes3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake S3 server, it implements http.Handler
+// and serves buckets using path-style addressing
+type Server struct {
+	accessKeyID string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+	uploads map[string]*upload
+	nextID  int
+}
+
+type object struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+type upload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+// New creates a fake server, when accessKeyID is not empty the
+// requests must be signed with signature version 4 using it
+func New(accessKeyID string) *Server {
+	return &Server{
+		accessKeyID: accessKeyID,
+		buckets:     map[string]map[string]*object{},
+		uploads:     map[string]*upload{},
+	}
+}
+
+// CreateBucket creates an empty bucket
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[name] == nil {
+		s.buckets[name] = map[string]*object{}
+	}
+}
+
+// Keys returns the sorted keys of the objects in the bucket
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// ServeHTTP serves the S3 API requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.accessKeyID != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/") ||
+			!strings.Contains(auth, "Signature=") || r.Header.Get("X-Amz-Date") == "" {
+			writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucketName, key := parts[0], ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	bucket, ok := s.buckets[bucketName]
+	if !ok {
+		if r.Method == http.MethodPut && key == "" {
+			s.buckets[bucketName] = map[string]*object{}
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.list(w, bucket, query)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed")
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &upload{bucket: bucketName, key: key, parts: map[int][]byte{}}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucketName, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		s.uploadPart(w, r, query)
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		s.completeUpload(w, r, bucket, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("If-None-Match") == "*" && bucket[key] != nil {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+		obj := newObject(data)
+		bucket[key] = obj
+		w.Header().Set("ETag", obj.etag)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj := bucket[key]
+		if obj == nil {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		data := obj.data
+		status := http.StatusOK
+		if byteRange := r.Header.Get("Range"); byteRange != "" && r.Method == http.MethodGet {
+			start, end, ok := parseRange(byteRange, len(data))
+			if !ok {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)))
+			data = data[start:end]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		w.Header().Set("ETag", obj.etag)
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed")
+	}
+}
+
+// parseRange parses a range of the form "bytes=start-end" or
+// "bytes=start-", it returns the range with its end excluded
+func parseRange(byteRange string, size int) (int, int, bool) {
+	spec := strings.TrimPrefix(byteRange, "bytes=")
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 || spec == byteRange {
+		return 0, 0, false
+	}
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size
+	if parts[1] != "" {
+		last, err := strconv.Atoi(parts[1])
+		if err != nil || last < start {
+			return 0, 0, false
+		}
+		if last+1 < size {
+			end = last + 1
+		}
+	}
+
+	return start, end, true
+}
+
+// list implements ListObjectsV2, the continuation token
+// is the last key or common prefix that was returned
+func (s *Server) list(w http.ResponseWriter, bucket map[string]*object, query url.Values) {
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	token := query.Get("continuation-token")
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		maxKeys, _ = strconv.Atoi(v)
+	}
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Prefix                string
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		NextContinuationToken string         `xml:",omitempty"`
+		Contents              []content      `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}{Prefix: prefix, MaxKeys: maxKeys}
+
+	keys := []string{}
+	for key := range bucket {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	last := ""
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if token != "" && (key <= token || (delimiter != "" && strings.HasSuffix(token, delimiter) && strings.HasPrefix(key, token))) {
+			continue
+		}
+		entry, grouped := key, false
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry, grouped = key[:len(prefix)+i+len(delimiter)], true
+			}
+		}
+		if entry == last {
+			continue
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = last
+			break
+		}
+		if grouped {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: entry})
+		} else {
+			obj := bucket[key]
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				LastModified: obj.modTime.Format("2006-01-02T15:04:05.000Z"),
+				ETag:         obj.etag,
+				Size:         len(obj.data),
+			})
+		}
+		result.KeyCount++
+		last = entry
+	}
+
+	writeXML(w, result)
+}
+
+// copyObject implements CopyObject
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucket map[string]*object, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid copy source")
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	var src *object
+	if len(parts) == 2 {
+		src = s.buckets[parts[0]][parts[1]]
+	}
+	if src == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	obj := newObject(src.data)
+	bucket[key] = obj
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		LastModified string
+		ETag         string
+	}{LastModified: obj.modTime.Format("2006-01-02T15:04:05.000Z"), ETag: obj.etag})
+}
+
+// uploadPart implements UploadPart
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	up := s.uploads[query.Get("uploadId")]
+	if up == nil {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	number, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || number < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid part number")
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	up.parts[number] = data
+	w.Header().Set("ETag", etag(data))
+}
+
+// completeUpload implements CompleteMultipartUpload
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, bucket map[string]*object, id string) {
+	up := s.uploads[id]
+	if up == nil {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	var complete struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil || len(complete.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && bucket[up.key] != nil {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return
+	}
+
+	var data bytes.Buffer
+	for _, part := range complete.Parts {
+		content, ok := up.parts[part.PartNumber]
+		if !ok || etag(content) != part.ETag {
+			writeError(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+			return
+		}
+		data.Write(content)
+	}
+	bucket[up.key] = newObject(data.Bytes())
+	delete(s.uploads, id)
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+	}{Bucket: up.bucket, Key: up.key})
+}
+
+func newObject(data []byte) *object {
+	return &object{
+		data:    append([]byte{}, data...),
+		modTime: time.Now().UTC().Truncate(time.Second),
+		etag:    etag(data),
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message><RequestId>fake</RequestId></Error>", xml.Header, code, message)
+}
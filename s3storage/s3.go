@@ -0,0 +1,927 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package s3storage implements stowage.Disk over the S3 REST API,
+// it works with AWS S3 and the S3 compatible object storages using
+// path-style addressing and signature version 4, directories are
+// emulated with the key prefixes and empty marker objects
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+)
+
+// make sure the s3 storage supports all operations
+var (
+	_ stowage.Disk      = (*S3Storage)(nil)
+	_ stowage.RangeDisk = (*S3Storage)(nil)
+)
+
+// minPartSize is the smallest part size accepted by S3 for multipart uploads
+const minPartSize = 5 * 1024 * 1024
+
+// S3Storage s3 storage
+type S3Storage struct {
+	name     string
+	endpoint *url.URL
+	region   string
+	bucket   string
+	prefix   string
+	creds    credentials
+	partSize int
+	client   *http.Client
+	now      func() time.Time
+}
+
+// Opts options for initiating s3 storage
+type Opts struct {
+	// Endpoint is the base url of the S3 API, for example
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only needed for temporary credentials
+	SessionToken string
+
+	// Prefix is the key prefix acting as the root folder,
+	// by default the root folder is the root of the bucket
+	Prefix string
+	// PartSize is the size of the parts of multipart uploads and the most
+	// memory an upload holds at once, it defaults to the minimum 5MiB
+	PartSize int
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Name identifies the disk in the returned errors,
+	// it defaults to "s3"
+	Name string
+}
+
+// New initiate s3 storage, it returns an error incase the options are invalid
+func New(opts Opts) (*S3Storage, error) {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New("s3: the endpoint must be an absolute url")
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("s3: the bucket is required")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.PartSize < minPartSize {
+		opts.PartSize = minPartSize
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Name == "" {
+		opts.Name = "s3"
+	}
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3Storage{
+		name:     opts.Name,
+		endpoint: endpoint,
+		region:   opts.Region,
+		bucket:   opts.Bucket,
+		prefix:   prefix,
+		creds: credentials{
+			accessKeyID:     opts.AccessKeyID,
+			secretAccessKey: opts.SecretAccessKey,
+			sessionToken:    opts.SessionToken,
+		},
+		partSize: opts.PartSize,
+		client:   opts.HTTPClient,
+		now:      time.Now,
+	}, nil
+}
+
+// Name returns the name of the disk
+func (s *S3Storage) Name() string {
+	return s.name
+}
+
+// FileInfo returns information about the given file or directory
+// or an error incase there is any
+func (s *S3Storage) FileInfo(filePath string) (fileinfo localstorage.FileInfo, err error) {
+	ctx := context.Background()
+	rel, err := s.resolve("fileinfo", filePath)
+	if err != nil {
+		return localstorage.FileInfo{}, err
+	}
+	if rel == "." {
+		return fileInfo(rel, 0, time.Time{}, true), nil
+	}
+
+	obj, err := s.head(ctx, s.key(rel))
+	if err == nil {
+		return fileInfo(rel, obj.Size, obj.LastModified, false), nil
+	}
+	if !isNotFound(err) {
+		return localstorage.FileInfo{}, s.pathError("fileinfo", filePath, err)
+	}
+
+	isDir, err := s.isDir(ctx, rel)
+	if err != nil {
+		return localstorage.FileInfo{}, s.pathError("fileinfo", filePath, err)
+	}
+	if !isDir {
+		return localstorage.FileInfo{}, s.pathError("fileinfo", filePath, stowage.ErrNotFound)
+	}
+
+	return fileInfo(rel, 0, time.Time{}, true), nil
+}
+
+// Put uploads the given file from the local file system
+// into the root folder, it returns error incase there is any
+func (s *S3Storage) Put(filePath string) error {
+	return s.PutAs(filePath, filepath.Base(filePath))
+}
+
+// PutAs uploads the given file from the local file system into the
+// root folder with the given name, it returns error incase there is any
+func (s *S3Storage) PutAs(filePath string, filename string) error {
+	st, err := os.Stat(filePath)
+	if err != nil {
+		return s.pathError("put", filePath, err)
+	}
+	if st.IsDir() {
+		return s.pathError("put", filePath, stowage.ErrIsDirectory)
+	}
+	if !st.Mode().IsRegular() {
+		return s.pathError("put", filePath, stowage.ErrNotRegular)
+	}
+
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return s.pathError("put", filePath, err)
+	}
+	defer srcFile.Close()
+
+	_, err = s.WriteStream(filename, srcFile)
+
+	return err
+}
+
+// Copy copies the file into the destination folder server side,
+// it returns an error incase there is any
+func (s *S3Storage) Copy(filePath string, destfolder string) error {
+	return s.CopyAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// CopyAs copies the file into the destination folder with the given
+// name server side, it returns an error incase there is any
+func (s *S3Storage) CopyAs(filePath string, destfolder string, newFilePath string) error {
+	ctx := context.Background()
+	rel, err := s.resolve("copy", filePath)
+	if err != nil {
+		return err
+	}
+	destPath := path.Join(filepath.ToSlash(destfolder), newFilePath)
+	destRel, err := s.resolve("copy", destPath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkFile(ctx, "copy", filePath, rel); err != nil {
+		return err
+	}
+	if err := s.checkAvailable(ctx, "copy", destPath, destRel); err != nil {
+		return err
+	}
+
+	return s.pathError("copy", filePath, s.copyObject(ctx, s.key(rel), s.key(destRel)))
+}
+
+// Move moves the file into the destination folder,
+// it returns an error incase there any
+func (s *S3Storage) Move(filePath string, destfolder string) error {
+	return s.MoveAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// MoveAs moves the file into the destination folder with the given
+// name, it returns an error incase there any
+func (s *S3Storage) MoveAs(filePath string, destFolder string, newFilePath string) error {
+	if err := s.CopyAs(filePath, destFolder, newFilePath); err != nil {
+		return err
+	}
+
+	rel, _ := s.resolve("move", filePath)
+
+	return s.pathError("move", filePath, s.removeObject(context.Background(), rel))
+}
+
+// Rename renames the given file as first parameter to the name
+// given as a second parameter, an existing file with the new
+// name is replaced, it returns error incase there is any
+func (s *S3Storage) Rename(filePath string, newFilePath string) error {
+	ctx := context.Background()
+	rel, err := s.resolve("rename", filePath)
+	if err != nil {
+		return err
+	}
+	newRel, err := s.resolve("rename", newFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkFile(ctx, "rename", filePath, rel); err != nil {
+		return err
+	}
+	isDir, err := s.isDir(ctx, newRel)
+	if err != nil {
+		return s.pathError("rename", filePath, err)
+	}
+	if isDir {
+		return s.pathError("rename", filePath, stowage.ErrIsDirectory)
+	}
+	if rel == newRel {
+		return nil
+	}
+
+	if err := s.copyObject(ctx, s.key(rel), s.key(newRel)); err != nil {
+		return s.pathError("rename", filePath, err)
+	}
+
+	return s.pathError("rename", filePath, s.removeObject(ctx, rel))
+}
+
+// Delete deletes the given file it returns error incase there is any
+func (s *S3Storage) Delete(filePath string) error {
+	ctx := context.Background()
+	rel, err := s.resolve("delete", filePath)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFile(ctx, "delete", filePath, rel); err != nil {
+		return err
+	}
+
+	return s.pathError("delete", filePath, s.removeObject(ctx, rel))
+}
+
+// DeleteMultiple deletes multiple files given as slice of strings
+// of file paths, missing files are skipped,
+// it returns error incase there is any
+func (s *S3Storage) DeleteMultiple(filePaths []string) error {
+	ctx := context.Background()
+	for _, file := range filePaths {
+		rel, err := s.resolve("delete", file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			continue
+		}
+		if err := s.removeObject(ctx, rel); err != nil {
+			return s.pathError("delete", file, err)
+		}
+	}
+
+	return nil
+}
+
+// Create helps you create new a file and add content to it,
+// it returns error incase there is any
+func (s *S3Storage) Create(filePath string, content []byte) error {
+	_, err := s.WriteStream(filePath, bytes.NewReader(content))
+
+	return err
+}
+
+// WriteStream creates a new file with the content read from the given
+// reader until EOF, large content is uploaded with a multipart upload
+// holding no more than one part in memory, it returns the number
+// of bytes written and an error incase there is any
+func (s *S3Storage) WriteStream(filePath string, r io.Reader) (int64, error) {
+	ctx := context.Background()
+	rel, err := s.resolve("write", filePath)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkAvailable(ctx, "write", filePath, rel); err != nil {
+		return 0, err
+	}
+
+	n, err := s.upload(ctx, s.key(rel), r, true)
+
+	return n, s.pathError("write", filePath, err)
+}
+
+// Append appends content to a file, S3 objects can't be modified so
+// the object is uploaded again with the content appended to it,
+// it returns error incase there is any
+func (s *S3Storage) Append(filePath string, content []byte) error {
+	ctx := context.Background()
+	rel, err := s.resolve("append", filePath)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.ReadStream(filePath)
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+
+	_, err = s.upload(ctx, s.key(rel), io.MultiReader(current, bytes.NewReader(content)), false)
+
+	return s.pathError("append", filePath, err)
+}
+
+// Exists checks if a file or a directory exists,
+// it returns a bool and an error incase any
+func (s *S3Storage) Exists(filePath string) (bool, error) {
+	ctx := context.Background()
+	rel, err := s.resolve("exists", filePath)
+	if err != nil {
+		return false, err
+	}
+	if rel == "." {
+		return true, nil
+	}
+
+	_, err = s.head(ctx, s.key(rel))
+	if err == nil {
+		return true, nil
+	}
+	if !isNotFound(err) {
+		return false, s.pathError("exists", filePath, err)
+	}
+
+	isDir, err := s.isDir(ctx, rel)
+
+	return isDir, s.pathError("exists", filePath, err)
+}
+
+// Missing checks if a file is missing,
+// it returns a bool and an error incase any
+func (s *S3Storage) Missing(filePath string) (bool, error) {
+	exists, err := s.Exists(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// Read helps you grap the content of a file,
+// it returns the data in a slice of bytes and an error
+// incase there is any
+func (s *S3Storage) Read(filePath string) ([]byte, error) {
+	stream, err := s.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	content, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, s.pathError("read", filePath, err)
+	}
+
+	return content, nil
+}
+
+// ReadStream returns an io.ReadCloser streaming the content of
+// the object, the caller is responsible for closing it,
+// it returns an error incase there is any
+func (s *S3Storage) ReadStream(filePath string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	rel, err := s.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." {
+		return nil, s.pathError("read", filePath, stowage.ErrIsDirectory)
+	}
+
+	resp, err := s.do(ctx, request{method: http.MethodGet, key: s.key(rel)})
+	if err == nil {
+		return resp.Body, nil
+	}
+	if !isNotFound(err) {
+		return nil, s.pathError("read", filePath, err)
+	}
+	if isDir, _ := s.isDir(ctx, rel); isDir {
+		return nil, s.pathError("read", filePath, stowage.ErrIsDirectory)
+	}
+
+	return nil, s.pathError("read", filePath, stowage.ErrNotFound)
+}
+
+// ReadRange returns a reader of length bytes of the given file starting at
+// offset with a ranged GET, a negative length reads up to the end of the
+// file, a range past the end of the file is cut at the end, the caller
+// must close it, it returns an error incase there is any
+func (s *S3Storage) ReadRange(filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	ctx := context.Background()
+	if offset < 0 {
+		return nil, s.pathError("read", filePath, fs.ErrInvalid)
+	}
+	rel, err := s.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		// S3 has no empty ranges
+		if err := s.checkFile(ctx, "read", filePath, rel); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	byteRange := "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	resp, err := s.do(ctx, request{method: http.MethodGet, key: s.key(rel), header: http.Header{"Range": {byteRange}}})
+	if err == nil {
+		return resp.Body, nil
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the offset is past the end of the file
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if err := s.checkFile(ctx, "read", filePath, rel); err != nil {
+		return nil, err
+	}
+
+	return nil, s.pathError("read", filePath, err)
+}
+
+// Files returns a list of files in a given directory,
+// if you want a list of files including the files
+// in sub directories, consider using the method
+// `AllFiles(DirectoryPath string)`
+func (s *S3Storage) Files(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	ctx := context.Background()
+	rel, err := s.resolveDir(ctx, "files", DirectoryPath)
+	if err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	objects, _, err := s.list(ctx, s.dirKey(rel), "/", 0)
+	if err != nil {
+		return []localstorage.FileInfo{}, s.pathError("files", DirectoryPath, err)
+	}
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Key, "/") {
+			// directory marker
+			continue
+		}
+		files = append(files, fileInfo(s.rel(obj.Key), obj.Size, obj.LastModified, false))
+	}
+
+	return files, nil
+}
+
+// AllFiles returns a list of files in the given directory
+// including files in sub directories
+func (s *S3Storage) AllFiles(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	ctx := context.Background()
+	rel, err := s.resolveDir(ctx, "allfiles", DirectoryPath)
+	if err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	objects, _, err := s.list(ctx, s.dirKey(rel), "", 0)
+	if err != nil {
+		return []localstorage.FileInfo{}, s.pathError("allfiles", DirectoryPath, err)
+	}
+	for _, obj := range objects {
+		if !strings.HasSuffix(obj.Key, "/") {
+			files = append(files, fileInfo(s.rel(obj.Key), obj.Size, obj.LastModified, false))
+		}
+	}
+	// list in the order of a file system walk
+	sort.SliceStable(files, func(i, j int) bool {
+		return walkLess(path.Join(files[i].Path, files[i].Name), path.Join(files[j].Path, files[j].Name))
+	})
+
+	return files, nil
+}
+
+// Directories returns a slice of string containing
+// the paths of the sub directories, if you want the list of
+// directories including nested sub directories consider using
+// the method "AllDirectories(DirectoryPath string)"
+func (s *S3Storage) Directories(DirectoryPath string) (SubDirectoryPaths []string, err error) {
+	ctx := context.Background()
+	rel, err := s.resolveDir(ctx, "directories", DirectoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	_, prefixes, err := s.list(ctx, s.dirKey(rel), "/", 0)
+	if err != nil {
+		return []string{}, s.pathError("directories", DirectoryPath, err)
+	}
+	for _, p := range prefixes {
+		SubDirectoryPaths = append(SubDirectoryPaths, fullPath(s.rel(strings.TrimSuffix(p, "/"))))
+	}
+
+	return SubDirectoryPaths, nil
+}
+
+// AllDirectories returns a list of directories including
+// sub directories, it returns an error incase is any
+func (s *S3Storage) AllDirectories(SubDirectoryPath string) (directoryPaths []string, err error) {
+	ctx := context.Background()
+	rel, err := s.resolveDir(ctx, "alldirectories", SubDirectoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	objects, _, err := s.list(ctx, s.dirKey(rel), "", 0)
+	if err != nil {
+		return []string{}, s.pathError("alldirectories", SubDirectoryPath, err)
+	}
+
+	// every parent of an object under the directory is a directory
+	dirs := map[string]bool{}
+	for _, obj := range objects {
+		for p := path.Dir(s.rel(obj.Key)); p != rel && p != "."; p = path.Dir(p) {
+			dirs[p] = true
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			if p := s.rel(strings.TrimSuffix(obj.Key, "/")); p != rel {
+				dirs[p] = true
+			}
+		}
+	}
+	for p := range dirs {
+		directoryPaths = append(directoryPaths, p)
+	}
+	sort.Slice(directoryPaths, func(i, j int) bool {
+		return walkLess(directoryPaths[i], directoryPaths[j])
+	})
+	for i, p := range directoryPaths {
+		directoryPaths[i] = fullPath(p)
+	}
+
+	return directoryPaths, nil
+}
+
+// MakeDirectory creates a directory by uploading an empty marker object,
+// the parent directories exist implicitly, the permissions are ignored,
+// it returns an error incase is any
+func (s *S3Storage) MakeDirectory(DirectoryPath string, perm int) error {
+	ctx := context.Background()
+	rel, err := s.resolve("mkdir", DirectoryPath)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	// a file can't be a directory
+	for p := rel; p != "."; p = path.Dir(p) {
+		_, err := s.head(ctx, s.key(p))
+		if err == nil {
+			return s.pathError("mkdir", DirectoryPath, syscall.ENOTDIR)
+		}
+		if !isNotFound(err) {
+			return s.pathError("mkdir", DirectoryPath, err)
+		}
+	}
+
+	return s.pathError("mkdir", DirectoryPath, s.putObject(ctx, s.dirKey(rel), nil, false))
+}
+
+// RenameDirectory changes the name of directory to new name by copying
+// all its objects under the new prefix then deleting them,
+// it returns an error incase there is any
+func (s *S3Storage) RenameDirectory(DirectoryPath string, NewDirectoryPath string) error {
+	ctx := context.Background()
+	rel, err := s.resolveDir(ctx, "rename", DirectoryPath)
+	if err != nil {
+		return err
+	}
+	newRel, err := s.resolve("rename", NewDirectoryPath)
+	if err != nil {
+		return err
+	}
+	if rel == "." || newRel == rel || strings.HasPrefix(newRel+"/", rel+"/") {
+		return s.pathError("rename", DirectoryPath, syscall.EINVAL)
+	}
+	if exists, err := s.Exists(NewDirectoryPath); err != nil || exists {
+		if err == nil {
+			err = stowage.ErrAlreadyExists
+		}
+		return s.pathError("rename", DirectoryPath, err)
+	}
+
+	objects, _, err := s.list(ctx, s.dirKey(rel), "", 0)
+	if err != nil {
+		return s.pathError("rename", DirectoryPath, err)
+	}
+	for _, obj := range objects {
+		newKey := s.dirKey(newRel) + strings.TrimPrefix(obj.Key, s.dirKey(rel))
+		if err := s.copyObject(ctx, obj.Key, newKey); err != nil {
+			return s.pathError("rename", DirectoryPath, err)
+		}
+	}
+	for _, obj := range objects {
+		if err := s.deleteObject(ctx, obj.Key); err != nil {
+			return s.pathError("rename", DirectoryPath, err)
+		}
+	}
+
+	return s.pathError("rename", DirectoryPath, s.keepParent(ctx, rel))
+}
+
+// DeleteDirectory deletes the given directory
+// along with all its objects
+func (s *S3Storage) DeleteDirectory(DirectoryPath string) error {
+	ctx := context.Background()
+	rel, err := s.resolve("delete", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	objects, _, err := s.list(ctx, s.dirKey(rel), "", 0)
+	if err != nil {
+		return s.pathError("delete", DirectoryPath, err)
+	}
+	for _, obj := range objects {
+		if err := s.deleteObject(ctx, obj.Key); err != nil {
+			return s.pathError("delete", DirectoryPath, err)
+		}
+	}
+	if rel == "." {
+		return nil
+	}
+	// like os.RemoveAll a file is removed as well
+	if err := s.deleteObject(ctx, s.key(rel)); err != nil {
+		return s.pathError("delete", DirectoryPath, err)
+	}
+
+	return s.pathError("delete", DirectoryPath, s.keepParent(ctx, rel))
+}
+
+// resolve cleans the given path and makes it relative to the root,
+// it rejects paths climbing above the root
+func (s *S3Storage) resolve(op string, filePath string) (string, error) {
+	p := path.Clean(filepath.ToSlash(filePath))
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		p = "."
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", s.pathError(op, filePath, stowage.ErrOutsideRoot)
+	}
+
+	return p, nil
+}
+
+// resolveDir resolves the given path and makes sure it's a directory
+func (s *S3Storage) resolveDir(ctx context.Context, op string, DirectoryPath string) (string, error) {
+	rel, err := s.resolve(op, DirectoryPath)
+	if err != nil {
+		return "", err
+	}
+	isDir, err := s.isDir(ctx, rel)
+	if err != nil {
+		return "", s.pathError(op, DirectoryPath, err)
+	}
+	if !isDir {
+		return "", s.pathError(op, DirectoryPath, stowage.ErrNotFound)
+	}
+
+	return rel, nil
+}
+
+// key returns the object key of the given relative path
+func (s *S3Storage) key(rel string) string {
+	if rel == "." {
+		return s.prefix
+	}
+
+	return s.prefix + rel
+}
+
+// dirKey returns the key prefix of the objects under the given directory
+func (s *S3Storage) dirKey(rel string) string {
+	if rel == "." {
+		return s.prefix
+	}
+
+	return s.prefix + rel + "/"
+}
+
+// rel returns the path relative to the root of the given key
+func (s *S3Storage) rel(key string) string {
+	rel := strings.TrimPrefix(key, s.prefix)
+	if rel == "" {
+		return "."
+	}
+
+	return rel
+}
+
+// isDir reports whether there is any object under the given directory
+func (s *S3Storage) isDir(ctx context.Context, rel string) (bool, error) {
+	if rel == "." {
+		return true, nil
+	}
+	objects, prefixes, err := s.list(ctx, s.dirKey(rel), "", 1)
+	if err != nil {
+		return false, err
+	}
+
+	return len(objects) > 0 || len(prefixes) > 0, nil
+}
+
+// checkFile makes sure the path is an existing file
+func (s *S3Storage) checkFile(ctx context.Context, op string, filePath string, rel string) error {
+	if rel == "." {
+		return s.pathError(op, filePath, stowage.ErrIsDirectory)
+	}
+	_, err := s.head(ctx, s.key(rel))
+	if err == nil {
+		return nil
+	}
+	if !isNotFound(err) {
+		return s.pathError(op, filePath, err)
+	}
+	if isDir, _ := s.isDir(ctx, rel); isDir {
+		return s.pathError(op, filePath, stowage.ErrIsDirectory)
+	}
+
+	return s.pathError(op, filePath, stowage.ErrNotFound)
+}
+
+// checkAvailable makes sure a new file can be created at the path
+func (s *S3Storage) checkAvailable(ctx context.Context, op string, filePath string, rel string) error {
+	if rel == "." {
+		return s.pathError(op, filePath, stowage.ErrIsDirectory)
+	}
+	_, err := s.head(ctx, s.key(rel))
+	if err == nil {
+		return s.pathError(op, filePath, stowage.ErrAlreadyExists)
+	}
+	if !isNotFound(err) {
+		return s.pathError(op, filePath, err)
+	}
+	isDir, err := s.isDir(ctx, rel)
+	if err != nil {
+		return s.pathError(op, filePath, err)
+	}
+	if isDir {
+		return s.pathError(op, filePath, stowage.ErrIsDirectory)
+	}
+
+	return nil
+}
+
+// removeObject deletes the object of a file and keeps its
+// parent directory which would vanish once it's empty
+func (s *S3Storage) removeObject(ctx context.Context, rel string) error {
+	if err := s.deleteObject(ctx, s.key(rel)); err != nil {
+		return err
+	}
+
+	return s.keepParent(ctx, rel)
+}
+
+// keepParent uploads the marker of the parent directory, on a file system
+// a directory stays after its content is removed, the marker does the same
+func (s *S3Storage) keepParent(ctx context.Context, rel string) error {
+	parent := path.Dir(rel)
+	if parent == "." {
+		return nil
+	}
+
+	return s.putObject(ctx, s.dirKey(parent), nil, false)
+}
+
+// pathError wraps the given error into a *stowage.PathError
+func (s *S3Storage) pathError(op string, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pathErr *stowage.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		err = stowage.ErrNotFound
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed:
+		err = stowage.ErrAlreadyExists
+	case errors.Is(err, fs.ErrNotExist):
+		err = stowage.ErrNotFound
+	default:
+		if fsErr, ok := err.(*fs.PathError); ok {
+			err = fsErr.Err
+		}
+	}
+
+	return &stowage.PathError{Op: op, Disk: s.name, Path: filePath, Err: err}
+}
+
+// isNotFound reports whether the S3 API responded with status 404
+func isNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// walkLess orders the paths like a file system walk
+// does, the entries of a directory sorted by name
+func walkLess(a string, b string) bool {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+
+	return len(as) < len(bs)
+}
+
+// fullPath returns the path as seen from the root
+func fullPath(rel string) string {
+	return path.Join("/", rel)
+}
+
+// fileInfo builds the file information of an object or a directory
+func fileInfo(rel string, size int64, modTime time.Time, isDir bool) localstorage.FileInfo {
+	full := fullPath(rel)
+	name := path.Base(full)
+	ext := path.Ext(full)
+	info := &objectInfo{name: name, size: size, modTime: modTime, isDir: isDir}
+	contentType := ""
+	if !isDir {
+		contentType = localstorage.ContentTypeOrDefault(name)
+	}
+
+	return localstorage.FileInfo{
+		Name:                 name,
+		Extension:            localstorage.Extension(full),
+		NameWithoutExtension: strings.TrimSuffix(name, ext),
+		Size:                 size,
+		Path:                 path.Dir(full),
+		LastModified:         modTime,
+		IsDirectory:          isDir,
+		FsFileInfo:           info,
+		ContentType:          contentType,
+	}
+}
+
+// objectInfo implements fs.FileInfo for the objects
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i *objectInfo) Name() string       { return i.name }
+func (i *objectInfo) Size() int64        { return i.size }
+func (i *objectInfo) ModTime() time.Time { return i.modTime }
+func (i *objectInfo) IsDir() bool        { return i.isDir }
+func (i *objectInfo) Sys() interface{}   { return nil }
+
+func (i *objectInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package s3storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/harranali/stowage"
+	. "github.com/harranali/stowage/s3storage"
+	"github.com/harranali/stowage/s3storage/internal/fakes3"
+)
+
+// newDisk creates an s3 storage backed by a fake server
+func newDisk(t *testing.T) (*S3Storage, *fakes3.Server) {
+	return newDiskWith(t, func(h http.Handler) http.Handler { return h })
+}
+
+// newDiskWith creates an s3 storage backed by a fake
+// server whose handler is wrapped with the given function
+func newDiskWith(t *testing.T, wrap func(http.Handler) http.Handler) (*S3Storage, *fakes3.Server) {
+	fake := fakes3.New("AKIDEXAMPLE")
+	fake.CreateBucket("stowage")
+	server := httptest.NewServer(wrap(fake))
+	t.Cleanup(server.Close)
+
+	s, err := New(Opts{
+		Endpoint:        server.URL,
+		Region:          "eu-west-1",
+		Bucket:          "stowage",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Prefix:          "/root/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, fake
+}
+
+func TestNew(t *testing.T) {
+	s, _ := newDisk(t)
+	if fmt.Sprintf("%T", s) != "*s3storage.S3Storage" {
+		t.Error("failed initiating s3storage")
+	}
+	if s.Name() != "s3" {
+		t.Error("failed asserting default name")
+	}
+	if _, err := New(Opts{Endpoint: "localhost:9000", Bucket: "stowage"}); err == nil {
+		t.Error("failed asserting invalid endpoint")
+	}
+	if _, err := New(Opts{Endpoint: "http://localhost:9000"}); err == nil {
+		t.Error("failed asserting missing bucket")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	s, fake := newDisk(t)
+	s.Create("sub/file.md", []byte("content"))
+
+	keys := fake.Keys("stowage")
+	if len(keys) != 1 || keys[0] != "root/sub/file.md" {
+		t.Error("failed asserting the key prefix. ", keys)
+	}
+}
+
+func TestMoveKeepsDirectory(t *testing.T) {
+	s, _ := newDisk(t)
+	s.Create("files/sub/filetolist3.md", []byte("this is a test file"))
+
+	if err := s.Move("files/sub/filetolist3.md", "/sub1/sub2"); err != nil {
+		t.Error("failed asserting moving file to sub dir. ", err)
+	}
+	if yes, _ := s.Missing("files/sub/filetolist3.md"); !yes {
+		t.Error("source file still present after moving")
+	}
+	// the emptied directory stays like it does on a file system
+	if yes, _ := s.Exists("files/sub"); !yes {
+		t.Error("failed asserting the source directory is kept")
+	}
+	if err := s.MoveAs("sub1/sub2/filetolist3.md", "/", "moved.md"); err != nil {
+		t.Error("failed asserting moveAs. ", err)
+	}
+	if yes, _ := s.Exists("moved.md"); !yes {
+		t.Error("failed asserting moveAs: dest file not exist")
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	s, _ := newDisk(t)
+
+	// larger than one part of 5MiB
+	content := bytes.Repeat([]byte("0123456789abcdef"), 700*1024)
+	n, err := s.WriteStream("large.bin", bytes.NewReader(content))
+	if err != nil || n != int64(len(content)) {
+		t.Fatal("failed assert multipart upload. ", err)
+	}
+	uploaded, err := s.Read("large.bin")
+	if err != nil || !bytes.Equal(uploaded, content) {
+		t.Error("failed assert multipart upload content. ", err)
+	}
+	if _, err := s.WriteStream("large.bin", bytes.NewReader(content)); !errors.Is(err, stowage.ErrAlreadyExists) {
+		t.Error("failed assert multipart upload of existing file. ", err)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s, _ := newDisk(t)
+	// more than the 1000 keys of one listing page
+	for i := 0; i < 1005; i++ {
+		if err := s.Create(fmt.Sprintf("many/file%04d.md", i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := s.Files("many")
+	if err != nil || len(files) != 1005 {
+		t.Error("failed asserting paginated listing. ", len(files), err)
+	}
+}
+
+// countingWriter counts the bytes of the response bodies
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+func TestFileServerRange(t *testing.T) {
+	var served int64
+	s, _ := newDiskWith(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(&countingWriter{ResponseWriter: w, n: &served}, r)
+		})
+	})
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	if _, err := s.WriteStream("large.bin", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt64(&served, 0)
+	req := httptest.NewRequest(http.MethodGet, "/large.bin", nil)
+	req.Header.Set("Range", "bytes=100-199")
+	w := httptest.NewRecorder()
+	stowage.FileServer(s, stowage.FileServerOpts{}).ServeHTTP(w, req)
+
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), content[100:200]) {
+		t.Errorf("failed asserting the served range: %d %d bytes", w.Code, w.Body.Len())
+	}
+	if n := atomic.LoadInt64(&served); n > 4096 {
+		t.Errorf("failed asserting only the range is read from s3: %d bytes", n)
+	}
+}
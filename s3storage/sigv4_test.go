@@ -0,0 +1,42 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package s3storage
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignV4 signs the example request of the AWS signature version 4 docs
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := credentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now, _ := time.Parse(amzDateFormat, "20150830T123600Z")
+
+	signV4(req, emptyPayloadHash, creds, "us-east-1", "iam", now)
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, ") {
+		t.Error("failed asserting the credential scope. ", auth)
+	}
+	if !strings.HasSuffix(auth, "Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7") {
+		t.Error("failed asserting the signature. ", auth)
+	}
+}
+
+func TestURIEncode(t *testing.T) {
+	if uriEncode("a b/c~d+e", false) != "a%20b/c~d%2Be" {
+		t.Error("failed asserting uri encode")
+	}
+	if uriEncode("a/b", true) != "a%2Fb" {
+		t.Error("failed asserting uri encode of slash")
+	}
+}
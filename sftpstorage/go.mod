@@ -0,0 +1,14 @@
+module github.com/harranali/stowage/sftpstorage
+
+go 1.26.0
+
+require (
+	github.com/harranali/stowage v0.0.0-20261017175125-3e5d6914d9ab
+	github.com/pkg/sftp v1.13.11
+	golang.org/x/crypto v0.57.0
+)
+
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+)
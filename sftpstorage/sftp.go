@@ -0,0 +1,977 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sftpstorage implements stowage.Disk over an SSH connection
+// using the SFTP protocol, the connection is opened once and reused by
+// all operations, it's opened again when it gets lost
+package sftpstorage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// make sure the sftp storage supports all operations
+var _ stowage.Disk = (*SFTPStorage)(nil)
+
+// SFTPStorage sftp storage
+type SFTPStorage struct {
+	name       string
+	addr       string
+	rootFolder string
+	config     *ssh.ClientConfig
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// Opts options for initiating sftp storage
+type Opts struct {
+	// Addr is the address of the SSH server, for example "example.com:22"
+	Addr string
+	User string
+
+	// Password enables the password authentication
+	Password string
+	// PrivateKey enables the public key authentication
+	// with the given PEM encoded private key
+	PrivateKey []byte
+	// PrivateKeyPassphrase decrypts the private key incase it's encrypted
+	PrivateKeyPassphrase []byte
+
+	// HostKeyCallback verifies the key of the server, it's required,
+	// see golang.org/x/crypto/ssh/knownhosts for checking known_hosts files
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout limits the time spent on establishing the connection
+	Timeout time.Duration
+
+	// RootFolder is the remote folder all the paths are relative to,
+	// it defaults to the login directory of the user
+	RootFolder string
+	// Name identifies the disk in the returned errors,
+	// it defaults to "sftp"
+	Name string
+}
+
+// conn is an established connection
+type conn struct {
+	ssh  *ssh.Client
+	sftp *sftp.Client
+	done chan struct{}
+}
+
+// New initiate sftp storage and opens the connection,
+// it returns an error incase there is any
+func New(opts Opts) (*SFTPStorage, error) {
+	if opts.HostKeyCallback == nil {
+		return nil, errors.New("sftp: the host key callback is required")
+	}
+	auth := []ssh.AuthMethod{}
+	if len(opts.PrivateKey) > 0 {
+		var signer ssh.Signer
+		var err error
+		if len(opts.PrivateKeyPassphrase) > 0 {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(opts.PrivateKey, opts.PrivateKeyPassphrase)
+		} else {
+			signer, err = ssh.ParsePrivateKey(opts.PrivateKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp: a password or a private key is required")
+	}
+	if opts.Name == "" {
+		opts.Name = "sftp"
+	}
+	rootFolder := path.Clean(filepath.ToSlash(opts.RootFolder))
+	if opts.RootFolder == "" {
+		rootFolder = "."
+	}
+
+	s := &SFTPStorage{
+		name:       opts.Name,
+		addr:       opts.Addr,
+		rootFolder: rootFolder,
+		config: &ssh.ClientConfig{
+			User:            opts.User,
+			Auth:            auth,
+			HostKeyCallback: opts.HostKeyCallback,
+			Timeout:         opts.Timeout,
+		},
+	}
+	if _, err := s.client(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Name returns the name of the disk
+func (s *SFTPStorage) Name() string {
+	return s.name
+}
+
+// Close closes the connection, the next operation opens it again
+func (s *SFTPStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.close()
+	s.conn = nil
+
+	return err
+}
+
+// FileInfo returns information about the given file or directory
+// or an error incase there is any
+func (s *SFTPStorage) FileInfo(filePath string) (fileinfo localstorage.FileInfo, err error) {
+	rel, err := s.resolve("fileinfo", filePath)
+	if err != nil {
+		return localstorage.FileInfo{}, err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		info, err := c.Stat(s.fullPath(rel))
+		if err != nil {
+			return err
+		}
+		fileinfo = fileInfo(rel, info)
+		return nil
+	})
+
+	return fileinfo, s.pathError("fileinfo", filePath, err)
+}
+
+// Put uploads the given file from the local file system
+// into the root folder, it returns error incase there is any
+func (s *SFTPStorage) Put(filePath string) error {
+	return s.PutAs(filePath, filepath.Base(filePath))
+}
+
+// PutAs uploads the given file from the local file system into the
+// root folder with the given name, it returns error incase there is any
+func (s *SFTPStorage) PutAs(filePath string, filename string) error {
+	st, err := os.Stat(filePath)
+	if err != nil {
+		return s.pathError("put", filePath, err)
+	}
+	if err := checkRegular(st); err != nil {
+		return s.pathError("put", filePath, err)
+	}
+
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return s.pathError("put", filePath, err)
+	}
+	defer srcFile.Close()
+
+	_, err = s.WriteStream(filename, srcFile)
+
+	return err
+}
+
+// Copy copies the file into the destination folder,
+// it returns an error incase there is any
+func (s *SFTPStorage) Copy(filePath string, destfolder string) error {
+	return s.CopyAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// CopyAs copies the file into the destination folder with the given name,
+// SFTP has no server side copy so the content is streamed through the
+// connection, it returns an error incase there is any
+func (s *SFTPStorage) CopyAs(filePath string, destfolder string, newFilePath string) error {
+	src, err := s.ReadStream(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = s.WriteStream(path.Join(filepath.ToSlash(destfolder), newFilePath), src)
+
+	return err
+}
+
+// Move moves the file into the destination folder,
+// it returns an error incase there any
+func (s *SFTPStorage) Move(filePath string, destfolder string) error {
+	return s.MoveAs(filePath, destfolder, path.Base(filepath.ToSlash(filePath)))
+}
+
+// MoveAs moves the file into the destination folder with the given
+// name, the file is renamed on the server so the content isn't
+// transferred, it returns an error incase there any
+func (s *SFTPStorage) MoveAs(filePath string, destFolder string, newFilePath string) error {
+	rel, err := s.resolve("move", filePath)
+	if err != nil {
+		return err
+	}
+	destRel, err := s.resolve("move", path.Join(filepath.ToSlash(destFolder), newFilePath))
+	if err != nil {
+		return err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		if err := s.checkFile(c, rel); err != nil {
+			return err
+		}
+		if err := s.checkAvailable(c, destRel); err != nil {
+			return err
+		}
+		if err := c.MkdirAll(path.Dir(s.fullPath(destRel))); err != nil {
+			return err
+		}
+		return c.Rename(s.fullPath(rel), s.fullPath(destRel))
+	})
+
+	return s.pathError("move", filePath, err)
+}
+
+// Rename renames the given file as first parameter to the name
+// given as a second parameter, an existing file with the new
+// name is replaced, it returns error incase there is any
+func (s *SFTPStorage) Rename(filePath string, newFilePath string) error {
+	rel, err := s.resolve("rename", filePath)
+	if err != nil {
+		return err
+	}
+	newRel, err := s.resolve("rename", newFilePath)
+	if err != nil {
+		return err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		if err := s.checkFile(c, rel); err != nil {
+			return err
+		}
+		return s.rename(c, s.fullPath(rel), s.fullPath(newRel))
+	})
+
+	return s.pathError("rename", filePath, err)
+}
+
+// Delete deletes the given file it returns error incase there is any
+func (s *SFTPStorage) Delete(filePath string) error {
+	rel, err := s.resolve("delete", filePath)
+	if err != nil {
+		return err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		if err := s.checkFile(c, rel); err != nil {
+			return err
+		}
+		return c.Remove(s.fullPath(rel))
+	})
+
+	return s.pathError("delete", filePath, err)
+}
+
+// DeleteMultiple deletes multiple files given as slice of strings
+// of file paths, it returns error incase there is any
+func (s *SFTPStorage) DeleteMultiple(filePaths []string) error {
+	for _, file := range filePaths {
+		rel, err := s.resolve("delete", file)
+		if err != nil {
+			return err
+		}
+		err = s.run(func(c *sftp.Client) error {
+			// missing files and directories are skipped
+			info, err := c.Stat(s.fullPath(rel))
+			if errors.Is(err, fs.ErrNotExist) || (err == nil && checkRegular(info) != nil) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = c.Remove(s.fullPath(rel))
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return s.pathError("delete", file, err)
+		}
+	}
+
+	return nil
+}
+
+// Create helps you create new a file and add content to it,
+// it returns error incase there is any
+func (s *SFTPStorage) Create(filePath string, content []byte) error {
+	_, err := s.WriteStream(filePath, bytes.NewReader(content))
+
+	return err
+}
+
+// WriteStream creates a new file with the content read from the
+// given reader until EOF, the parent directories are created as needed,
+// the content is written into a hidden temp file next to the file which
+// is moved into place once complete, so a failed write leaves no file,
+// it returns the number of bytes written and an error incase there is any
+func (s *SFTPStorage) WriteStream(filePath string, r io.Reader) (int64, error) {
+	rel, err := s.resolve("write", filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	// the reader can't be read twice so the write isn't retried
+	c, err := s.client()
+	if err != nil {
+		return 0, s.pathError("write", filePath, err)
+	}
+	if err := s.checkAvailable(c, rel); err != nil {
+		return 0, s.pathError("write", filePath, err)
+	}
+	fullPath := s.fullPath(rel)
+	if err := c.MkdirAll(path.Dir(fullPath)); err != nil {
+		return 0, s.pathError("write", filePath, err)
+	}
+	tmpPath, file, err := createTemp(c, fullPath)
+	if err != nil {
+		return 0, s.pathError("write", filePath, err)
+	}
+	n, err := file.ReadFrom(r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.link(c, tmpPath, fullPath)
+	}
+	// the servers without the hardlink extension renamed the temp file
+	// away, the others linked it and still have it, so remove it anyway
+	c.Remove(tmpPath)
+	if err != nil {
+		return 0, s.pathError("write", filePath, err)
+	}
+
+	return n, nil
+}
+
+// Append appends content to a file,
+// it returns error incase there is any
+func (s *SFTPStorage) Append(filePath string, content []byte) error {
+	rel, err := s.resolve("append", filePath)
+	if err != nil {
+		return err
+	}
+
+	// appending twice must be avoided so the write isn't retried
+	c, err := s.client()
+	if err != nil {
+		return s.pathError("append", filePath, err)
+	}
+	if err := s.checkFile(c, rel); err != nil {
+		return s.pathError("append", filePath, err)
+	}
+	file, err := c.OpenFile(s.fullPath(rel), os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		return s.pathError("append", filePath, err)
+	}
+	// not every server honors the append flag, so write at the end explicitly
+	_, err = file.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = file.Write(content)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return s.pathError("append", filePath, err)
+}
+
+// Exists checks if a file or a directory exists,
+// it returns a bool and an error incase any
+func (s *SFTPStorage) Exists(filePath string) (bool, error) {
+	rel, err := s.resolve("exists", filePath)
+	if err != nil {
+		return false, err
+	}
+
+	exists := false
+	err = s.run(func(c *sftp.Client) error {
+		_, err := c.Stat(s.fullPath(rel))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		exists = err == nil
+		return err
+	})
+
+	return exists, s.pathError("exists", filePath, err)
+}
+
+// Missing checks if a file is missing,
+// it returns a bool and an error incase any
+func (s *SFTPStorage) Missing(filePath string) (bool, error) {
+	exists, err := s.Exists(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// Read helps you grap the content of a file,
+// it returns the data in a slice of bytes and an error
+// incase there is any
+func (s *SFTPStorage) Read(filePath string) ([]byte, error) {
+	rel, err := s.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	err = s.run(func(c *sftp.Client) error {
+		file, err := s.open(c, rel)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		content, err = ioutil.ReadAll(file)
+		return err
+	})
+	if err != nil {
+		return nil, s.pathError("read", filePath, err)
+	}
+
+	return content, nil
+}
+
+// ReadStream returns an io.ReadCloser streaming the content of
+// the file, the caller is responsible for closing it,
+// it returns an error incase there is any
+func (s *SFTPStorage) ReadStream(filePath string) (io.ReadCloser, error) {
+	rel, err := s.resolve("read", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *sftp.File
+	err = s.run(func(c *sftp.Client) error {
+		file, err = s.open(c, rel)
+		return err
+	})
+	if err != nil {
+		return nil, s.pathError("read", filePath, err)
+	}
+
+	return file, nil
+}
+
+// Files returns a list of files in a given directory,
+// if you want a list of files including the files
+// in sub directories, consider using the method
+// `AllFiles(DirectoryPath string)`
+func (s *SFTPStorage) Files(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	rel, err := s.resolve("files", DirectoryPath)
+	if err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		files = nil
+		entries, err := s.readDir(c, rel)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, fileInfo(path.Join(rel, entry.Name()), entry))
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return []localstorage.FileInfo{}, s.pathError("files", DirectoryPath, err)
+	}
+
+	return files, nil
+}
+
+// AllFiles returns a list of files in the given directory
+// including files in sub directories
+func (s *SFTPStorage) AllFiles(DirectoryPath string) (files []localstorage.FileInfo, err error) {
+	rel, err := s.resolve("allfiles", DirectoryPath)
+	if err != nil {
+		return []localstorage.FileInfo{}, err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		files = nil
+		return s.walk(c, rel, func(entryRel string, info fs.FileInfo) {
+			if !info.IsDir() {
+				files = append(files, fileInfo(entryRel, info))
+			}
+		})
+	})
+	if err != nil {
+		return []localstorage.FileInfo{}, s.pathError("allfiles", DirectoryPath, err)
+	}
+
+	return files, nil
+}
+
+// Directories returns a slice of string containing
+// the paths of the sub directories, if you want the list of
+// directories including nested sub directories consider using
+// the method "AllDirectories(DirectoryPath string)"
+func (s *SFTPStorage) Directories(DirectoryPath string) (SubDirectoryPaths []string, err error) {
+	rel, err := s.resolve("directories", DirectoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		SubDirectoryPaths = nil
+		entries, err := s.readDir(c, rel)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				SubDirectoryPaths = append(SubDirectoryPaths, rootedPath(path.Join(rel, entry.Name())))
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return []string{}, s.pathError("directories", DirectoryPath, err)
+	}
+
+	return SubDirectoryPaths, nil
+}
+
+// AllDirectories returns a list of directories including
+// sub directories, it returns an error incase is any
+func (s *SFTPStorage) AllDirectories(SubDirectoryPath string) (directoryPaths []string, err error) {
+	rel, err := s.resolve("alldirectories", SubDirectoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		directoryPaths = nil
+		return s.walk(c, rel, func(entryRel string, info fs.FileInfo) {
+			if info.IsDir() {
+				directoryPaths = append(directoryPaths, rootedPath(entryRel))
+			}
+		})
+	})
+	if err != nil {
+		return []string{}, s.pathError("alldirectories", SubDirectoryPath, err)
+	}
+
+	return directoryPaths, nil
+}
+
+// MakeDirectory creates a new directory and the necessary
+// parent directories with the given permissions,
+// it returns an error incase is any
+func (s *SFTPStorage) MakeDirectory(DirectoryPath string, perm int) error {
+	rel, err := s.resolve("mkdir", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		fullPath := s.fullPath(rel)
+		if info, err := c.Stat(fullPath); err == nil {
+			if !info.IsDir() {
+				return syscall.ENOTDIR
+			}
+			return nil
+		}
+		if err := c.MkdirAll(fullPath); err != nil {
+			return err
+		}
+		return c.Chmod(fullPath, fs.FileMode(perm))
+	})
+
+	return s.pathError("mkdir", DirectoryPath, err)
+}
+
+// RenameDirectory changes the name of directory to new name,
+// it returns an error incase there is any
+func (s *SFTPStorage) RenameDirectory(DirectoryPath string, NewDirectoryPath string) error {
+	rel, err := s.resolve("rename", DirectoryPath)
+	if err != nil {
+		return err
+	}
+	newRel, err := s.resolve("rename", NewDirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		return s.rename(c, s.fullPath(rel), s.fullPath(newRel))
+	})
+
+	return s.pathError("rename", DirectoryPath, err)
+}
+
+// DeleteDirectory deletes the given directory along with its content
+func (s *SFTPStorage) DeleteDirectory(DirectoryPath string) error {
+	rel, err := s.resolve("delete", DirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	err = s.run(func(c *sftp.Client) error {
+		return removeAll(c, s.fullPath(rel))
+	})
+
+	return s.pathError("delete", DirectoryPath, err)
+}
+
+// client returns the connected sftp client,
+// the connection is opened again incase it got lost
+func (s *SFTPStorage) client() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		select {
+		case <-s.conn.done:
+			// the connection is lost
+			s.conn.close()
+			s.conn = nil
+		default:
+			return s.conn.sftp, nil
+		}
+	}
+
+	c, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.conn = c
+
+	return c.sftp, nil
+}
+
+// dial opens the SSH connection and starts the sftp subsystem
+func (s *SFTPStorage) dial() (*conn, error) {
+	sshClient, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return nil, err
+	}
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+
+	c := &conn{ssh: sshClient, sftp: sftpClient, done: make(chan struct{})}
+	go func() {
+		sftpClient.Wait()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// drop forgets the connection of the given client so
+// the next operation opens a new one
+func (s *SFTPStorage) drop(c *sftp.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.sftp == c {
+		s.conn.close()
+		s.conn = nil
+	}
+}
+
+// run runs the operation with the connected client, incase the
+// connection got lost during the operation it's run again once
+// with a new connection, so the operation must be safe to repeat
+func (s *SFTPStorage) run(op func(c *sftp.Client) error) error {
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+	err = op(c)
+	if !isConnectionLost(err) {
+		return err
+	}
+
+	s.drop(c)
+	c, err = s.client()
+	if err != nil {
+		return err
+	}
+
+	return op(c)
+}
+
+func (c *conn) close() error {
+	c.sftp.Close()
+	return c.ssh.Close()
+}
+
+// isConnectionLost reports whether the error is caused by a broken connection
+func isConnectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// resolve cleans the given path and makes it relative to the root,
+// it rejects paths climbing above the root
+func (s *SFTPStorage) resolve(op string, filePath string) (string, error) {
+	p := path.Clean(filepath.ToSlash(filePath))
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		p = "."
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", s.pathError(op, filePath, stowage.ErrOutsideRoot)
+	}
+
+	return p, nil
+}
+
+// fullPath returns the remote path of the given relative path
+func (s *SFTPStorage) fullPath(rel string) string {
+	return path.Join(s.rootFolder, rel)
+}
+
+// open opens the file for reading after making sure it's a regular file
+func (s *SFTPStorage) open(c *sftp.Client, rel string) (*sftp.File, error) {
+	if err := s.checkFile(c, rel); err != nil {
+		return nil, err
+	}
+
+	return c.Open(s.fullPath(rel))
+}
+
+// checkFile makes sure the path is an existing regular file
+func (s *SFTPStorage) checkFile(c *sftp.Client, rel string) error {
+	info, err := c.Stat(s.fullPath(rel))
+	if err != nil {
+		return err
+	}
+
+	return checkRegular(info)
+}
+
+// checkAvailable makes sure a new file can be created at the path
+func (s *SFTPStorage) checkAvailable(c *sftp.Client, rel string) error {
+	info, err := c.Stat(s.fullPath(rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return stowage.ErrIsDirectory
+	}
+
+	return stowage.ErrAlreadyExists
+}
+
+// rename renames replacing the destination, the posix rename
+// extension is used when the server supports it
+func (s *SFTPStorage) rename(c *sftp.Client, oldPath string, newPath string) error {
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+		return c.PosixRename(oldPath, newPath)
+	}
+	if info, err := c.Stat(newPath); err == nil && !info.IsDir() {
+		if err := c.Remove(newPath); err != nil {
+			return err
+		}
+	}
+
+	return c.Rename(oldPath, newPath)
+}
+
+// link links the file to the destination failing if it exists, the
+// hardlink extension is used when the server supports it, the others
+// check the destination before renaming which isn't safe against races
+func (s *SFTPStorage) link(c *sftp.Client, oldPath string, newPath string) error {
+	if _, ok := c.HasExtension("hardlink@openssh.com"); ok {
+		err := c.Link(oldPath, newPath)
+		// servers report an existing destination as a generic failure
+		if err != nil {
+			if _, statErr := c.Lstat(newPath); statErr == nil {
+				err = stowage.ErrAlreadyExists
+			}
+		}
+		return err
+	}
+	if _, err := c.Lstat(newPath); err == nil {
+		return stowage.ErrAlreadyExists
+	}
+
+	return s.rename(c, oldPath, newPath)
+}
+
+// createTemp creates a hidden temp file next to the destination
+func createTemp(c *sftp.Client, fullPath string) (string, *sftp.File, error) {
+	dir, name := path.Split(fullPath)
+	for {
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", nil, err
+		}
+		tmpPath := path.Join(dir, "."+name+".tmp-"+hex.EncodeToString(suffix))
+		file, err := c.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		if err != nil {
+			// servers report an existing file as a generic failure
+			if _, statErr := c.Lstat(tmpPath); statErr == nil {
+				continue
+			}
+		}
+		return tmpPath, file, err
+	}
+}
+
+// readDir lists the directory sorted by name
+func (s *SFTPStorage) readDir(c *sftp.Client, rel string) ([]fs.FileInfo, error) {
+	entries, err := c.ReadDir(s.fullPath(rel))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// walk walks the directory tree in lexical order
+// like filepath.Walk without visiting the root
+func (s *SFTPStorage) walk(c *sftp.Client, rel string, fn func(rel string, info fs.FileInfo)) error {
+	entries, err := s.readDir(c, rel)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+		fn(entryRel, entry)
+		if entry.IsDir() {
+			if err := s.walk(c, entryRel, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeAll removes the path along with its content,
+// like os.RemoveAll a missing path isn't an error
+func removeAll(c *sftp.Client, fullPath string) error {
+	info, err := c.Lstat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := c.ReadDir(fullPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := removeAll(c, path.Join(fullPath, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return c.RemoveDirectory(fullPath)
+	}
+
+	return c.Remove(fullPath)
+}
+
+// pathError wraps the given error into a *stowage.PathError
+func (s *SFTPStorage) pathError(op string, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pathErr *stowage.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = stowage.ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		err = stowage.ErrAlreadyExists
+	default:
+		if fsErr, ok := err.(*fs.PathError); ok {
+			err = fsErr.Err
+		}
+	}
+
+	return &stowage.PathError{Op: op, Disk: s.name, Path: filePath, Err: err}
+}
+
+// checkRegular makes sure the file is a regular file
+func checkRegular(info fs.FileInfo) error {
+	if info.IsDir() {
+		return stowage.ErrIsDirectory
+	}
+	if !info.Mode().IsRegular() {
+		return stowage.ErrNotRegular
+	}
+
+	return nil
+}
+
+// rootedPath returns the path as seen from the root
+func rootedPath(rel string) string {
+	return path.Join("/", rel)
+}
+
+// fileInfo builds the file information of the entry
+func fileInfo(rel string, info fs.FileInfo) localstorage.FileInfo {
+	full := rootedPath(rel)
+	ext := path.Ext(full)
+	contentType := ""
+	if !info.IsDir() {
+		contentType = localstorage.ContentTypeOrDefault(info.Name())
+	}
+
+	return localstorage.FileInfo{
+		Name:                 info.Name(),
+		Extension:            localstorage.Extension(full),
+		NameWithoutExtension: strings.TrimSuffix(info.Name(), ext),
+		Size:                 info.Size(),
+		Path:                 path.Dir(full),
+		LastModified:         info.ModTime(),
+		IsDirectory:          info.IsDir(),
+		FsFileInfo:           info,
+		ContentType:          contentType,
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package sftpstorage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/memstorage"
+	. "github.com/harranali/stowage/sftpstorage"
+	"golang.org/x/crypto/ssh"
+)
+
+// newDisk connects an sftp storage to a test server
+// with a temporary root folder
+func newDisk(t *testing.T) (*SFTPStorage, *testServer, string) {
+	srv := newTestServer(t)
+	root := t.TempDir()
+	s, err := New(Opts{
+		Addr:            srv.addr,
+		User:            "tester",
+		Password:        "secret",
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey),
+		RootFolder:      root,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s, srv, root
+}
+
+func TestNew(t *testing.T) {
+	s, srv, _ := newDisk(t)
+	if fmt.Sprintf("%T", s) != "*sftpstorage.SFTPStorage" {
+		t.Error("failed initiating sftpstorage")
+	}
+	if s.Name() != "sftp" {
+		t.Error("failed asserting default name")
+	}
+
+	_, err := New(Opts{Addr: srv.addr, User: "tester", Password: "wrong", HostKeyCallback: ssh.FixedHostKey(srv.hostKey)})
+	if err == nil {
+		t.Error("failed asserting wrong password")
+	}
+	_, err = New(Opts{Addr: srv.addr, User: "tester", Password: "secret"})
+	if err == nil {
+		t.Error("failed asserting missing host key callback")
+	}
+	_, err = New(Opts{Addr: srv.addr, User: "tester", HostKeyCallback: ssh.FixedHostKey(srv.hostKey)})
+	if err == nil {
+		t.Error("failed asserting missing credentials")
+	}
+}
+
+func TestKeyAuth(t *testing.T) {
+	srv := newTestServer(t)
+	s, err := New(Opts{
+		Addr:            srv.addr,
+		User:            "tester",
+		PrivateKey:      srv.clientKey,
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey),
+		RootFolder:      t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal("failed asserting key authentication. ", err)
+	}
+	defer s.Close()
+	if err := s.Create("file.md", []byte("content")); err != nil {
+		t.Error("failed asserting key authenticated create. ", err)
+	}
+}
+
+func TestWriteStreamTempFile(t *testing.T) {
+	s, _, root := newDisk(t)
+
+	content := strings.Repeat("streamed content\n", 10000)
+	if _, err := s.WriteStream("filetostream.md", strings.NewReader(content)); err != nil {
+		t.Fatal("failed assert writing file stream. ", err)
+	}
+
+	// a failed write leaves neither the file nor its temp file
+	failing := io.MultiReader(strings.NewReader(content), iotest.ErrReader(errors.New("broken")))
+	if _, err := s.WriteStream("streams/failed.md", failing); err == nil {
+		t.Error("failed asserting the read error is returned")
+	}
+	if exists, _ := s.Exists("streams/failed.md"); exists {
+		t.Error("failed asserting a failed write leaves no file")
+	}
+	entries, _ := ioutil.ReadDir(filepath.Join(root, "streams"))
+	if len(entries) != 0 {
+		t.Errorf("failed asserting the temp file is removed, got %d entries", len(entries))
+	}
+
+	// an existing file is kept
+	if _, err := s.WriteStream("filetostream.md", strings.NewReader("other")); !errors.Is(err, stowage.ErrAlreadyExists) {
+		t.Errorf("failed asserting an existing file is reported, got %v", err)
+	}
+	if kept, _ := s.Read("filetostream.md"); string(kept) != content {
+		t.Error("failed asserting the existing file is kept")
+	}
+}
+
+func TestSyncKeepsWholeSeconds(t *testing.T) {
+	s, _, _ := newDisk(t)
+	src := memstorage.New()
+	src.Create("a.txt", []byte("a"))
+	src.Create("docs/b.txt", []byte("bb"))
+
+	if _, err := stowage.Sync(context.Background(), src, s, stowage.SyncOpts{}); err != nil {
+		t.Fatal("failed assert syncing into sftp. ", err)
+	}
+	// sftp keeps the times in whole seconds, the copies look
+	// older than their sources yet they're unchanged
+	report, err := stowage.Sync(context.Background(), src, s, stowage.SyncOpts{})
+	if err != nil || len(report.Updated) != 0 || len(report.Skipped) != 2 {
+		t.Errorf("failed assert an unchanged sync into sftp: %+v %v", report, err)
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	s, srv, _ := newDisk(t)
+	s.Create("filetoread.md", []byte("contentToRead"))
+
+	for i := 0; i < 10; i++ {
+		if _, err := s.Read("filetoread.md"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.connections() != 1 {
+		t.Error("failed asserting connection reuse. ", srv.connections())
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	s, srv, _ := newDisk(t)
+	s.Create("filetoread.md", []byte("contentToRead"))
+
+	srv.dropConnections()
+	content, err := s.Read("filetoread.md")
+	if err != nil || string(content) != "contentToRead" {
+		t.Error("failed asserting reconnection. ", err)
+	}
+
+	s.Close()
+	if yes, err := s.Exists("filetoread.md"); err != nil || !yes {
+		t.Error("failed asserting reconnection after close. ", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/harranali/stowage/localstorage"
+)
+
+// errors returned by the signed urls
+var (
+	ErrNoSigningKey     = localstorage.ErrNoSigningKey
+	ErrInvalidSignature = localstorage.ErrInvalidSignature
+	ErrExpiredSignature = localstorage.ErrExpiredSignature
+)
+
+// SigningKey is a secret used to sign urls, the ID is sent
+// along with the signature so keys can be rotated
+type SigningKey = localstorage.SigningKey
+
+// SignedURLOpts options bound to a signed url
+type SignedURLOpts = localstorage.SignedURLOpts
+
+// SignedURLDisk defines the signed urls operation
+type SignedURLDisk interface {
+	SignedURL(filePath string, ttl time.Duration, opts SignedURLOpts) (string, error)
+}
+
+// make sure the local storage signs urls
+var _ SignedURLDisk = (*localstorage.LocalStorage)(nil)
+
+// dispositionKey is the context key of the disposition bound to a signed url
+type dispositionKey struct{}
+
+// RequireSignedURL returns a handler that lets through the requests with a
+// valid and unexpired signed url only, it's meant to wrap FileServer with
+// the base url of the signed urls stripped from the request path, the
+// disposition bound to the url is applied by FileServer, any of the keys
+// can match so new keys can be added before the old ones are removed
+func RequireSignedURL(keys []SigningKey, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts, err := localstorage.VerifySignedURL(keys, r.Method, r.URL, time.Now())
+		if err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, ErrExpiredSignature) {
+				status = http.StatusGone
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if opts.Disposition != "" {
+			r = r.WithContext(context.WithValue(r.Context(), dispositionKey{}, opts.Disposition))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
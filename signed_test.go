@@ -0,0 +1,78 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+)
+
+func TestRequireSignedURL(t *testing.T) {
+	keys := []SigningKey{{ID: "k2", Secret: []byte("second")}, {ID: "k1", Secret: []byte("first")}}
+	s := New()
+	s.InitLocalStorage(LocalStorageOpts{RootFolder: t.TempDir(), BaseURL: "/files", SigningKeys: keys})
+	disk := s.LocalStorage
+	disk.Create("docs/report.pdf", []byte("%PDF-1.4 report"))
+
+	mux := http.NewServeMux()
+	mux.Handle("/files/", http.StripPrefix("/files", RequireSignedURL(keys, FileServer(disk, FileServerOpts{}))))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(target string) (*http.Response, string) {
+		resp, err := http.Get(srv.URL + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	signed, err := disk.(SignedURLDisk).SignedURL("docs/report.pdf", time.Minute, SignedURLOpts{})
+	if err != nil {
+		t.Fatal("failed asserting signed url. ", err)
+	}
+	resp, body := get(signed)
+	if resp.StatusCode != http.StatusOK || body != "%PDF-1.4 report" || resp.Header.Get("Content-Disposition") != "inline; filename=report.pdf" {
+		t.Errorf("failed asserting a signed download: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	signed, _ = disk.(SignedURLDisk).SignedURL("docs/report.pdf", time.Minute, SignedURLOpts{Disposition: "attachment"})
+	if resp, _ := get(signed); resp.Header.Get("Content-Disposition") != "attachment; filename=report.pdf" {
+		t.Errorf("failed asserting the bound disposition: %v", resp.Header)
+	}
+
+	if resp, _ := get("/files/docs/report.pdf"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("failed asserting an unsigned request: %d", resp.StatusCode)
+	}
+	if resp, _ := get(strings.Replace(signed, "report.pdf", "other.pdf", 1)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("failed asserting a request for another file: %d", resp.StatusCode)
+	}
+
+	// an old key still verifies after rotation
+	old := New()
+	old.InitLocalStorage(LocalStorageOpts{RootFolder: t.TempDir(), BaseURL: "/files", SigningKeys: keys[1:]})
+	old.LocalStorage.Create("docs/report.pdf", []byte("old"))
+	signed, _ = old.LocalStorage.(SignedURLDisk).SignedURL("docs/report.pdf", time.Minute, SignedURLOpts{})
+	if resp, _ := get(signed); resp.StatusCode != http.StatusOK {
+		t.Errorf("failed asserting a url signed with an older key: %d", resp.StatusCode)
+	}
+
+	signed, _ = disk.(SignedURLDisk).SignedURL("docs/report.pdf", time.Second, SignedURLOpts{Method: http.MethodGet})
+	u, _ := url.Parse(strings.TrimPrefix(signed, "/files"))
+	if _, err := localstorage.VerifySignedURL(keys, http.MethodGet, u, time.Now().Add(2*time.Second)); !errors.Is(err, ErrExpiredSignature) {
+		t.Errorf("failed asserting an expired url: %v", err)
+	}
+}
@@ -0,0 +1,649 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package storagetest provides a conformance test suite for the
+// implementations of stowage.Disk, it checks they behave like the
+// local storage, for example
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.RunConformance(t, func() stowage.Disk {
+//			return mydisk.New()
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+)
+
+// RunConformance runs the conformance suite as sub tests of t, newDisk
+// is called for every sub test and must return an empty disk
+func RunConformance(t *testing.T, newDisk func() stowage.Disk) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, d stowage.Disk)
+	}{
+		{"FileInfo", testFileInfo},
+		{"Put", testPut},
+		{"Copy", testCopy},
+		{"Move", testMove},
+		{"Rename", testRename},
+		{"Delete", testDelete},
+		{"DeleteMultiple", testDeleteMultiple},
+		{"Create", testCreate},
+		{"Append", testAppend},
+		{"ExistsAndMissing", testExistsAndMissing},
+		{"Read", testRead},
+		{"Streams", testStreams},
+		{"ReadRange", testReadRange},
+		{"Files", testFiles},
+		{"AllFiles", testAllFiles},
+		{"Directories", testDirectories},
+		{"AllDirectories", testAllDirectories},
+		{"MakeDirectory", testMakeDirectory},
+		{"RenameDirectory", testRenameDirectory},
+		{"DeleteDirectory", testDeleteDirectory},
+		{"EmptyDirectories", testEmptyDirectories},
+		{"UnicodeNames", testUnicodeNames},
+		{"OutsideRoot", testOutsideRoot},
+		{"PathErrors", testPathErrors},
+		{"Concurrency", testConcurrency},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newDisk())
+		})
+	}
+}
+
+// create creates the files with their content or fails the test
+func create(t *testing.T, d stowage.Disk, files map[string]string) {
+	t.Helper()
+	for file, content := range files {
+		if err := d.Create(file, []byte(content)); err != nil {
+			t.Fatalf("failed creating %s: %v", file, err)
+		}
+	}
+}
+
+// assertContent fails the test incase the file content doesn't match
+func assertContent(t *testing.T, d stowage.Disk, file string, want string) {
+	t.Helper()
+	content, err := d.Read(file)
+	if err != nil {
+		t.Errorf("failed reading %s: %v", file, err)
+		return
+	}
+	if string(content) != want {
+		t.Errorf("failed asserting the content of %s: got %q, want %q", file, content, want)
+	}
+}
+
+// assertExists fails the test incase the existence of the path doesn't match
+func assertExists(t *testing.T, d stowage.Disk, p string, want bool) {
+	t.Helper()
+	exists, err := d.Exists(p)
+	if err != nil {
+		t.Errorf("failed checking %s exists: %v", p, err)
+		return
+	}
+	if exists != want {
+		t.Errorf("failed asserting %s exists is %v", p, want)
+	}
+}
+
+// assertError fails the test incase the error doesn't match the target
+func assertError(t *testing.T, err error, target error, what string) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("failed asserting %s returns %v: got %v", what, target, err)
+	}
+}
+
+// relative returns the path relative to the root, the disks report
+// the paths either from the root or as full paths of the backend
+func relative(p string, rel string) bool {
+	return p == "/"+rel || strings.HasSuffix(p, "/"+rel)
+}
+
+func testFileInfo(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"a/b/file.test.md": "this is a test"})
+
+	info, err := d.FileInfo("a/b/file.test.md")
+	if err != nil {
+		t.Fatal("failed asserting file info: ", err)
+	}
+	if info.Name != "file.test.md" || info.Extension != "md" || info.NameWithoutExtension != "file.test" {
+		t.Errorf("failed asserting file info names: %+v", info)
+	}
+	if info.Size != 14 || info.IsDirectory || !relative(info.Path, "a/b") {
+		t.Errorf("failed asserting file info: %+v", info)
+	}
+	if info.FsFileInfo == nil || info.FsFileInfo.Name() != "file.test.md" || info.FsFileInfo.Size() != 14 {
+		t.Error("failed asserting file info: FsFileInfo")
+	}
+
+	info, err = d.FileInfo("a/b")
+	if err != nil || !info.IsDirectory || info.Name != "b" {
+		t.Errorf("failed asserting directory info: %+v %v", info, err)
+	}
+
+	_, err = d.FileInfo("missing.md")
+	assertError(t, err, stowage.ErrNotFound, "file info of a missing file")
+}
+
+func testPut(t *testing.T, d stowage.Disk) {
+	src := filepath.Join(t.TempDir(), "put.md")
+	if err := ioutil.WriteFile(src, []byte("put content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Put(src); err != nil {
+		t.Error("failed asserting put: ", err)
+	}
+	assertContent(t, d, "put.md", "put content")
+	assertError(t, d.Put(src), stowage.ErrAlreadyExists, "put of an existing file")
+
+	// missing parents are created
+	if err := d.PutAs(src, "missing/parents/renamed.md"); err != nil {
+		t.Error("failed asserting put as: ", err)
+	}
+	assertContent(t, d, "missing/parents/renamed.md", "put content")
+
+	assertError(t, d.Put(filepath.Join(t.TempDir(), "missing.md")), stowage.ErrNotFound, "put of a missing file")
+	assertError(t, d.PutAs(t.TempDir(), "dir.md"), stowage.ErrIsDirectory, "put of a directory")
+}
+
+func testCopy(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"src.md": "copy me", "dest/existing.md": "keep me"})
+
+	if err := d.Copy("src.md", "dest"); err != nil {
+		t.Error("failed asserting copy: ", err)
+	}
+	assertContent(t, d, "dest/src.md", "copy me")
+	assertContent(t, d, "src.md", "copy me")
+
+	if err := d.CopyAs("src.md", "missing/parents", "copied.md"); err != nil {
+		t.Error("failed asserting copy as into missing parents: ", err)
+	}
+	assertContent(t, d, "missing/parents/copied.md", "copy me")
+
+	// copies never overwrite
+	assertError(t, d.CopyAs("src.md", "dest", "existing.md"), stowage.ErrAlreadyExists, "copy over an existing file")
+	assertContent(t, d, "dest/existing.md", "keep me")
+
+	assertError(t, d.Copy("missing.md", "dest"), stowage.ErrNotFound, "copy of a missing file")
+	assertError(t, d.Copy("dest", "other"), stowage.ErrIsDirectory, "copy of a directory")
+}
+
+func testMove(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"src.md": "move me", "other.md": "move me too", "dest/existing.md": "keep me"})
+
+	if err := d.Move("src.md", "dest"); err != nil {
+		t.Error("failed asserting move: ", err)
+	}
+	assertContent(t, d, "dest/src.md", "move me")
+	assertExists(t, d, "src.md", false)
+
+	if err := d.MoveAs("dest/src.md", "missing/parents", "moved.md"); err != nil {
+		t.Error("failed asserting move as into missing parents: ", err)
+	}
+	assertContent(t, d, "missing/parents/moved.md", "move me")
+	assertExists(t, d, "dest/src.md", false)
+
+	// moves never overwrite
+	assertError(t, d.MoveAs("other.md", "dest", "existing.md"), stowage.ErrAlreadyExists, "move over an existing file")
+	assertContent(t, d, "dest/existing.md", "keep me")
+	assertContent(t, d, "other.md", "move me too")
+
+	assertError(t, d.Move("missing.md", "dest"), stowage.ErrNotFound, "move of a missing file")
+}
+
+func testRename(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/old.md": "rename me", "dir/existing.md": "replace me"})
+
+	if err := d.Rename("dir/old.md", "dir/new.md"); err != nil {
+		t.Error("failed asserting rename: ", err)
+	}
+	assertContent(t, d, "dir/new.md", "rename me")
+	assertExists(t, d, "dir/old.md", false)
+
+	// renames replace an existing file
+	if err := d.Rename("dir/new.md", "dir/existing.md"); err != nil {
+		t.Error("failed asserting rename over an existing file: ", err)
+	}
+	assertContent(t, d, "dir/existing.md", "rename me")
+
+	assertError(t, d.Rename("missing.md", "other.md"), stowage.ErrNotFound, "rename of a missing file")
+	assertError(t, d.Rename("dir", "other.md"), stowage.ErrIsDirectory, "rename of a directory")
+}
+
+func testDelete(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/file.md": "delete me"})
+
+	if err := d.Delete("dir/file.md"); err != nil {
+		t.Error("failed asserting delete: ", err)
+	}
+	assertExists(t, d, "dir/file.md", false)
+	assertError(t, d.Delete("dir/file.md"), stowage.ErrNotFound, "delete of a missing file")
+	assertError(t, d.Delete("dir"), stowage.ErrIsDirectory, "delete of a directory")
+	assertExists(t, d, "dir", true)
+}
+
+func testDeleteMultiple(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"one.md": "1", "two.md": "2", "dir/three.md": "3", "keep.md": "keep"})
+
+	// missing files and directories are skipped
+	if err := d.DeleteMultiple([]string{"one.md", "missing.md", "two.md", "dir/three.md", "dir"}); err != nil {
+		t.Error("failed asserting delete multiple: ", err)
+	}
+	assertExists(t, d, "one.md", false)
+	assertExists(t, d, "two.md", false)
+	assertExists(t, d, "dir/three.md", false)
+	assertExists(t, d, "dir", true)
+	assertExists(t, d, "keep.md", true)
+}
+
+func testCreate(t *testing.T, d stowage.Disk) {
+	if err := d.Create("missing/parents/file.md", []byte("created")); err != nil {
+		t.Error("failed asserting create: ", err)
+	}
+	assertContent(t, d, "missing/parents/file.md", "created")
+
+	// creating never overwrites
+	assertError(t, d.Create("missing/parents/file.md", []byte("again")), stowage.ErrAlreadyExists, "create of an existing file")
+	assertContent(t, d, "missing/parents/file.md", "created")
+	assertError(t, d.Create("missing/parents", []byte("dir")), stowage.ErrIsDirectory, "create over a directory")
+
+	if err := d.Create("empty.md", nil); err != nil {
+		t.Error("failed asserting create of an empty file: ", err)
+	}
+	assertContent(t, d, "empty.md", "")
+}
+
+func testAppend(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"file.md": "first\n"})
+
+	if err := d.Append("file.md", []byte("second\n")); err != nil {
+		t.Error("failed asserting append: ", err)
+	}
+	if err := d.Append("file.md", []byte("third\n")); err != nil {
+		t.Error("failed asserting append: ", err)
+	}
+	assertContent(t, d, "file.md", "first\nsecond\nthird\n")
+
+	assertError(t, d.Append("missing.md", []byte("x")), stowage.ErrNotFound, "append to a missing file")
+	create(t, d, map[string]string{"dir/file.md": ""})
+	assertError(t, d.Append("dir", []byte("x")), stowage.ErrIsDirectory, "append to a directory")
+}
+
+func testExistsAndMissing(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/file.md": "exists"})
+
+	assertExists(t, d, "dir/file.md", true)
+	assertExists(t, d, "dir", true)
+	assertExists(t, d, "dir/missing.md", false)
+
+	missing, err := d.Missing("dir/missing.md")
+	if err != nil || !missing {
+		t.Error("failed asserting missing: ", err)
+	}
+	missing, err = d.Missing("dir/file.md")
+	if err != nil || missing {
+		t.Error("failed asserting not missing: ", err)
+	}
+}
+
+func testRead(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/file.md": "read me"})
+
+	assertContent(t, d, "dir/file.md", "read me")
+	assertContent(t, d, "/dir/file.md", "read me")
+
+	_, err := d.Read("missing.md")
+	assertError(t, err, stowage.ErrNotFound, "read of a missing file")
+	_, err = d.Read("dir")
+	assertError(t, err, stowage.ErrIsDirectory, "read of a directory")
+}
+
+// testReadRange runs only for the disks implementing stowage.RangeDisk
+func testReadRange(t *testing.T, d stowage.Disk) {
+	rd, ok := d.(stowage.RangeDisk)
+	if !ok {
+		t.Skip("the disk doesn't read ranges")
+	}
+	create(t, d, map[string]string{"dir/file.md": "0123456789"})
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{6, -1, "6789"},
+		{8, 10, "89"},
+		{10, 2, ""},
+		{20, -1, ""},
+		{3, 0, ""},
+	}
+	for _, tt := range tests {
+		r, err := rd.ReadRange("dir/file.md", tt.offset, tt.length)
+		if err != nil {
+			t.Errorf("failed asserting read range %d %d: %v", tt.offset, tt.length, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != tt.want {
+			t.Errorf("failed asserting read range %d %d is %q: got %q %v", tt.offset, tt.length, tt.want, got, err)
+		}
+	}
+
+	_, err := rd.ReadRange("missing.md", 0, 1)
+	assertError(t, err, stowage.ErrNotFound, "read range of a missing file")
+	_, err = rd.ReadRange("dir", 0, 1)
+	assertError(t, err, stowage.ErrIsDirectory, "read range of a directory")
+}
+
+func testStreams(t *testing.T, d stowage.Disk) {
+	content := bytes.Repeat([]byte("streamed content\n"), 64*1024)
+
+	n, err := d.WriteStream("dir/stream.bin", bytes.NewReader(content))
+	if err != nil || n != int64(len(content)) {
+		t.Errorf("failed asserting write stream: %d %v", n, err)
+	}
+	_, err = d.WriteStream("dir/stream.bin", bytes.NewReader(content))
+	assertError(t, err, stowage.ErrAlreadyExists, "write stream over an existing file")
+
+	stream, err := d.ReadStream("dir/stream.bin")
+	if err != nil {
+		t.Fatal("failed asserting read stream: ", err)
+	}
+	streamed, err := ioutil.ReadAll(stream)
+	stream.Close()
+	if err != nil || !bytes.Equal(streamed, content) {
+		t.Error("failed asserting read stream content: ", err)
+	}
+
+	_, err = d.ReadStream("missing.md")
+	assertError(t, err, stowage.ErrNotFound, "read stream of a missing file")
+	_, err = d.ReadStream("dir")
+	assertError(t, err, stowage.ErrIsDirectory, "read stream of a directory")
+}
+
+func testFiles(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/b.md": "b", "dir/a.md": "a", "dir/sub/c.md": "c"})
+
+	files, err := d.Files("dir")
+	if err != nil {
+		t.Fatal("failed asserting files: ", err)
+	}
+	if names := fileNames(files); names != "a.md,b.md" {
+		t.Error("failed asserting files: ", names)
+	}
+
+	_, err = d.Files("missing")
+	assertError(t, err, stowage.ErrNotFound, "files of a missing directory")
+}
+
+func testAllFiles(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/b.md": "b", "dir/a/z.md": "z", "dir/a.md": "a", "dir/a/sub/y.md": "y"})
+
+	files, err := d.AllFiles("dir")
+	if err != nil {
+		t.Fatal("failed asserting all files: ", err)
+	}
+	// in the order of a file system walk
+	if names := fileNames(files); names != "y.md,z.md,a.md,b.md" {
+		t.Error("failed asserting all files order: ", names)
+	}
+	if len(files) == 4 && !relative(files[0].Path, "dir/a/sub") {
+		t.Error("failed asserting all files path: ", files[0].Path)
+	}
+
+	_, err = d.AllFiles("missing")
+	assertError(t, err, stowage.ErrNotFound, "all files of a missing directory")
+}
+
+func testDirectories(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/b/file.md": "b", "dir/a/sub/file.md": "a", "dir/file.md": "f"})
+
+	dirs, err := d.Directories("dir")
+	if err != nil {
+		t.Fatal("failed asserting directories: ", err)
+	}
+	if len(dirs) != 2 || !relative(dirs[0], "dir/a") || !relative(dirs[1], "dir/b") {
+		t.Error("failed asserting directories: ", dirs)
+	}
+
+	_, err = d.Directories("missing")
+	assertError(t, err, stowage.ErrNotFound, "directories of a missing directory")
+}
+
+func testAllDirectories(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/b/file.md": "b", "dir/a/sub/file.md": "a"})
+
+	dirs, err := d.AllDirectories("dir")
+	if err != nil {
+		t.Fatal("failed asserting all directories: ", err)
+	}
+	if len(dirs) != 3 || !relative(dirs[0], "dir/a") || !relative(dirs[1], "dir/a/sub") || !relative(dirs[2], "dir/b") {
+		t.Error("failed asserting all directories: ", dirs)
+	}
+
+	_, err = d.AllDirectories("missing")
+	assertError(t, err, stowage.ErrNotFound, "all directories of a missing directory")
+}
+
+func testMakeDirectory(t *testing.T, d stowage.Disk) {
+	if err := d.MakeDirectory("missing/parents/dir", 0755); err != nil {
+		t.Error("failed asserting make directory: ", err)
+	}
+	info, err := d.FileInfo("missing/parents/dir")
+	if err != nil || !info.IsDirectory {
+		t.Error("failed asserting make directory: ", err)
+	}
+	// making an existing directory succeeds
+	if err := d.MakeDirectory("missing/parents/dir", 0755); err != nil {
+		t.Error("failed asserting make existing directory: ", err)
+	}
+
+	create(t, d, map[string]string{"file.md": "file"})
+	if err := d.MakeDirectory("file.md/dir", 0755); err == nil {
+		t.Error("failed asserting make directory under a file")
+	}
+}
+
+func testRenameDirectory(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/file.md": "file", "dir/sub/nested.md": "nested"})
+
+	if err := d.RenameDirectory("dir", "renamed"); err != nil {
+		t.Fatal("failed asserting rename directory: ", err)
+	}
+	assertContent(t, d, "renamed/file.md", "file")
+	assertContent(t, d, "renamed/sub/nested.md", "nested")
+	assertExists(t, d, "dir", false)
+
+	if err := d.RenameDirectory("renamed", "renamed/sub/inner"); err == nil {
+		t.Error("failed asserting rename directory into itself")
+	}
+	if err := d.RenameDirectory("missing", "other"); err == nil {
+		t.Error("failed asserting rename of a missing directory")
+	}
+}
+
+func testDeleteDirectory(t *testing.T, d stowage.Disk) {
+	create(t, d, map[string]string{"dir/file.md": "file", "dir/sub/nested.md": "nested", "dirkeep/file.md": "keep"})
+
+	if err := d.DeleteDirectory("dir"); err != nil {
+		t.Error("failed asserting delete directory: ", err)
+	}
+	assertExists(t, d, "dir", false)
+	assertExists(t, d, "dir/sub/nested.md", false)
+	// directories sharing the prefix are kept
+	assertExists(t, d, "dirkeep/file.md", true)
+
+	if err := d.DeleteDirectory("missing"); err != nil {
+		t.Error("failed asserting delete of a missing directory: ", err)
+	}
+}
+
+func testEmptyDirectories(t *testing.T, d stowage.Disk) {
+	if err := d.MakeDirectory("parent/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, d, "parent/empty", true)
+
+	files, err := d.Files("parent/empty")
+	if err != nil || len(files) != 0 {
+		t.Error("failed asserting files of an empty directory: ", err)
+	}
+	dirs, err := d.Directories("parent")
+	if err != nil || len(dirs) != 1 || !relative(dirs[0], "parent/empty") {
+		t.Error("failed asserting an empty directory is listed: ", dirs, err)
+	}
+
+	// a directory stays when its last file is removed
+	create(t, d, map[string]string{"other/file.md": "file", "moved/keep.md": "keep"})
+	if err := d.Delete("other/file.md"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, d, "other", true)
+	create(t, d, map[string]string{"src/file.md": "file"})
+	if err := d.Move("src/file.md", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, d, "src", true)
+}
+
+func testUnicodeNames(t *testing.T, d stowage.Disk) {
+	name := "ünïcødé dir/文件 name ✓.md"
+	create(t, d, map[string]string{name: "unicode"})
+
+	assertContent(t, d, name, "unicode")
+	info, err := d.FileInfo(name)
+	if err != nil || info.Name != "文件 name ✓.md" || info.Extension != "md" {
+		t.Errorf("failed asserting unicode file info: %+v %v", info, err)
+	}
+	files, err := d.Files("ünïcødé dir")
+	if err != nil || fileNames(files) != "文件 name ✓.md" {
+		t.Error("failed asserting unicode listing: ", err)
+	}
+	if err := d.Rename(name, "ünïcødé dir/ñew.md"); err != nil {
+		t.Error("failed asserting unicode rename: ", err)
+	}
+	assertContent(t, d, "ünïcødé dir/ñew.md", "unicode")
+}
+
+func testOutsideRoot(t *testing.T, d stowage.Disk) {
+	paths := []string{"..", "../outside.md", "dir/../../outside.md"}
+	for _, p := range paths {
+		_, err := d.Read(p)
+		assertError(t, err, stowage.ErrOutsideRoot, fmt.Sprintf("read of %q", p))
+		assertError(t, d.Create(p, []byte("x")), stowage.ErrOutsideRoot, fmt.Sprintf("create of %q", p))
+		_, err = d.Exists(p)
+		assertError(t, err, stowage.ErrOutsideRoot, fmt.Sprintf("exists of %q", p))
+	}
+	// cleaned paths staying within the root are fine
+	create(t, d, map[string]string{"dir/../inside.md": "inside"})
+	assertContent(t, d, "inside.md", "inside")
+}
+
+func testPathErrors(t *testing.T, d stowage.Disk) {
+	_, err := d.Read("sub/missing.md")
+	var pathErr *stowage.PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("failed asserting the error is a *stowage.PathError: %T", err)
+	}
+	if pathErr.Op != "read" || pathErr.Path != "sub/missing.md" || pathErr.Disk == "" {
+		t.Errorf("failed asserting the path error fields: %+v", pathErr)
+	}
+	if !strings.Contains(err.Error(), "sub/missing.md") {
+		t.Error("failed asserting the error message names the path: ", err)
+	}
+}
+
+func testConcurrency(t *testing.T, d stowage.Disk) {
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*4)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file := fmt.Sprintf("concurrent/%d/file.md", i)
+			content := strings.Repeat(fmt.Sprint(i), 1024)
+			if err := d.Create(file, []byte(content)); err != nil {
+				errs <- err
+				return
+			}
+			if err := d.Append(file, []byte("!")); err != nil {
+				errs <- err
+			}
+			read, err := d.Read(file)
+			if err != nil {
+				errs <- err
+			} else if string(read) != content+"!" {
+				errs <- fmt.Errorf("unexpected content of %s", file)
+			}
+			if _, err := d.AllFiles("concurrent"); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error("failed asserting concurrent use: ", err)
+	}
+
+	files, err := d.AllFiles("concurrent")
+	if err != nil || len(files) != workers {
+		t.Error("failed asserting concurrent creates: ", len(files), err)
+	}
+
+	// only one of the concurrent creates of the same file wins
+	var created sync.WaitGroup
+	results := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		created.Add(1)
+		go func(i int) {
+			defer created.Done()
+			results <- d.Create("race.md", []byte(fmt.Sprint(i)))
+		}(i)
+	}
+	created.Wait()
+	close(results)
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, stowage.ErrAlreadyExists) {
+			t.Error("failed asserting concurrent create error: ", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Error("failed asserting exactly one concurrent create succeeds: ", succeeded)
+	}
+}
+
+// fileNames joins the names of the files in order
+func fileNames(files []localstorage.FileInfo) string {
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+
+	return strings.Join(names, ",")
+}
@@ -5,14 +5,66 @@
 package stowage
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+
 	"github.com/harranali/stowage/localstorage"
 )
 
 // LocalStorageOpts options for initiating local storage
 type LocalStorageOpts struct {
 	RootFolder string
+	// Name identifies the disk in the returned errors,
+	// it defaults to "local"
+	Name string
+	// SyncDirectory syncs the parent directory after every
+	// write so new files survive a crash of the system
+	SyncDirectory bool
+	// Checksums are computed with the given algorithms
+	// and filled in the listed FileInfo.Checksums
+	Checksums []ChecksumAlgorithm
+	// ContentTypes maps extensions without the dot to content types,
+	// they take precedence over the built-in table
+	ContentTypes map[string]string
+	// BaseURL is the url the files are served under,
+	// it's the base of the signed urls
+	BaseURL string
+	// SigningKeys sign the urls, the first key signs
+	// the new urls while all of them verify the urls
+	SigningKeys []SigningKey
+	// Versioning keeps the prior content of the overwritten, deleted,
+	// moved and renamed files, it's enabled by setting its directory
+	Versioning VersioningOpts
+	// Trash moves the deleted files and directories into the trash
+	// so they can be restored, it's enabled by setting its directory
+	Trash TrashOpts
 }
 
+// errors returned by the disks, use errors.Is to match them
+var (
+	ErrNotFound      = localstorage.ErrNotFound
+	ErrAlreadyExists = localstorage.ErrAlreadyExists
+	ErrNotRegular    = localstorage.ErrNotRegular
+	ErrIsDirectory   = localstorage.ErrIsDirectory
+	ErrOutsideRoot   = localstorage.ErrOutsideRoot
+
+	ErrChecksumMismatch     = localstorage.ErrChecksumMismatch
+	ErrUnsupportedAlgorithm = localstorage.ErrUnsupportedAlgorithm
+)
+
+// ChecksumMismatchError reports the expected and the actual checksums
+// of a file failing verification, it matches ErrChecksumMismatch
+type ChecksumMismatchError = localstorage.ChecksumMismatchError
+
+// PathError records an error and the operation, the disk
+// and the path that caused it, all disks wrap their errors in it
+type PathError = localstorage.PathError
+
 // Disk interface defines all supported operations by local storage
 type Disk interface {
 	FileInfo(filePath string) (fileinfo localstorage.FileInfo, err error)
@@ -30,6 +82,8 @@ type Disk interface {
 	Exists(filePath string) (bool, error)
 	Missing(filePath string) (bool, error)
 	Read(filePath string) ([]byte, error)
+	ReadStream(filePath string) (io.ReadCloser, error)
+	WriteStream(filePath string, r io.Reader) (int64, error)
 	Files(DirectoryPath string) ([]localstorage.FileInfo, error)
 	AllFiles(DirectoryPath string) ([]localstorage.FileInfo, error)
 	Directories(SubDirectoryPath string) (directoryPaths []string, err error)
@@ -39,21 +93,305 @@ type Disk interface {
 	DeleteDirectory(DirectoryPath string) (err error)
 }
 
-// Stowage represents all supported storages
+// DiskContext defines the context aware variants of the Disk operations,
+// each operation stops as soon as the given context is canceled or
+// its deadline is exceeded and returns ctx.Err()
+type DiskContext interface {
+	FileInfoCtx(ctx context.Context, filePath string) (fileinfo localstorage.FileInfo, err error)
+	PutCtx(ctx context.Context, filePath string) error
+	PutAsCtx(ctx context.Context, filePath string, filename string) error
+	CopyCtx(ctx context.Context, filePath string, destfolder string) error
+	CopyAsCtx(ctx context.Context, filePath string, destfolder string, newFilePath string) error
+	MoveCtx(ctx context.Context, filePath string, destfolder string) error
+	MoveAsCtx(ctx context.Context, filePath string, destFolder string, newFilePath string) error
+	RenameCtx(ctx context.Context, filePath string, newFilePath string) error
+	DeleteCtx(ctx context.Context, filePath string) error
+	DeleteMultipleCtx(ctx context.Context, filePaths []string) error
+	CreateCtx(ctx context.Context, filePath string, content []byte) error
+	AppendCtx(ctx context.Context, filePath string, content []byte) error
+	ExistsCtx(ctx context.Context, filePath string) (bool, error)
+	MissingCtx(ctx context.Context, filePath string) (bool, error)
+	ReadCtx(ctx context.Context, filePath string) ([]byte, error)
+	ReadStreamCtx(ctx context.Context, filePath string) (io.ReadCloser, error)
+	WriteStreamCtx(ctx context.Context, filePath string, r io.Reader) (int64, error)
+	FilesCtx(ctx context.Context, DirectoryPath string) ([]localstorage.FileInfo, error)
+	AllFilesCtx(ctx context.Context, DirectoryPath string) ([]localstorage.FileInfo, error)
+	DirectoriesCtx(ctx context.Context, SubDirectoryPath string) (directoryPaths []string, err error)
+	AllDirectoriesCtx(ctx context.Context, SubDirectoryPath string) (directoryPaths []string, err error)
+	MakeDirectoryCtx(ctx context.Context, DirectoryPath string, perm int) error
+	RenameDirectoryCtx(ctx context.Context, DirectoryPath string, NewDirectoryPath string) (err error)
+	DeleteDirectoryCtx(ctx context.Context, DirectoryPath string) (err error)
+}
+
+// ConflictPolicy decides what a write does when
+// the destination file already exists
+type ConflictPolicy = localstorage.ConflictPolicy
+
+// the conflict policies
+const (
+	Fail             = localstorage.Fail
+	Overwrite        = localstorage.Overwrite
+	Skip             = localstorage.Skip
+	RenameWithSuffix = localstorage.RenameWithSuffix
+	KeepNewer        = localstorage.KeepNewer
+)
+
+// Action is the action taken by a write
+type Action = localstorage.Action
+
+// the actions taken by the writes
+const (
+	Created     = localstorage.Created
+	Overwritten = localstorage.Overwritten
+	Skipped     = localstorage.Skipped
+	Renamed     = localstorage.Renamed
+)
+
+// WriteResult reports the outcome of a write with a conflict policy
+type WriteResult = localstorage.WriteResult
+
+// PolicyDisk defines the variants of the write operations applying
+// a conflict policy and reporting the action taken
+type PolicyDisk interface {
+	PutWith(filePath string, policy ConflictPolicy) (WriteResult, error)
+	PutAsWith(filePath string, filename string, policy ConflictPolicy) (WriteResult, error)
+	CopyWith(filePath string, destfolder string, policy ConflictPolicy) (WriteResult, error)
+	CopyAsWith(filePath string, destfolder string, newFilePath string, policy ConflictPolicy) (WriteResult, error)
+	MoveWith(filePath string, destFolder string, policy ConflictPolicy) (WriteResult, error)
+	MoveAsWith(filePath string, destFolder string, newFilePath string, policy ConflictPolicy) (WriteResult, error)
+	RenameWith(filePath string, newFilePath string, policy ConflictPolicy) (WriteResult, error)
+	CreateWith(filePath string, content []byte, policy ConflictPolicy) (WriteResult, error)
+	WriteStreamWith(filePath string, r io.Reader, policy ConflictPolicy) (WriteResult, error)
+}
+
+// SymlinkPolicy decides how the symlinks found in a directory tree are copied
+type SymlinkPolicy = localstorage.SymlinkPolicy
+
+// the symlink policies
+const (
+	SkipSymlinks     = localstorage.SkipSymlinks
+	FollowSymlinks   = localstorage.FollowSymlinks
+	PreserveSymlinks = localstorage.PreserveSymlinks
+)
+
+// DirectoryOpts options for copying and moving directories
+type DirectoryOpts = localstorage.DirectoryOpts
+
+// Progress reports the progress of a directory copy or move
+type Progress = localstorage.Progress
+
+// DirectoryResult reports the outcome of a directory copy or move
+type DirectoryResult = localstorage.DirectoryResult
+
+// DirectoryDisk defines the recursive directory operations
+type DirectoryDisk interface {
+	CopyDirectory(DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error)
+	CopyDirectoryCtx(ctx context.Context, DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error)
+	MoveDirectory(DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error)
+	MoveDirectoryCtx(ctx context.Context, DirectoryPath string, destPath string, opts DirectoryOpts) (DirectoryResult, error)
+}
+
+// ChecksumAlgorithm names a supported checksum algorithm
+type ChecksumAlgorithm = localstorage.ChecksumAlgorithm
+
+// the supported checksum algorithms
+const (
+	MD5    = localstorage.MD5
+	SHA1   = localstorage.SHA1
+	SHA256 = localstorage.SHA256
+	CRC32C = localstorage.CRC32C
+)
+
+// Checksum is a hex encoded checksum computed with the given algorithm
+type Checksum = localstorage.Checksum
+
+// ChecksumDisk defines the checksum operations
+type ChecksumDisk interface {
+	Checksum(filePath string, algo ChecksumAlgorithm) (string, error)
+	ChecksumCtx(ctx context.Context, filePath string, algo ChecksumAlgorithm) (string, error)
+	Verify(filePath string, expected Checksum) error
+	VerifyCtx(ctx context.Context, filePath string, expected Checksum) error
+}
+
+// RangeDisk defines the reads of a part of a file without reading
+// what comes before it, a negative length reads up to the end of
+// the file, a range past the end of the file is cut at the end,
+// the files of AsFS seek with it when their streams can't
+type RangeDisk interface {
+	ReadRange(filePath string, offset int64, length int64) (io.ReadCloser, error)
+}
+
+// FilterByContentType returns the files whose content type matches any
+// of the patterns, a pattern is a media type like "image/png" or
+// a family like "image/*", use it with Files and AllFiles
+func FilterByContentType(files []localstorage.FileInfo, patterns ...string) []localstorage.FileInfo {
+	return localstorage.FilterByContentType(files, patterns...)
+}
+
+// make sure the local storage supports all operations
+var (
+	_ Disk          = (*localstorage.LocalStorage)(nil)
+	_ DiskContext   = (*localstorage.LocalStorage)(nil)
+	_ PolicyDisk    = (*localstorage.LocalStorage)(nil)
+	_ DirectoryDisk = (*localstorage.LocalStorage)(nil)
+	_ ChecksumDisk  = (*localstorage.LocalStorage)(nil)
+	_ RangeDisk     = (*localstorage.LocalStorage)(nil)
+)
+
+// errors returned by the disk manager
+var (
+	ErrDiskNotFound = errors.New("disk is not registered")
+	ErrDiskExists   = errors.New("disk is already registered")
+	ErrNoDefault    = errors.New("no default disk is set")
+)
+
+// Stowage represents all supported storages,
+// it holds the registered disks by their names
 type Stowage struct {
 	LocalStorage Disk
-}
 
-var stowage *Stowage
+	mu          sync.RWMutex
+	disks       map[string]Disk
+	defaultDisk string
+}
 
 // New initialize stowage
 func New() *Stowage {
-	stowage = &Stowage{}
-
-	return stowage
+	return &Stowage{
+		disks: map[string]Disk{},
+	}
 }
 
-// InitLocalStorage initializes local storage
+// InitLocalStorage initializes local storage, the disk is registered
+// under the name given in the options or "local" by default
+// replacing any disk registered with the same name,
+// it becomes the default disk if no default is set
 func (s *Stowage) InitLocalStorage(opts LocalStorageOpts) {
-	s.LocalStorage = localstorage.New(opts.RootFolder)
+	disk := localstorage.NewWithOpts(opts.RootFolder, localstorage.Opts{
+		Name:          opts.Name,
+		SyncDirectory: opts.SyncDirectory,
+		Checksums:     opts.Checksums,
+		ContentTypes:  opts.ContentTypes,
+		BaseURL:       opts.BaseURL,
+		SigningKeys:   opts.SigningKeys,
+		Versioning:    opts.Versioning,
+		Trash:         opts.Trash,
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LocalStorage = disk
+	s.setDisk(disk.Name(), disk)
+}
+
+// AddDisk registers the given disk under the given name,
+// the first registered disk becomes the default disk,
+// it returns an error incase the name is already registered
+func (s *Stowage) AddDisk(name string, disk Disk) error {
+	if name == "" || disk == nil {
+		return errors.New("disk name and disk are required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.disks[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDiskExists, name)
+	}
+	s.setDisk(name, disk)
+
+	return nil
+}
+
+// Disk returns the disk registered under the given name,
+// it returns an error incase there is no such disk
+func (s *Stowage) Disk(name string) (Disk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	disk, ok := s.disks[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDiskNotFound, name)
+	}
+
+	return disk, nil
+}
+
+// Default returns the default disk,
+// it returns an error incase no default disk is set
+func (s *Stowage) Default() (Disk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.defaultDisk == "" {
+		return nil, ErrNoDefault
+	}
+
+	return s.disks[s.defaultDisk], nil
+}
+
+// SetDefault makes the disk registered under the given
+// name the default disk, it returns an error incase
+// there is no such disk
+func (s *Stowage) SetDefault(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.disks[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrDiskNotFound, name)
+	}
+	s.defaultDisk = name
+
+	return nil
+}
+
+// Disks returns the names of the registered disks sorted
+func (s *Stowage) Disks() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.disks))
+	for name := range s.disks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// RemoveDisk unregisters the disk registered under the given name,
+// if it was the default disk no default is set afterwards,
+// it returns an error incase there is no such disk
+func (s *Stowage) RemoveDisk(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	disk, ok := s.disks[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDiskNotFound, name)
+	}
+	delete(s.disks, name)
+	if s.defaultDisk == name {
+		s.defaultDisk = ""
+	}
+	if sameDisk(s.LocalStorage, disk) {
+		s.LocalStorage = nil
+	}
+
+	return nil
+}
+
+// sameDisk reports whether both disks are the same value, comparing
+// disks of the same uncomparable type with == panics so they never are
+func sameDisk(a Disk, b Disk) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return reflect.TypeOf(a).Comparable() && a == b
+}
+
+// setDisk registers the disk, the caller must hold the lock
+func (s *Stowage) setDisk(name string, disk Disk) {
+	if s.disks == nil {
+		s.disks = map[string]Disk{}
+	}
+	s.disks[name] = disk
+	if s.defaultDisk == "" {
+		s.defaultDisk = name
+	}
 }
@@ -1,11 +1,14 @@
 package stowage_test
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"testing"
 
 	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
 )
 
 func TestNew(t *testing.T) {
@@ -30,3 +33,131 @@ func TestInitLocalStorage(t *testing.T) {
 		t.Error("failed assert reading file name")
 	}
 }
+
+func TestErrors(t *testing.T) {
+	s := New()
+	root, _ := filepath.Abs("./localstorage/testdata/root")
+	s.InitLocalStorage(LocalStorageOpts{
+		RootFolder: root,
+		Name:       "testdata",
+	})
+
+	_, err := s.LocalStorage.Read("missingfile.md")
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("failed assert not found error: ", err)
+	}
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) || pathErr.Disk != "testdata" {
+		t.Error("failed assert path error: ", err)
+	}
+}
+
+func TestDisks(t *testing.T) {
+	s := New()
+	uploads := localstorage.New(t.TempDir())
+	cache := localstorage.New(t.TempDir())
+
+	// the first registered disk becomes the default
+	if err := s.AddDisk("uploads", uploads); err != nil {
+		t.Error("failed assert adding disk: ", err)
+	}
+	if err := s.AddDisk("cache", cache); err != nil {
+		t.Error("failed assert adding disk: ", err)
+	}
+	if err := s.AddDisk("cache", cache); !errors.Is(err, ErrDiskExists) {
+		t.Error("failed assert adding duplicate disk: ", err)
+	}
+
+	d, err := s.Default()
+	if err != nil || d != uploads {
+		t.Error("failed assert default disk: ", err)
+	}
+	d, err = s.Disk("cache")
+	if err != nil || d != cache {
+		t.Error("failed assert getting disk: ", err)
+	}
+	_, err = s.Disk("exports")
+	if !errors.Is(err, ErrDiskNotFound) {
+		t.Error("failed assert getting missing disk: ", err)
+	}
+
+	// change the default
+	if err := s.SetDefault("cache"); err != nil {
+		t.Error("failed assert setting default disk: ", err)
+	}
+	d, _ = s.Default()
+	if d != cache {
+		t.Error("failed assert changed default disk")
+	}
+	if err := s.SetDefault("exports"); !errors.Is(err, ErrDiskNotFound) {
+		t.Error("failed assert setting missing default disk: ", err)
+	}
+
+	// list the disks
+	names := s.Disks()
+	if len(names) != 2 || names[0] != "cache" || names[1] != "uploads" {
+		t.Error("failed assert listing disks: ", names)
+	}
+
+	// remove the default disk
+	if err := s.RemoveDisk("cache"); err != nil {
+		t.Error("failed assert removing disk: ", err)
+	}
+	if _, err := s.Default(); !errors.Is(err, ErrNoDefault) {
+		t.Error("failed assert default disk after removal: ", err)
+	}
+	if err := s.RemoveDisk("cache"); !errors.Is(err, ErrDiskNotFound) {
+		t.Error("failed assert removing missing disk: ", err)
+	}
+}
+
+func TestInitLocalStorageRegistersDisk(t *testing.T) {
+	s := New()
+	s.InitLocalStorage(LocalStorageOpts{RootFolder: t.TempDir()})
+	s.InitLocalStorage(LocalStorageOpts{RootFolder: t.TempDir(), Name: "exports"})
+
+	local, err := s.Disk("local")
+	if err != nil {
+		t.Error("failed assert local disk registered: ", err)
+	}
+	d, _ := s.Default()
+	if d != local {
+		t.Error("failed assert local disk is the default")
+	}
+	exports, err := s.Disk("exports")
+	if err != nil || s.LocalStorage != exports {
+		t.Error("failed assert named local disk registered: ", err)
+	}
+}
+
+func TestInstancesAreIndependent(t *testing.T) {
+	s1 := New()
+	s2 := New()
+	s1.AddDisk("uploads", localstorage.New(t.TempDir()))
+
+	if _, err := s2.Disk("uploads"); err == nil {
+		t.Error("failed assert stowage instances are independent")
+	}
+}
+
+// listedDisk is a disk of an uncomparable type
+type listedDisk struct {
+	Disk
+	tags []string
+}
+
+func TestRemoveUncomparableDisk(t *testing.T) {
+	s := New()
+	s.InitLocalStorage(LocalStorageOpts{RootFolder: t.TempDir()})
+	s.AddDisk("a", listedDisk{Disk: memstorage.New(), tags: []string{"a"}})
+	local := s.LocalStorage
+	s.LocalStorage = listedDisk{Disk: memstorage.New()}
+
+	if err := s.RemoveDisk("a"); err != nil {
+		t.Error("failed assert removing an uncomparable disk: ", err)
+	}
+	s.LocalStorage = local
+	if err := s.RemoveDisk("local"); err != nil || s.LocalStorage != nil {
+		t.Error("failed assert removing the local storage: ", err)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncCompare decides how a file present on both disks is found changed
+type SyncCompare int
+
+const (
+	// CompareSizeAndTime finds the file changed when the sizes differ
+	// or the source was modified after the destination by more than
+	// the ModifyWindow
+	CompareSizeAndTime SyncCompare = iota
+	// CompareChecksum finds the file changed when the checksums of
+	// the contents differ, both files are read entirely
+	CompareChecksum
+)
+
+// SyncOpts options for syncing two disks
+type SyncOpts struct {
+	// Dir is the directory mirrored on both disks, it defaults to the root
+	Dir string
+	// Compare defaults to CompareSizeAndTime
+	Compare SyncCompare
+	// ModifyWindow is the difference of modification times within which
+	// CompareSizeAndTime finds the files unchanged, the copies take the
+	// time they're written and disks like SFTP and S3 keep whole seconds,
+	// it defaults to a second, a negative window compares the exact times
+	ModifyWindow time.Duration
+	// DeleteExtraneous deletes the destination files and directories
+	// missing in the source, excluded entries are kept
+	DeleteExtraneous bool
+	// Include limits the synced files to the ones matching any of the
+	// patterns, a pattern is matched with path.Match against the path
+	// within Dir, patterns without a slash are matched against the name
+	Include []string
+	// Exclude leaves out the files and directories matching any of
+	// the patterns, it takes precedence over Include
+	Exclude []string
+	// DryRun reports what would be done without changing anything
+	DryRun bool
+	// Hash creates the hash used for the checksums,
+	// it defaults to sha256.New
+	Hash func() hash.Hash
+}
+
+// SyncReport reports the files of a sync by their paths within Dir, sorted
+type SyncReport struct {
+	Created []string
+	Updated []string
+	Deleted []string
+	// Skipped are the unchanged files
+	Skipped []string
+	// Bytes is the number of bytes transferred
+	Bytes int64
+}
+
+// Sync mirrors the source disk into the destination disk, missing files
+// are created, changed files are updated and, if asked, extraneous ones
+// are deleted, the files are transferred and verified with Transfer,
+// it returns the report of the files synced before any error occurred
+// and the error incase there is any
+func Sync(ctx context.Context, src Disk, dst Disk, opts SyncOpts) (SyncReport, error) {
+	if opts.Hash == nil {
+		opts.Hash = sha256.New
+	}
+	if opts.ModifyWindow == 0 {
+		opts.ModifyWindow = time.Second
+	} else if opts.ModifyWindow < 0 {
+		opts.ModifyWindow = 0
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return SyncReport{}, err
+		}
+	}
+	dir := cleanPath(opts.Dir)
+	if dir == "" {
+		dir = "."
+	}
+
+	srcTree, err := scanTree(ctx, src, dir, opts)
+	if err != nil {
+		return SyncReport{}, err
+	}
+	dstTree, err := scanTree(ctx, dst, dir, opts)
+	if errors.Is(err, fs.ErrNotExist) {
+		dstTree, err = &syncTree{files: map[string]fs.FileInfo{}, dirs: map[string]bool{}, kept: map[string]bool{}}, nil
+	}
+	if err != nil {
+		return SyncReport{}, err
+	}
+
+	report := SyncReport{}
+	if opts.DeleteExtraneous {
+		if err := deleteExtraneous(ctx, dst, dir, srcTree, dstTree, opts.DryRun, &report); err != nil {
+			return report, err
+		}
+	}
+
+	for _, rel := range srcTree.sortedFiles() {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		srcInfo := srcTree.files[rel]
+		dstInfo, exists := dstTree.files[rel]
+		if exists {
+			changed, err := fileChanged(ctx, src, dst, path.Join(dir, rel), srcInfo, dstInfo, opts)
+			if err != nil {
+				return report, err
+			}
+			if !changed {
+				report.Skipped = append(report.Skipped, rel)
+				continue
+			}
+		}
+
+		if !opts.DryRun {
+			filePath := path.Join(dir, rel)
+			result, err := Transfer(ctx, src, filePath, dst, filePath, TransferOpts{Overwrite: exists, Hash: opts.Hash})
+			if err != nil {
+				return report, err
+			}
+			report.Bytes += result.Size
+		} else {
+			report.Bytes += srcInfo.Size()
+		}
+		if exists {
+			report.Updated = append(report.Updated, rel)
+		} else {
+			report.Created = append(report.Created, rel)
+		}
+	}
+
+	return report, nil
+}
+
+// syncTree holds the files and directories of a disk by their paths
+// within the synced directory, kept are the directories holding
+// entries left out by the filters
+type syncTree struct {
+	files map[string]fs.FileInfo
+	dirs  map[string]bool
+	kept  map[string]bool
+}
+
+// sortedFiles returns the paths of the files sorted
+func (t *syncTree) sortedFiles() []string {
+	files := make([]string, 0, len(t.files))
+	for rel := range t.files {
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// scanTree walks the directory of the disk applying the filters
+func scanTree(ctx context.Context, disk Disk, dir string, opts SyncOpts) (*syncTree, error) {
+	fsys, err := fs.Sub(AsFS(disk), dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &syncTree{files: map[string]fs.FileInfo{}, dirs: map[string]bool{}, kept: map[string]bool{}}
+	err = fs.WalkDir(fsys, ".", func(rel string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		if matchAny(opts.Exclude, rel) || (!entry.IsDir() && len(opts.Include) > 0 && !matchAny(opts.Include, rel)) {
+			t.keep(rel)
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			t.dirs[rel] = true
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		t.files[rel] = info
+
+		return nil
+	})
+
+	return t, err
+}
+
+// keep marks the directories holding the entry as kept
+func (t *syncTree) keep(rel string) {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		t.kept[dir] = true
+	}
+}
+
+// matchAny reports whether the path matches any of the patterns
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileChanged compares the source and the destination files
+func fileChanged(ctx context.Context, src Disk, dst Disk, filePath string, srcInfo fs.FileInfo, dstInfo fs.FileInfo, opts SyncOpts) (bool, error) {
+	if srcInfo.Size() != dstInfo.Size() {
+		return true, nil
+	}
+	if opts.Compare != CompareChecksum {
+		return srcInfo.ModTime().After(dstInfo.ModTime().Add(opts.ModifyWindow)), nil
+	}
+
+	srcSum, err := checksum(ctx, src, filePath, opts.Hash)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := checksum(ctx, dst, filePath, opts.Hash)
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(srcSum, dstSum), nil
+}
+
+// deleteExtraneous deletes the destination entries missing in the source,
+// a directory holding excluded entries is kept and only its extraneous
+// files are deleted, other extraneous directories are deleted at once
+func deleteExtraneous(ctx context.Context, dst Disk, dir string, srcTree *syncTree, dstTree *syncTree, dryRun bool, report *SyncReport) error {
+	// the topmost directories that can be deleted at once
+	removable := func(rel string) bool {
+		return !srcTree.dirs[rel] && !dstTree.kept[rel]
+	}
+	deletedDirs := []string{}
+	for rel := range dstTree.dirs {
+		parent := path.Dir(rel)
+		if removable(rel) && (parent == "." || !removable(parent)) {
+			deletedDirs = append(deletedDirs, rel)
+		}
+	}
+	sort.Strings(deletedDirs)
+	withinDeleted := func(rel string) bool {
+		for _, d := range deletedDirs {
+			if strings.HasPrefix(rel, d+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, rel := range dstTree.sortedFiles() {
+		if _, ok := srcTree.files[rel]; ok {
+			continue
+		}
+		if !dryRun && !withinDeleted(rel) {
+			if err := deleteFile(ctx, dst, path.Join(dir, rel)); err != nil {
+				return err
+			}
+		}
+		report.Deleted = append(report.Deleted, rel)
+		delete(dstTree.files, rel)
+	}
+	if dryRun {
+		return nil
+	}
+	for _, rel := range deletedDirs {
+		var err error
+		if ctxDisk, ok := dst.(DiskContext); ok {
+			err = ctxDisk.DeleteDirectoryCtx(ctx, path.Join(dir, rel))
+		} else {
+			err = dst.DeleteDirectory(path.Join(dir, rel))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
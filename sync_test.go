@@ -0,0 +1,151 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+func TestSync(t *testing.T) {
+	src := memstorage.New()
+	src.Create("a.txt", []byte("aaa"))
+	src.Create("docs/b.md", []byte("bb"))
+	src.Create("docs/deep/c.md", []byte("c"))
+	src.Create("tmp/cache.bin", []byte("cache"))
+	src.Create("logs/app.log", []byte("log"))
+	dst := localstorage.New(t.TempDir())
+
+	report, err := Sync(context.Background(), src, dst, SyncOpts{})
+	if err != nil {
+		t.Fatal("failed asserting sync. ", err)
+	}
+	created := []string{"a.txt", "docs/b.md", "docs/deep/c.md", "logs/app.log", "tmp/cache.bin"}
+	if !reflect.DeepEqual(report.Created, created) || report.Bytes != 14 {
+		t.Errorf("failed asserting the created files: %+v", report)
+	}
+
+	// a second sync finds nothing changed
+	report, err = Sync(context.Background(), src, dst, SyncOpts{})
+	if err != nil || len(report.Skipped) != 5 || len(report.Created)+len(report.Updated) != 0 {
+		t.Errorf("failed asserting an unchanged sync: %+v %v", report, err)
+	}
+
+	src.Rename("a.txt", "a.txt.old")
+	src.Create("a.txt", []byte("changed"))
+	report, err = Sync(context.Background(), src, dst, SyncOpts{})
+	if err != nil || !reflect.DeepEqual(report.Updated, []string{"a.txt"}) || !reflect.DeepEqual(report.Created, []string{"a.txt.old"}) {
+		t.Errorf("failed asserting the updated files: %+v %v", report, err)
+	}
+	if content, _ := dst.Read("a.txt"); string(content) != "changed" {
+		t.Error("failed asserting the updated content")
+	}
+}
+
+func TestSyncChecksum(t *testing.T) {
+	src := memstorage.New()
+	src.Create("docs/b.md", []byte("bb"))
+	root := t.TempDir()
+	dst := localstorage.New(root)
+	Sync(context.Background(), src, dst, SyncOpts{})
+
+	// same size and a newer time, only the checksum finds the change
+	dst.Delete("docs/b.md")
+	dst.Create("docs/b.md", []byte("xx"))
+	newer := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "docs/b.md"), newer, newer)
+	report, _ := Sync(context.Background(), src, dst, SyncOpts{})
+	if len(report.Updated) != 0 {
+		t.Errorf("failed asserting size and time compare: %+v", report)
+	}
+	report, err := Sync(context.Background(), src, dst, SyncOpts{Compare: CompareChecksum})
+	if err != nil || !reflect.DeepEqual(report.Updated, []string{"docs/b.md"}) {
+		t.Errorf("failed asserting checksum compare: %+v %v", report, err)
+	}
+}
+
+func TestSyncFilters(t *testing.T) {
+	src := memstorage.New()
+	src.Create("a.txt", []byte("aaa"))
+	src.Create("docs/b.md", []byte("bb"))
+	src.Create("docs/deep/c.md", []byte("c"))
+	src.Create("tmp/cache.bin", []byte("cache"))
+	src.Create("logs/app.log", []byte("log"))
+	dst := memstorage.New()
+
+	report, err := Sync(context.Background(), src, dst, SyncOpts{Include: []string{"*.md", "*.txt"}, Exclude: []string{"deep"}})
+	if err != nil || !reflect.DeepEqual(report.Created, []string{"a.txt", "docs/b.md"}) {
+		t.Errorf("failed asserting the filters: %+v %v", report, err)
+	}
+
+	report, err = Sync(context.Background(), src, memstorage.New(), SyncOpts{Dir: "docs", Exclude: []string{"deep/*"}})
+	if err != nil || !reflect.DeepEqual(report.Created, []string{"b.md"}) {
+		t.Errorf("failed asserting the directory: %+v %v", report, err)
+	}
+
+	if _, err := Sync(context.Background(), src, dst, SyncOpts{Include: []string{"["}}); err == nil {
+		t.Error("failed asserting a bad pattern")
+	}
+}
+
+func TestSyncDeleteExtraneous(t *testing.T) {
+	src := memstorage.New()
+	src.Create("a.txt", []byte("aaa"))
+	src.Create("docs/b.md", []byte("bb"))
+	src.Create("docs/deep/c.md", []byte("c"))
+	src.Create("tmp/cache.bin", []byte("cache"))
+	src.Create("logs/app.log", []byte("log"))
+	dst := memstorage.New()
+	Sync(context.Background(), src, dst, SyncOpts{})
+	dst.Create("old.txt", []byte("old"))
+	dst.Create("stale/x.txt", []byte("x"))
+	dst.Create("stale/keep.lock", []byte("lock"))
+	dst.Create("gone/y.txt", []byte("y"))
+
+	report, err := Sync(context.Background(), src, dst, SyncOpts{DeleteExtraneous: true, Exclude: []string{"*.lock"}, DryRun: true})
+	deleted := []string{"gone/y.txt", "old.txt", "stale/x.txt"}
+	if err != nil || !reflect.DeepEqual(report.Deleted, deleted) {
+		t.Errorf("failed asserting dry run deletes: %+v %v", report, err)
+	}
+	if ok, _ := dst.Exists("old.txt"); !ok {
+		t.Error("failed asserting the dry run changes nothing")
+	}
+
+	report, err = Sync(context.Background(), src, dst, SyncOpts{DeleteExtraneous: true, Exclude: []string{"*.lock"}})
+	if err != nil || !reflect.DeepEqual(report.Deleted, deleted) {
+		t.Errorf("failed asserting deletes: %+v %v", report, err)
+	}
+	for file, exists := range map[string]bool{"old.txt": false, "stale/x.txt": false, "stale/keep.lock": true, "a.txt": true} {
+		if ok, _ := dst.Exists(file); ok != exists {
+			t.Errorf("failed asserting %s exists is %v", file, exists)
+		}
+	}
+	if ok, _ := dst.Exists("gone"); ok {
+		t.Error("failed asserting the extraneous directory is deleted")
+	}
+}
+
+func TestSyncErrors(t *testing.T) {
+	if _, err := Sync(context.Background(), memstorage.New(), memstorage.New(), SyncOpts{Dir: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting sync of a missing directory. ", err)
+	}
+
+	src := memstorage.New()
+	src.Create("a.txt", []byte("aaa"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Sync(ctx, src, memstorage.New(), SyncOpts{}); !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting canceled sync. ", err)
+	}
+}
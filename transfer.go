@@ -0,0 +1,239 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/harranali/stowage/internal/ctxio"
+	"github.com/harranali/stowage/internal/replace"
+	"github.com/harranali/stowage/localstorage"
+)
+
+// ErrSameFile is returned by the transfers onto their source file
+var ErrSameFile = errors.New("source and destination are the same file")
+
+// TransferOpts options for transferring a file between disks
+type TransferOpts struct {
+	// Overwrite replaces the destination file if it exists, it's
+	// kept until the new content is completely written,
+	// otherwise the transfer fails with ErrAlreadyExists
+	Overwrite bool
+	// DeleteSource deletes the source file once the
+	// destination is written and verified
+	DeleteSource bool
+	// SkipVerify skips reading the destination back to
+	// compare its checksum with the source checksum
+	SkipVerify bool
+	// Hash creates the hash used for the checksums,
+	// it defaults to sha256.New
+	Hash func() hash.Hash
+}
+
+// TransferResult reports the outcome of a transfer
+type TransferResult struct {
+	// Size is the number of bytes transferred
+	Size int64
+	// Checksum is the hex encoded checksum of the content
+	Checksum string
+	// Verified reports whether the destination was read back and matched
+	Verified bool
+	// SourceDeleted reports whether the source file was deleted
+	SourceDeleted bool
+}
+
+// Transfer streams the source file of the source disk into the destination
+// path of the destination disk, the disks can be any pair of Disk
+// implementations including the same disk, the content is hashed while
+// it's copied and the destination is read back to verify it, a destination
+// that doesn't match is deleted and ErrChecksumMismatch is returned,
+// the context aware operations are used when the disks support them,
+// it returns the outcome and an error incase there is any
+func Transfer(ctx context.Context, srcDisk Disk, srcPath string, dstDisk Disk, dstPath string, opts TransferOpts) (TransferResult, error) {
+	if opts.Hash == nil {
+		opts.Hash = sha256.New
+	}
+	if err := ctx.Err(); err != nil {
+		return TransferResult{}, err
+	}
+	if sameFile(ctx, srcDisk, srcPath, dstDisk, dstPath) {
+		return TransferResult{}, transferError(dstDisk, dstPath, ErrSameFile)
+	}
+
+	src, err := readStream(ctx, srcDisk, srcPath)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	defer src.Close()
+
+	h := opts.Hash()
+	r := io.TeeReader(ctxio.NewReader(ctx, src), h)
+	var written int64
+	if policyDisk, ok := dstDisk.(policyStreamWriter); ok && opts.Overwrite {
+		var result WriteResult
+		result, err = policyDisk.WriteStreamWithCtx(ctx, dstPath, r, Overwrite)
+		written = result.Size
+	} else if opts.Overwrite {
+		// the other disks keep the destination until the content is complete
+		written, err = replace.Write(dstDisk, dstPath, r)
+	} else {
+		written, err = writeStream(ctx, dstDisk, dstPath, r)
+	}
+	if err != nil {
+		return TransferResult{Size: written}, err
+	}
+	// closing the source early lets it be deleted on every platform
+	src.Close()
+
+	sum := h.Sum(nil)
+	result := TransferResult{Size: written, Checksum: hex.EncodeToString(sum)}
+	if !opts.SkipVerify {
+		if err := verify(ctx, dstDisk, dstPath, sum, opts.Hash); err != nil {
+			if errors.Is(err, ErrChecksumMismatch) {
+				deleteFile(context.Background(), dstDisk, dstPath)
+			}
+			return result, err
+		}
+		result.Verified = true
+	}
+
+	if opts.DeleteSource {
+		if err := deleteFile(ctx, srcDisk, srcPath); err != nil {
+			return result, err
+		}
+		result.SourceDeleted = true
+	}
+
+	return result, nil
+}
+
+// policyStreamWriter is implemented by the disks writing
+// streams with a conflict policy
+type policyStreamWriter interface {
+	WriteStreamWithCtx(ctx context.Context, filePath string, r io.Reader, policy ConflictPolicy) (WriteResult, error)
+}
+
+// verify reads the file back and compares its checksum with the given sum
+func verify(ctx context.Context, disk Disk, filePath string, sum []byte, newHash func() hash.Hash) error {
+	got, err := checksum(ctx, disk, filePath, newHash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, sum) {
+		return transferError(disk, filePath, ErrChecksumMismatch)
+	}
+
+	return nil
+}
+
+// checksum reads the file and returns the checksum of its content
+func checksum(ctx context.Context, disk Disk, filePath string, newHash func() hash.Hash) ([]byte, error) {
+	r, err := readStream(ctx, disk, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, r)); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// sameFile reports whether both paths refer to the same file, either the
+// same path of the same disk or the same file of the operating system
+// reached through two disks, like two local disks over the same root
+// or a decorator and the local disk it wraps
+func sameFile(ctx context.Context, srcDisk Disk, srcPath string, dstDisk Disk, dstPath string) bool {
+	if sameDisk(srcDisk, dstDisk) && cleanPath(srcPath) == cleanPath(dstPath) {
+		return true
+	}
+
+	srcInfo, err := statFile(ctx, srcDisk, srcPath)
+	if err != nil || srcInfo.FsFileInfo == nil {
+		return false
+	}
+	dstInfo, err := statFile(ctx, dstDisk, dstPath)
+	if err != nil || dstInfo.FsFileInfo == nil {
+		return false
+	}
+
+	return os.SameFile(osFileInfo(srcInfo.FsFileInfo), osFileInfo(dstInfo.FsFileInfo))
+}
+
+// osFileInfo returns the file info of the operating system
+// the decorators wrap in their own file info
+func osFileInfo(info fs.FileInfo) fs.FileInfo {
+	for {
+		wrapper, ok := info.(interface{ Unwrap() fs.FileInfo })
+		if !ok {
+			return info
+		}
+		info = wrapper.Unwrap()
+	}
+}
+
+// cleanPath cleans the path of a file within a disk
+func cleanPath(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filePath), "/")
+}
+
+// transferError wraps the error into a *PathError naming the disk if it can
+func transferError(disk Disk, filePath string, err error) error {
+	name := ""
+	if named, ok := disk.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+
+	return &PathError{Op: "transfer", Disk: name, Path: filePath, Err: err}
+}
+
+// statFile returns the file info using the context when the disk supports it
+func statFile(ctx context.Context, disk Disk, filePath string) (localstorage.FileInfo, error) {
+	if ctxDisk, ok := disk.(DiskContext); ok {
+		return ctxDisk.FileInfoCtx(ctx, filePath)
+	}
+
+	return disk.FileInfo(filePath)
+}
+
+// readStream opens the file using the context when the disk supports it
+func readStream(ctx context.Context, disk Disk, filePath string) (io.ReadCloser, error) {
+	if ctxDisk, ok := disk.(DiskContext); ok {
+		return ctxDisk.ReadStreamCtx(ctx, filePath)
+	}
+
+	return disk.ReadStream(filePath)
+}
+
+// writeStream writes the file using the context when the disk supports it
+func writeStream(ctx context.Context, disk Disk, filePath string, r io.Reader) (int64, error) {
+	if ctxDisk, ok := disk.(DiskContext); ok {
+		return ctxDisk.WriteStreamCtx(ctx, filePath, r)
+	}
+
+	return disk.WriteStream(filePath, r)
+}
+
+// deleteFile deletes the file using the context when the disk supports it
+func deleteFile(ctx context.Context, disk Disk, filePath string) error {
+	if ctxDisk, ok := disk.(DiskContext); ok {
+		return ctxDisk.DeleteCtx(ctx, filePath)
+	}
+
+	return disk.Delete(filePath)
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage_test
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/encryptstorage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+// corruptDisk returns altered content when reading the files back
+type corruptDisk struct {
+	Disk
+}
+
+func (c corruptDisk) ReadStream(filePath string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("corrupted")), nil
+}
+
+// failingDisk fails reading the files after part of their content
+type failingDisk struct {
+	Disk
+}
+
+func (f failingDisk) ReadStream(filePath string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("read failed")))), nil
+}
+
+func TestTransfer(t *testing.T) {
+	local := localstorage.New(t.TempDir())
+	mem := memstorage.New()
+	local.Create("uploads/video.mp4", []byte("video content"))
+
+	result, err := Transfer(context.Background(), local, "uploads/video.mp4", mem, "archive/video.mp4", TransferOpts{})
+	if err != nil {
+		t.Fatal("failed asserting transfer. ", err)
+	}
+	if result.Size != 13 || !result.Verified || result.SourceDeleted || len(result.Checksum) != 64 {
+		t.Errorf("failed asserting the result: %+v", result)
+	}
+	if content, _ := mem.Read("archive/video.mp4"); string(content) != "video content" {
+		t.Error("failed asserting the transferred content")
+	}
+
+	// back the other way deleting the source
+	result, err = Transfer(context.Background(), mem, "archive/video.mp4", local, "restored/video.mp4", TransferOpts{DeleteSource: true, Hash: md5.New})
+	if err != nil || !result.SourceDeleted || len(result.Checksum) != 32 {
+		t.Fatalf("failed asserting transfer deleting the source: %+v %v", result, err)
+	}
+	if ok, _ := mem.Exists("archive/video.mp4"); ok {
+		t.Error("failed asserting the source is deleted")
+	}
+	if content, _ := local.Read("restored/video.mp4"); string(content) != "video content" {
+		t.Error("failed asserting the restored content")
+	}
+}
+
+func TestTransferOverwrite(t *testing.T) {
+	for _, dst := range []Disk{localstorage.New(t.TempDir()), memstorage.New()} {
+		src := memstorage.New()
+		src.Create("file.txt", []byte("new"))
+		dst.Create("file.txt", []byte("old"))
+
+		if _, err := Transfer(context.Background(), src, "file.txt", dst, "file.txt", TransferOpts{}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("failed asserting transfer to an existing file on %T. %v", dst, err)
+		}
+		if _, err := Transfer(context.Background(), src, "file.txt", dst, "file.txt", TransferOpts{Overwrite: true}); err != nil {
+			t.Errorf("failed asserting overwrite on %T. %v", dst, err)
+		}
+		if content, _ := dst.Read("file.txt"); string(content) != "new" {
+			t.Errorf("failed asserting the overwritten content on %T", dst)
+		}
+
+		// a failed overwrite leaves the destination as it was
+		if _, err := Transfer(context.Background(), failingDisk{src}, "file.txt", dst, "file.txt", TransferOpts{Overwrite: true}); err == nil {
+			t.Errorf("failed asserting the failed overwrite on %T", dst)
+		}
+		if content, _ := dst.Read("file.txt"); string(content) != "new" {
+			t.Errorf("failed asserting the destination is kept on %T", dst)
+		}
+		if files, _ := dst.Files(""); len(files) != 1 {
+			t.Errorf("failed asserting the temp file is removed on %T", dst)
+		}
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+	mem := memstorage.New()
+	mem.Create("file.txt", []byte("content"))
+
+	if _, err := Transfer(context.Background(), mem, "missing.txt", memstorage.New(), "file.txt", TransferOpts{}); !errors.Is(err, ErrNotFound) {
+		t.Error("failed asserting transfer of a missing file. ", err)
+	}
+	if _, err := Transfer(context.Background(), mem, "file.txt", mem, "/./file.txt", TransferOpts{Overwrite: true}); !errors.Is(err, ErrSameFile) {
+		t.Error("failed asserting transfer onto the same file. ", err)
+	}
+
+	root := t.TempDir()
+	local, sameRoot := localstorage.New(root), localstorage.New(root)
+	local.Create("file.txt", []byte("content"))
+	keyring, _ := encryptstorage.NewKeyring(encryptstorage.Key{ID: "k1", Secret: make([]byte, 32)})
+	encrypted := encryptstorage.Wrap(local, keyring)
+	encrypted.Create("secret.txt", []byte("secret"))
+	tests := []struct {
+		src, dst         Disk
+		srcPath, dstPath string
+	}{
+		{local, sameRoot, "file.txt", "file.txt"},
+		{local, sameRoot, "file.txt", "./file.txt"},
+		{encrypted, encryptstorage.Wrap(sameRoot, keyring), "secret.txt", "secret.txt"},
+		{encrypted, sameRoot, "secret.txt", "secret.txt"},
+	}
+	for _, tt := range tests {
+		_, err := Transfer(context.Background(), tt.src, tt.srcPath, tt.dst, tt.dstPath, TransferOpts{Overwrite: true, DeleteSource: true})
+		if !errors.Is(err, ErrSameFile) {
+			t.Error("failed asserting transfer onto the same file through another disk. ", err)
+		}
+	}
+	if content, err := local.Read("file.txt"); err != nil || string(content) != "content" {
+		t.Error("failed asserting the file is kept. ", string(content), err)
+	}
+	if content, err := encrypted.Read("secret.txt"); err != nil || string(content) != "secret" {
+		t.Error("failed asserting the encrypted file is kept. ", string(content), err)
+	}
+
+	dst := corruptDisk{memstorage.New()}
+	_, err := Transfer(context.Background(), mem, "file.txt", dst, "file.txt", TransferOpts{DeleteSource: true})
+	var pathErr *PathError
+	if !errors.Is(err, ErrChecksumMismatch) || !errors.As(err, &pathErr) || pathErr.Op != "transfer" {
+		t.Error("failed asserting checksum mismatch. ", err)
+	}
+	if ok, _ := dst.Exists("file.txt"); ok {
+		t.Error("failed asserting the corrupted destination is deleted")
+	}
+	if ok, _ := mem.Exists("file.txt"); !ok {
+		t.Error("failed asserting the source is kept on mismatch")
+	}
+	if _, err := Transfer(context.Background(), mem, "file.txt", dst, "file.txt", TransferOpts{SkipVerify: true}); err != nil {
+		t.Error("failed asserting transfer skipping verification. ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Transfer(ctx, mem, "file.txt", memstorage.New(), "file.txt", TransferOpts{}); !errors.Is(err, context.Canceled) {
+		t.Error("failed asserting canceled transfer. ", err)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import "github.com/harranali/stowage/localstorage"
+
+// ErrTrashDisabled is returned by the trash
+// operations when no trash directory is set
+var ErrTrashDisabled = localstorage.ErrTrashDisabled
+
+// TrashOpts options of the trash, it's enabled by setting
+// the directory the deleted entries are moved into
+type TrashOpts = localstorage.TrashOpts
+
+// TrashEntry is a file or a directory moved into the trash
+type TrashEntry = localstorage.TrashEntry
+
+// Trash lists, restores and purges the deleted entries of a disk
+type Trash = localstorage.Trash
+
+// TrashDisk defines the disks moving the deleted entries into a trash
+type TrashDisk interface {
+	Trash() *Trash
+}
+
+// make sure the local storage has a trash
+var _ TrashDisk = (*localstorage.LocalStorage)(nil)
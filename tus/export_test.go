@@ -0,0 +1,12 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package tus
+
+// Locks returns the number of the locks kept by the handler
+func (h *Handler) Locks() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.locks)
+}
@@ -0,0 +1,695 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+// Package tus implements resumable uploads into a stowage disk
+// following the tus 1.0 core protocol along with the creation,
+// expiration, checksum and termination extensions
+package tus
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harranali/stowage"
+)
+
+// the protocol constants
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,creation-with-upload,expiration,checksum,termination"
+	Algorithms = "md5,sha1,sha256"
+
+	offsetContentType = "application/offset+octet-stream"
+	// statusChecksumMismatch is the status of the checksum extension
+	statusChecksumMismatch = 460
+)
+
+// Opts options for the upload handler
+type Opts struct {
+	// BasePath is the url path the handler is served under,
+	// it's used to build the locations of the uploads
+	BasePath string
+	// Dir is the directory of the disk the completed uploads are
+	// promoted into, they are named by their ids followed by the
+	// extension of the "filename" metadata if any
+	Dir string
+	// StateDir is the directory of the disk holding the partial
+	// uploads, it defaults to ".tus"
+	StateDir string
+	// MaxSize limits the size of the uploads, zero means no limit
+	MaxSize int64
+	// Expiration is the duration an unfinished upload is kept after its
+	// last change, zero keeps the unfinished uploads until they are
+	// terminated, see PurgeExpired
+	Expiration time.Duration
+	// OnComplete is called once an upload is completed and promoted
+	OnComplete func(Upload)
+	// Now returns the current time, it defaults to time.Now
+	Now func() time.Time
+}
+
+// Upload is the state of an upload
+type Upload struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Chunks are the offsets of the stored chunks
+	Chunks []int64 `json:"chunks,omitempty"`
+	// Expires is the time the upload expires, nil when it never does
+	Expires *time.Time `json:"expires,omitempty"`
+	// Path is the path of the promoted file once the upload is completed
+	Path string `json:"path,omitempty"`
+}
+
+// Completed reports whether all the content was received
+func (u Upload) Completed() bool {
+	return u.Offset == u.Length
+}
+
+// Handler serves the resumable uploads, the uploads are locked
+// while they are changed, so a handler must be the only one
+// serving the uploads of its state directory
+type Handler struct {
+	disk  stowage.Disk
+	opts  Opts
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is the lock of an upload, holders counts the
+// requests holding it or waiting for it
+type uploadLock struct {
+	sync.Mutex
+	holders int
+}
+
+// New returns a handler storing the uploads into the disk
+func New(disk stowage.Disk, opts Opts) *Handler {
+	if opts.StateDir == "" {
+		opts.StateDir = ".tus"
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if !strings.HasSuffix(opts.BasePath, "/") {
+		opts.BasePath += "/"
+	}
+
+	return &Handler{disk: disk, opts: opts, locks: map[string]*uploadLock{}}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", Version)
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" {
+		method = override
+	}
+
+	if method == http.MethodOptions {
+		h.options(w)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != Version {
+		w.Header().Set("Tus-Version", Version)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, h.opts.BasePath), "/")
+	if id == "" || strings.TrimSuffix(r.URL.Path, "/")+"/" == h.opts.BasePath {
+		if method != http.MethodPost {
+			w.Header().Set("Allow", "OPTIONS, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h.create(w, r)
+		return
+	}
+	if !validID(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	unlock := h.lock(id)
+	defer unlock()
+
+	switch method {
+	case http.MethodHead:
+		h.head(w, r, id)
+	case http.MethodPatch:
+		h.patch(w, r, id)
+	case http.MethodDelete:
+		h.terminate(w, r, id)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// options describes the server capabilities
+func (h *Handler) options(w http.ResponseWriter) {
+	header := w.Header()
+	header.Set("Tus-Version", Version)
+	header.Set("Tus-Extension", Extensions)
+	header.Set("Tus-Checksum-Algorithm", Algorithms)
+	if h.opts.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(h.opts.MaxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// create starts an upload, the content sent along is stored right away
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "deferred length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if h.opts.MaxSize > 0 && length > h.opts.MaxSize {
+		http.Error(w, "upload is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+
+	u := Upload{ID: newID(), Length: length, Metadata: metadata}
+	if h.opts.Expiration > 0 {
+		u.Expires = h.expiry()
+	}
+	unlock := h.lock(u.ID)
+	defer unlock()
+	if err := h.save(u); err != nil {
+		serverError(w)
+		return
+	}
+	w.Header().Set("Location", h.opts.BasePath+u.ID)
+
+	// creation with upload
+	if r.Header.Get("Content-Type") == offsetContentType {
+		var status int
+		if u, status, err = h.write(r, u); err != nil {
+			// an empty upload can't be resumed, the client creates it again
+			if u.Length == 0 {
+				h.disk.DeleteDirectory(h.stateDir(u.ID))
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	} else if u.Length == 0 {
+		if u, err = h.complete(u); err != nil {
+			h.disk.DeleteDirectory(h.stateDir(u.ID))
+			serverError(w)
+			return
+		}
+	}
+	setExpires(w, u)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// head reports the offset of the upload
+func (h *Handler) head(w http.ResponseWriter, r *http.Request, id string) {
+	u, status, err := h.load(id)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if len(u.Metadata) > 0 {
+		header.Set("Upload-Metadata", formatMetadata(u.Metadata))
+	}
+	setExpires(w, u)
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch stores a chunk at the offset of the upload
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "Content-Type must be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+	u, status, err := h.load(id)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if offset != u.Offset {
+		http.Error(w, "Upload-Offset doesn't match the upload offset", http.StatusConflict)
+		return
+	}
+	if u.Completed() {
+		http.Error(w, "upload is already completed", http.StatusForbidden)
+		return
+	}
+
+	if u, status, err = h.write(r, u); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	setExpires(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminate deletes the upload and its chunks
+func (h *Handler) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	if _, status, err := h.load(id); err != nil && status != http.StatusGone {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := h.disk.DeleteDirectory(h.stateDir(id)); err != nil {
+		serverError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errors answered by the handler
+var (
+	errNotFound         = errors.New("upload not found")
+	errExpired          = errors.New("upload has expired")
+	errChecksumMismatch = errors.New("checksum mismatch")
+	errTooLarge         = errors.New("chunk exceeds the upload length")
+)
+
+// write stores the request body as the next chunk, the chunk is
+// verified when a checksum is sent and discarded incase it doesn't
+// match, without a checksum the content received before the request
+// is interrupted is kept so the client can resume from there
+func (h *Handler) write(r *http.Request, u Upload) (Upload, int, error) {
+	var sum hash.Hash
+	var expected []byte
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		var err error
+		if sum, expected, err = parseChecksum(header); err != nil {
+			return u, http.StatusBadRequest, err
+		}
+	}
+
+	body := &chunkReader{r: io.LimitReader(r.Body, u.Length-u.Offset), keepPartial: sum == nil}
+	var content io.Reader = body
+	if sum != nil {
+		content = io.TeeReader(body, sum)
+	}
+	chunkPath := h.chunkPath(u.ID, u.Offset)
+	written, err := h.disk.WriteStream(chunkPath, content)
+	if err == nil && body.err != nil && written == 0 {
+		err = body.err
+	}
+	if err != nil {
+		h.disk.Delete(chunkPath)
+		return u, http.StatusInternalServerError, err
+	}
+
+	// the body must not be longer than the rest of the upload
+	if extra, _ := r.Body.Read(make([]byte, 1)); extra > 0 {
+		h.disk.Delete(chunkPath)
+		return u, http.StatusRequestEntityTooLarge, errTooLarge
+	}
+	if sum != nil && string(sum.Sum(nil)) != string(expected) {
+		h.disk.Delete(chunkPath)
+		return u, statusChecksumMismatch, errChecksumMismatch
+	}
+
+	if written > 0 {
+		u.Chunks = append(u.Chunks, u.Offset)
+		u.Offset += written
+	} else {
+		h.disk.Delete(chunkPath)
+	}
+	if h.opts.Expiration > 0 {
+		u.Expires = h.expiry()
+	}
+	// the final offset is saved by complete once the file is promoted,
+	// when it fails the last chunk is dropped so the client sends it again
+	if u.Completed() {
+		if u, err = h.complete(u); err != nil {
+			h.disk.Delete(chunkPath)
+			return u, http.StatusInternalServerError, err
+		}
+		return u, http.StatusNoContent, nil
+	}
+	if err := h.save(u); err != nil {
+		return u, http.StatusInternalServerError, err
+	}
+
+	return u, http.StatusNoContent, nil
+}
+
+// complete assembles the chunks and promotes the file into place by
+// renaming it, so the file never shows up partially written, the state
+// is saved completed only once the file is promoted
+func (h *Handler) complete(u Upload) (Upload, error) {
+	assembled := path.Join(h.stateDir(u.ID), "assembled")
+	readers := []io.Reader{}
+	closers := []io.Closer{}
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	for _, offset := range u.Chunks {
+		r, err := h.disk.ReadStream(h.chunkPath(u.ID, offset))
+		if err != nil {
+			return u, err
+		}
+		readers = append(readers, r)
+		closers = append(closers, r)
+	}
+	if _, err := h.disk.WriteStream(assembled, io.MultiReader(readers...)); err != nil {
+		h.disk.Delete(assembled)
+		return u, err
+	}
+
+	u.Path = path.Join(h.opts.Dir, u.ID+path.Ext(sanitizeName(u.Metadata["filename"])))
+	if err := h.disk.MakeDirectory(path.Dir(u.Path), 0755); err != nil {
+		h.disk.Delete(assembled)
+		return u, err
+	}
+	if err := h.disk.Rename(assembled, u.Path); err != nil {
+		h.disk.Delete(assembled)
+		return u, err
+	}
+	chunks := u.Chunks
+	u.Chunks = nil
+	if h.opts.Expiration > 0 {
+		u.Expires = h.expiry()
+	}
+	if err := h.save(u); err != nil {
+		// the chunks are kept so the upload can be completed again
+		h.disk.Delete(u.Path)
+		u.Chunks = chunks
+		return u, err
+	}
+	// only the state is kept so the offset can still be asked for
+	for _, offset := range chunks {
+		h.disk.Delete(h.chunkPath(u.ID, offset))
+	}
+	if h.opts.OnComplete != nil {
+		h.opts.OnComplete(u)
+	}
+
+	return u, nil
+}
+
+// Upload returns the state of the upload with the given id
+func (h *Handler) Upload(id string) (Upload, error) {
+	if !validID(id) {
+		return Upload{}, errNotFound
+	}
+	unlock := h.lock(id)
+	defer unlock()
+	u, _, err := h.load(id)
+
+	return u, err
+}
+
+// PurgeExpired deletes the expired uploads, the unfinished ones expire
+// after their last change and the state of the completed ones is kept
+// for the same duration, it returns the ids of the deleted uploads
+func (h *Handler) PurgeExpired() ([]string, error) {
+	dirs, err := h.disk.Directories(h.opts.StateDir)
+	if errors.Is(err, stowage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	purged := []string{}
+	for _, dir := range dirs {
+		id := path.Base(dir)
+		if !validID(id) {
+			continue
+		}
+		deleted, err := h.purge(id)
+		if err != nil {
+			return purged, err
+		}
+		if deleted {
+			purged = append(purged, id)
+		}
+	}
+	sort.Strings(purged)
+
+	return purged, nil
+}
+
+// purge deletes the upload if it expired
+func (h *Handler) purge(id string) (bool, error) {
+	unlock := h.lock(id)
+	defer unlock()
+
+	u, _, err := h.load(id)
+	if err != nil && !errors.Is(err, errExpired) {
+		// uploads missing their state are left alone
+		return false, nil
+	}
+	if u.Expires == nil || !h.opts.Now().After(*u.Expires) {
+		return false, nil
+	}
+	if err := h.disk.DeleteDirectory(h.stateDir(id)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// load reads the state of the upload, it returns the
+// status answering the error incase there is any
+func (h *Handler) load(id string) (Upload, int, error) {
+	data, err := h.disk.Read(h.infoPath(id))
+	if errors.Is(err, stowage.ErrNotFound) {
+		return Upload{}, http.StatusNotFound, errNotFound
+	}
+	if err != nil {
+		return Upload{}, http.StatusInternalServerError, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return Upload{}, http.StatusInternalServerError, err
+	}
+	if !u.Completed() && u.Expires != nil && h.opts.Now().After(*u.Expires) {
+		return u, http.StatusGone, errExpired
+	}
+
+	return u, http.StatusOK, nil
+}
+
+// save writes the state of the upload replacing the previous one
+func (h *Handler) save(u Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	infoPath := h.infoPath(u.ID)
+	if policyDisk, ok := h.disk.(stowage.PolicyDisk); ok {
+		_, err = policyDisk.CreateWith(infoPath, data, stowage.Overwrite)
+		return err
+	}
+	if err := h.disk.Delete(infoPath); err != nil && !errors.Is(err, stowage.ErrNotFound) {
+		return err
+	}
+
+	return h.disk.Create(infoPath, data)
+}
+
+// lock locks the upload and returns the function unlocking it, the
+// lock is dropped once it's neither held nor awaited, so the requests
+// for unknown or finished uploads leave nothing behind
+func (h *Handler) lock(id string) (unlock func()) {
+	h.mu.Lock()
+	lock, ok := h.locks[id]
+	if !ok {
+		lock = &uploadLock{}
+		h.locks[id] = lock
+	}
+	lock.holders++
+	h.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		h.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(h.locks, id)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// stateDir returns the directory holding the state of the upload
+func (h *Handler) stateDir(id string) string {
+	return path.Join(h.opts.StateDir, id)
+}
+
+// infoPath returns the path of the state of the upload
+func (h *Handler) infoPath(id string) string {
+	return path.Join(h.stateDir(id), "info.json")
+}
+
+// chunkPath returns the path of the chunk starting at the offset,
+// the offsets are padded so the chunks are listed in order
+func (h *Handler) chunkPath(id string, offset int64) string {
+	return path.Join(h.stateDir(id), fmt.Sprintf("chunk-%020d", offset))
+}
+
+// chunkReader reads a chunk, with keepPartial a failed read ends the
+// chunk so the content received before the failure is kept
+type chunkReader struct {
+	r           io.Reader
+	keepPartial bool
+	err         error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF && c.keepPartial {
+		c.err = err
+		return n, io.EOF
+	}
+
+	return n, err
+}
+
+// parseChecksum parses the Upload-Checksum header
+func parseChecksum(header string) (hash.Hash, []byte, error) {
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 {
+		return nil, nil, errors.New("invalid Upload-Checksum")
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, errors.New("invalid Upload-Checksum")
+	}
+	switch parts[0] {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	}
+
+	return nil, nil, errors.New("unsupported checksum algorithm")
+}
+
+// parseMetadata parses the Upload-Metadata header,
+// the values are base64 encoded and may be missing
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("invalid metadata pair")
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+
+	return metadata, nil
+}
+
+// formatMetadata formats the Upload-Metadata header
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// expiry returns the time an upload changed now expires
+func (h *Handler) expiry() *time.Time {
+	expires := h.opts.Now().Add(h.opts.Expiration)
+	return &expires
+}
+
+// setExpires sets the Upload-Expires header of the unfinished uploads
+func setExpires(w http.ResponseWriter, u Upload) {
+	if u.Expires != nil && !u.Completed() {
+		w.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	}
+}
+
+// serverError answers with an internal error without detailing it
+func serverError(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// newID returns a random upload id
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b[:])
+}
+
+// validID reports whether the id is one made by newID,
+// so it can't lead outside the state directory
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+
+	return err == nil
+}
+
+// sanitizeName returns the base of the name sent by the client
+func sanitizeName(name string) string {
+	return name[strings.LastIndexAny(name, "/\\")+1:]
+}
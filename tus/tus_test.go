@@ -0,0 +1,390 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package tus_test
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+	. "github.com/harranali/stowage/tus"
+)
+
+// request sends a tus request to the handler
+func request(h http.Handler, method string, target string, body io.Reader, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Tus-Resumable", Version)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+// patch sends a chunk at the given offset
+func patch(h http.Handler, location string, offset string, chunk string, header map[string]string) *httptest.ResponseRecorder {
+	all := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": offset}
+	for k, v := range header {
+		all[k] = v
+	}
+
+	return request(h, http.MethodPatch, location, strings.NewReader(chunk), all)
+}
+
+// sha1Checksum returns the Upload-Checksum header of the chunk
+func sha1Checksum(chunk string) string {
+	sum := sha1.Sum([]byte(chunk))
+	return "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestOptions(t *testing.T) {
+	h := New(memstorage.New(), Opts{BasePath: "/files/", MaxSize: 1024})
+	w := request(h, http.MethodOptions, "/files/", nil, nil)
+	header := w.Header()
+	if w.Code != http.StatusNoContent || header.Get("Tus-Version") != "1.0.0" || header.Get("Tus-Max-Size") != "1024" ||
+		!strings.Contains(header.Get("Tus-Extension"), "checksum") || !strings.Contains(header.Get("Tus-Checksum-Algorithm"), "sha1") {
+		t.Errorf("failed asserting options: %d %v", w.Code, header)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/files/", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != "1.0.0" {
+		t.Errorf("failed asserting a missing Tus-Resumable: %d", w.Code)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	for _, disk := range []stowage.Disk{localstorage.New(t.TempDir()), memstorage.New()} {
+		completed := []Upload{}
+		h := New(disk, Opts{BasePath: "/files", Dir: "uploads", OnComplete: func(u Upload) { completed = append(completed, u) }})
+
+		metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("video.mp4")) + ",is_private"
+		w := request(h, http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "11", "Upload-Metadata": metadata})
+		location := w.Header().Get("Location")
+		if w.Code != http.StatusCreated || !strings.HasPrefix(location, "/files/") {
+			t.Fatalf("failed asserting creation on %T: %d %s", disk, w.Code, w.Body)
+		}
+
+		w = request(h, http.MethodHead, location, nil, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "0" || w.Header().Get("Upload-Length") != "11" ||
+			w.Header().Get("Upload-Metadata") != "filename dmlkZW8ubXA0,is_private " || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("failed asserting head on %T: %d %v", disk, w.Code, w.Header())
+		}
+
+		if w := patch(h, location, "0", "hello", nil); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "5" {
+			t.Fatalf("failed asserting the first chunk on %T: %d %s", disk, w.Code, w.Body)
+		}
+		if w := patch(h, location, "0", "hello", nil); w.Code != http.StatusConflict {
+			t.Errorf("failed asserting a wrong offset on %T: %d", disk, w.Code)
+		}
+		w = request(h, http.MethodPatch, location, strings.NewReader(" world"), map[string]string{"Upload-Offset": "5"})
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("failed asserting a wrong content type on %T: %d", disk, w.Code)
+		}
+		if w := patch(h, location, "5", " world", map[string]string{"Upload-Checksum": sha1Checksum("other")}); w.Code != 460 {
+			t.Errorf("failed asserting a checksum mismatch on %T: %d", disk, w.Code)
+		}
+		if w := request(h, http.MethodHead, location, nil, nil); w.Header().Get("Upload-Offset") != "5" {
+			t.Errorf("failed asserting the mismatching chunk is discarded on %T: %v", disk, w.Header())
+		}
+		if w := patch(h, location, "5", " world!", nil); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("failed asserting a chunk past the length on %T: %d", disk, w.Code)
+		}
+		if w := patch(h, location, "5", " world", map[string]string{"Upload-Checksum": sha1Checksum(" world")}); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "11" {
+			t.Fatalf("failed asserting the last chunk on %T: %d %s", disk, w.Code, w.Body)
+		}
+
+		if len(completed) != 1 || !strings.HasSuffix(completed[0].Path, ".mp4") || completed[0].Metadata["filename"] != "video.mp4" {
+			t.Fatalf("failed asserting the completion on %T: %+v", disk, completed)
+		}
+		if content, _ := disk.Read(completed[0].Path); string(content) != "hello world" {
+			t.Errorf("failed asserting the promoted content on %T: %s", disk, content)
+		}
+		id := strings.TrimPrefix(location, "/files/")
+		if files, _ := disk.Files(".tus/" + id); len(files) != 1 {
+			t.Errorf("failed asserting only the state is kept on %T: %d files", disk, len(files))
+		}
+		if w := request(h, http.MethodHead, location, nil, nil); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "11" {
+			t.Errorf("failed asserting head of a completed upload on %T: %d", disk, w.Code)
+		}
+		if w := patch(h, location, "11", "more", nil); w.Code != http.StatusForbidden {
+			t.Errorf("failed asserting a chunk after completion on %T: %d", disk, w.Code)
+		}
+		if u, err := h.Upload(id); err != nil || !u.Completed() {
+			t.Errorf("failed asserting the upload state on %T: %+v %v", disk, u, err)
+		}
+	}
+}
+
+func TestCreationWithUpload(t *testing.T) {
+	disk := memstorage.New()
+	h := New(disk, Opts{Dir: "uploads"})
+
+	w := request(h, http.MethodPost, "/", strings.NewReader("all at once"), map[string]string{
+		"Upload-Length":   "11",
+		"Content-Type":    "application/offset+octet-stream",
+		"Upload-Checksum": sha1Checksum("all at once"),
+	})
+	if w.Code != http.StatusCreated || w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("failed asserting creation with upload: %d %s", w.Code, w.Body)
+	}
+	u, _ := h.Upload(strings.TrimPrefix(w.Header().Get("Location"), "/"))
+	if content, _ := disk.Read(u.Path); string(content) != "all at once" {
+		t.Errorf("failed asserting the uploaded content: %s", content)
+	}
+
+	w = request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "0"})
+	u, _ = h.Upload(strings.TrimPrefix(w.Header().Get("Location"), "/"))
+	if w.Code != http.StatusCreated || !u.Completed() || u.Path == "" {
+		t.Errorf("failed asserting an empty upload: %d %+v", w.Code, u)
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	h := New(memstorage.New(), Opts{MaxSize: 10})
+
+	tests := []struct {
+		header map[string]string
+		status int
+	}{
+		{map[string]string{}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "-1"}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "11"}, http.StatusRequestEntityTooLarge},
+		{map[string]string{"Upload-Defer-Length": "1"}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "5", "Upload-Metadata": "name !!!"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := request(h, http.MethodPost, "/", nil, tt.header); w.Code != tt.status {
+			t.Errorf("failed asserting the creation with %v: %d", tt.header, w.Code)
+		}
+	}
+
+	w := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "5"})
+	location := w.Header().Get("Location")
+	if w := patch(h, location, "0", "x", map[string]string{"Upload-Checksum": "crc32 AAAA"}); w.Code != http.StatusBadRequest {
+		t.Errorf("failed asserting an unsupported checksum: %d", w.Code)
+	}
+	for _, target := range []string{"/0123456789abcdef0123456789abcdef", "/../../etc", "/not-an-id"} {
+		if w := request(h, http.MethodHead, target, nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("failed asserting %s is not found: %d", target, w.Code)
+		}
+	}
+	if w := request(h, http.MethodGet, location, nil, nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("failed asserting GET is not allowed: %d", w.Code)
+	}
+}
+
+// failingBody returns its content then fails like a dropped connection
+type failingBody struct {
+	content io.Reader
+}
+
+func (f *failingBody) Read(p []byte) (int, error) {
+	n, err := f.content.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestResume(t *testing.T) {
+	disk := localstorage.New(t.TempDir())
+	h := New(disk, Opts{})
+	location := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"}).Header().Get("Location")
+
+	req := httptest.NewRequest(http.MethodPatch, location, &failingBody{strings.NewReader("01234")})
+	req.Header.Set("Tus-Resumable", Version)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := request(h, http.MethodHead, location, nil, nil)
+	if w.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("failed asserting the received content is kept: %v", w.Header())
+	}
+	if w := patch(h, location, "5", "56789", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("failed asserting the resumed upload: %d %s", w.Code, w.Body)
+	}
+	u, _ := h.Upload(strings.TrimPrefix(location, "/"))
+	r, _ := disk.ReadStream(u.Path)
+	defer r.Close()
+	if content, _ := ioutil.ReadAll(r); string(content) != "0123456789" {
+		t.Errorf("failed asserting the resumed content: %s", content)
+	}
+}
+
+// renameFailing fails renaming the files while fail is set
+type renameFailing struct {
+	stowage.Disk
+	fail bool
+}
+
+func (r *renameFailing) Rename(filePath string, newFilePath string) error {
+	if r.fail {
+		return errors.New("rename failed")
+	}
+	return r.Disk.Rename(filePath, newFilePath)
+}
+
+func TestFailedPromotion(t *testing.T) {
+	disk := &renameFailing{Disk: memstorage.New(), fail: true}
+	h := New(disk, Opts{Dir: "uploads"})
+	location := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"}).Header().Get("Location")
+	patch(h, location, "0", "01234", nil)
+
+	if w := patch(h, location, "5", "56789", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failed asserting the failed promotion: %d", w.Code)
+	}
+	if w := request(h, http.MethodHead, location, nil, nil); w.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("failed asserting the last chunk is sent again: %v", w.Header())
+	}
+
+	disk.fail = false
+	if w := patch(h, location, "5", "56789", nil); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("failed asserting the retried chunk: %d %s", w.Code, w.Body)
+	}
+	u, _ := h.Upload(strings.TrimPrefix(location, "/"))
+	if content, err := disk.Read(u.Path); err != nil || string(content) != "0123456789" {
+		t.Errorf("failed asserting the promoted content: %s %v", content, err)
+	}
+
+	// an empty upload is created again
+	disk.fail = true
+	if w := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "0"}); w.Code != http.StatusInternalServerError {
+		t.Errorf("failed asserting the failed empty upload: %d", w.Code)
+	} else if w := request(h, http.MethodHead, w.Header().Get("Location"), nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("failed asserting the failed empty upload is dropped: %d", w.Code)
+	}
+}
+
+// saveFailing fails saving the state of the uploads while fail is set
+type saveFailing struct {
+	stowage.Disk
+	fail bool
+}
+
+func (s *saveFailing) Delete(filePath string) error {
+	if s.fail && path.Base(filePath) == "info.json" {
+		return errors.New("save failed")
+	}
+	return s.Disk.Delete(filePath)
+}
+
+func TestFailedCompletionSave(t *testing.T) {
+	disk := &saveFailing{Disk: memstorage.New()}
+	h := New(disk, Opts{Dir: "uploads"})
+	location := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"}).Header().Get("Location")
+	patch(h, location, "0", "01234", nil)
+
+	disk.fail = true
+	if w := patch(h, location, "5", "56789", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failed asserting the failed save: %d", w.Code)
+	}
+	if files, _ := disk.AllFiles("uploads"); len(files) != 0 {
+		t.Errorf("failed asserting the promoted file is removed: %d files", len(files))
+	}
+
+	// the chunks are kept so the upload is completed by the retry
+	disk.fail = false
+	if w := patch(h, location, "5", "56789", nil); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("failed asserting the retried chunk: %d %s", w.Code, w.Body)
+	}
+	u, _ := h.Upload(strings.TrimPrefix(location, "/"))
+	if content, err := disk.Read(u.Path); err != nil || string(content) != "0123456789" {
+		t.Errorf("failed asserting the promoted content: %s %v", content, err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	disk := memstorage.New()
+	h := New(disk, Opts{Expiration: time.Hour, Now: func() time.Time { return now }})
+
+	w := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"})
+	location := w.Header().Get("Location")
+	if w.Header().Get("Upload-Expires") != "Tue, 01 Jun 2021 11:00:00 GMT" {
+		t.Errorf("failed asserting Upload-Expires: %v", w.Header())
+	}
+	other := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"}).Header().Get("Location")
+
+	// a change extends the expiration
+	now = now.Add(30 * time.Minute)
+	if w := patch(h, location, "0", "01234", nil); w.Header().Get("Upload-Expires") != "Tue, 01 Jun 2021 11:30:00 GMT" {
+		t.Errorf("failed asserting the extended expiration: %v", w.Header())
+	}
+
+	now = now.Add(45 * time.Minute)
+	if w := request(h, http.MethodHead, other, nil, nil); w.Code != http.StatusGone {
+		t.Errorf("failed asserting an expired upload: %d", w.Code)
+	}
+	if w := request(h, http.MethodHead, location, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("failed asserting an extended upload: %d", w.Code)
+	}
+
+	h = New(disk, Opts{})
+	never := strings.TrimPrefix(request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"}).Header().Get("Location"), "/")
+	if info, _ := disk.Read(path.Join(".tus", never, "info.json")); strings.Contains(string(info), "expires") {
+		t.Errorf("failed asserting an upload without expiration has no expiry: %s", info)
+	}
+
+	h = New(disk, Opts{Expiration: time.Hour, Now: func() time.Time { return now }})
+	purged, err := h.PurgeExpired()
+	if err != nil || len(purged) != 1 || purged[0] != strings.TrimPrefix(other, "/") {
+		t.Errorf("failed asserting the purge: %v %v", purged, err)
+	}
+	if w := request(h, http.MethodHead, other, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("failed asserting the purged upload is gone: %d", w.Code)
+	}
+}
+
+func TestTermination(t *testing.T) {
+	disk := memstorage.New()
+	h := New(disk, Opts{})
+	location := request(h, http.MethodPost, "/", nil, map[string]string{"Upload-Length": "10"}).Header().Get("Location")
+	patch(h, location, "0", "01234", nil)
+
+	if w := request(h, http.MethodDelete, location, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("failed asserting termination: %d", w.Code)
+	}
+	if w := request(h, http.MethodHead, location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("failed asserting the terminated upload is gone: %d", w.Code)
+	}
+	if w := request(h, http.MethodPost, location, nil, map[string]string{"X-HTTP-Method-Override": "DELETE"}); w.Code != http.StatusNotFound {
+		t.Errorf("failed asserting the method override: %d", w.Code)
+	}
+}
+
+func TestLocksReleased(t *testing.T) {
+	h := New(memstorage.New(), Opts{BasePath: "/files"})
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("%032x", i)
+		request(h, http.MethodHead, "/files/"+id, nil, nil)
+		patch(h, "/files/"+id, "0", "hello", nil)
+	}
+
+	w := request(h, http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "5"})
+	location := w.Header().Get("Location")
+	patch(h, location, "0", "hello", nil)
+	request(h, http.MethodHead, location, nil, nil)
+
+	if n := h.Locks(); n != 0 {
+		t.Errorf("failed asserting the locks are dropped once released, %d are kept", n)
+	}
+}
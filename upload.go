@@ -0,0 +1,387 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/harranali/stowage/localstorage"
+)
+
+// NamingStrategy decides the names the uploaded files are stored with
+type NamingStrategy int
+
+const (
+	// OriginalName keeps the sanitized name sent by the client,
+	// an upload to an existing name fails
+	OriginalName NamingStrategy = iota
+	// UUIDName names the files with a random UUID
+	// followed by their original extension
+	UUIDName
+	// HashName names the files with the hex encoded sha256 of their
+	// content followed by their original extension, an upload of
+	// an already stored content keeps the stored file
+	HashName
+)
+
+// errors returned by the upload handler
+var (
+	ErrUploadTooLarge   = errors.New("upload is too large")
+	ErrUploadNotAllowed = errors.New("upload type is not allowed")
+)
+
+// UploadOpts options for the upload handler
+type UploadOpts struct {
+	// Dir is the directory of the disk the files are stored in
+	Dir string
+	// Field limits the stored files to the ones sent in the
+	// given form field, other files are ignored
+	Field string
+	// MaxFileSize limits the size of every file, zero means no limit
+	MaxFileSize int64
+	// MaxRequestSize limits the size of the request body, zero means no limit
+	MaxRequestSize int64
+	// MaxFiles limits the number of files of a request, zero means no limit
+	MaxFiles int
+	// AllowedExtensions limits the files to the given
+	// extensions without the dot, case insensitive
+	AllowedExtensions []string
+	// AllowedTypes limits the files to the content types matching any of
+	// the patterns like "image/png" or "image/*", the content type is
+	// sniffed from the content, the extension is used only when
+	// the content isn't recognized
+	AllowedTypes []string
+	// Naming defaults to OriginalName
+	Naming NamingStrategy
+}
+
+// UploadedFile describes a stored file in the upload response
+type UploadedFile struct {
+	Field        string    `json:"field"`
+	OriginalName string    `json:"originalName"`
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType"`
+	Checksum     string    `json:"sha256"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// UploadHandler returns a handler storing the files of multipart form
+// uploads into the disk, the parts are streamed to the disk one by one
+// without being buffered, it answers with a JSON object holding the
+// stored files under "files" or the failure under "error", incase any
+// file fails the files already stored by the request are deleted
+func UploadHandler(disk Disk, opts UploadOpts) http.Handler {
+	return &uploadHandler{disk: disk, dir: cleanPath(opts.Dir), opts: opts}
+}
+
+// uploadHandler stores the uploaded files
+type uploadHandler struct {
+	disk Disk
+	dir  string
+	opts UploadOpts
+}
+
+func (h *uploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	if h.opts.MaxRequestSize > 0 {
+		r.Body = &limitedBody{&limitedReader{r: r.Body, max: h.opts.MaxRequestSize}, r.Body}
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	stored := []UploadedFile{}
+	created := []string{}
+	if err := h.storeParts(r.Context(), reader, &stored, &created); err != nil {
+		// delete the files created before the failure
+		for _, filePath := range created {
+			deleteFile(context.Background(), h.disk, filePath)
+		}
+		writeJSONError(w, uploadStatus(err), err)
+		return
+	}
+	if len(stored) == 0 {
+		writeJSONError(w, http.StatusBadRequest, errors.New("no files were uploaded"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"files": stored})
+}
+
+// storeParts stores the file parts one by one, created
+// collects the paths of the files created by the request
+func (h *uploadHandler) storeParts(ctx context.Context, reader *multipart.Reader, stored *[]UploadedFile, created *[]string) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" || (h.opts.Field != "" && part.FormName() != h.opts.Field) {
+			part.Close()
+			continue
+		}
+		if h.opts.MaxFiles > 0 && len(*stored) >= h.opts.MaxFiles {
+			part.Close()
+			return fmt.Errorf("%w: more than %d files", ErrUploadTooLarge, h.opts.MaxFiles)
+		}
+
+		f, isNew, err := h.storePart(ctx, part)
+		part.Close()
+		if isNew {
+			*created = append(*created, f.Path)
+		}
+		if err != nil {
+			return err
+		}
+		*stored = append(*stored, f)
+	}
+}
+
+// storePart checks the part and streams it into the disk, isNew
+// reports whether the stored file was created by the part
+func (h *uploadHandler) storePart(ctx context.Context, part *multipart.Part) (f UploadedFile, isNew bool, err error) {
+	f = UploadedFile{Field: part.FormName(), OriginalName: part.FileName()}
+	original := sanitizeName(part.FileName())
+	if original == "" {
+		return f, false, errInvalidName
+	}
+	ext := path.Ext(original)
+	if len(h.opts.AllowedExtensions) > 0 && !containsFold(h.opts.AllowedExtensions, strings.TrimPrefix(ext, ".")) {
+		return f, false, fmt.Errorf("%w: extension %q", ErrUploadNotAllowed, ext)
+	}
+
+	// sniff the content type without buffering more than the head
+	br := bufio.NewReaderSize(part, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return f, false, err
+	}
+	f.ContentType = sniffContentType(original, head)
+	if len(h.opts.AllowedTypes) > 0 && !matchAnyType(f.ContentType, h.opts.AllowedTypes) {
+		return f, false, fmt.Errorf("%w: content type %q", ErrUploadNotAllowed, f.ContentType)
+	}
+
+	sum := sha256.New()
+	var content io.Reader = io.TeeReader(br, sum)
+	if h.opts.MaxFileSize > 0 {
+		content = &limitedReader{r: content, max: h.opts.MaxFileSize}
+	}
+
+	name := original
+	switch h.opts.Naming {
+	case UUIDName:
+		name = newUUID() + ext
+	case HashName:
+		// the name is known once the content is read
+		name = ".upload-" + newUUID() + ".tmp"
+	}
+	f.Path = path.Join(h.dir, name)
+	if _, err := writeStream(ctx, h.disk, f.Path, content); err != nil {
+		if !errors.Is(err, ErrAlreadyExists) {
+			// remove what may have been written
+			deleteFile(context.Background(), h.disk, f.Path)
+		}
+		return f, false, err
+	}
+	f.Checksum = hex.EncodeToString(sum.Sum(nil))
+
+	if h.opts.Naming == HashName {
+		if f.Path, isNew, err = h.placeByHash(ctx, f.Path, f.Checksum+ext); err != nil {
+			return f, isNew, err
+		}
+	} else {
+		isNew = true
+	}
+
+	info, err := h.disk.FileInfo(f.Path)
+	if err != nil {
+		return f, isNew, err
+	}
+	f.Name = info.Name
+	f.Size = info.Size
+	f.LastModified = info.LastModified
+
+	return f, isNew, nil
+}
+
+// placeByHash renames the temporary file to its content hash name,
+// incase the content is already stored the temporary file is deleted
+func (h *uploadHandler) placeByHash(ctx context.Context, tmpPath string, name string) (string, bool, error) {
+	filePath := path.Join(h.dir, name)
+	exists, err := h.disk.Exists(filePath)
+	if err != nil {
+		deleteFile(context.Background(), h.disk, tmpPath)
+		return tmpPath, false, err
+	}
+	if exists {
+		return filePath, false, deleteFile(ctx, h.disk, tmpPath)
+	}
+	if err := h.disk.Rename(tmpPath, filePath); err != nil {
+		deleteFile(context.Background(), h.disk, tmpPath)
+		return tmpPath, false, err
+	}
+
+	return filePath, true, nil
+}
+
+// errInvalidName is returned for the file names that can't be stored
+var errInvalidName = errors.New("invalid file name")
+
+// sanitizeName returns the base of the name sent by the client
+// without the control characters, or "" if nothing is left
+func sanitizeName(name string) string {
+	// browsers on windows may send the full path
+	name = name[strings.LastIndexAny(name, "/\\")+1:]
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == ".." {
+		return ""
+	}
+
+	return name
+}
+
+// sniffContentType returns the content type sniffed from the head,
+// the extension refines the generic types only
+func sniffContentType(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	byExtension := localstorage.ContentTypeByExtension(name, nil)
+	switch {
+	case byExtension == "":
+		return sniffed
+	case sniffed == "application/octet-stream":
+		return byExtension
+	case strings.HasPrefix(sniffed, "text/plain") && (strings.HasPrefix(byExtension, "text/") || byExtension == "application/json"):
+		return byExtension
+	}
+
+	return sniffed
+}
+
+// matchAnyType reports whether the content type matches any of the patterns
+func matchAnyType(contentType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if localstorage.MatchContentType(contentType, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsFold reports whether the values contain the value ignoring the case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimPrefix(v, "."), value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// uploadStatus returns the status code answering the error
+func uploadStatus(err error) int {
+	var pathErr *PathError
+	switch {
+	case errors.Is(err, ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUploadNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.As(err, &pathErr), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusInternalServerError
+	}
+
+	// the request couldn't be parsed
+	return http.StatusBadRequest
+}
+
+// writeJSON answers with the value encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError answers with the error, the internal
+// failures are not detailed to the client
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// limitedReader fails with ErrUploadTooLarge once more than max bytes are
+// read, the bytes past the limit are withheld so a parser reading ahead
+// can't complete the content
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if left := l.max - l.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n - int(l.read-l.max), ErrUploadTooLarge
+	}
+
+	return n, err
+}
+
+// limitedBody limits the size of a request body
+type limitedBody struct {
+	*limitedReader
+	io.Closer
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/harranali/stowage"
+	"github.com/harranali/stowage/localstorage"
+	"github.com/harranali/stowage/memstorage"
+)
+
+// uploadPart is a part of a multipart upload
+type uploadPart struct {
+	field   string
+	name    string
+	content string
+}
+
+// upload posts the parts to the handler and decodes the response
+func upload(t *testing.T, h http.Handler, parts ...uploadPart) (int, []UploadedFile, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.name == "" {
+			mw.WriteField(p.field, p.content)
+			continue
+		}
+		w, _ := mw.CreateFormFile(p.field, p.name)
+		w.Write([]byte(p.content))
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var resp struct {
+		Files []UploadedFile
+		Error string
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal("failed asserting a JSON response. ", err)
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Error("failed asserting the JSON content type")
+	}
+
+	return w.Code, resp.Files, resp.Error
+}
+
+const pngHead = "\x89PNG\r\n\x1a\n"
+
+func TestUploadHandler(t *testing.T) {
+	for _, d := range []Disk{localstorage.New(t.TempDir()), memstorage.New()} {
+		h := UploadHandler(d, UploadOpts{Dir: "uploads"})
+		status, files, msg := upload(t, h,
+			uploadPart{"title", "", "holiday"},
+			uploadPart{"photo", `C:\pictures\beach.png`, pngHead + "pixels"},
+			uploadPart{"doc", "notes.txt", "some notes"},
+		)
+		if status != http.StatusCreated || len(files) != 2 {
+			t.Fatalf("failed asserting the upload on %T: %d %s", d, status, msg)
+		}
+		if files[0].Path != "uploads/beach.png" || files[0].Field != "photo" || files[0].OriginalName != `C:\pictures\beach.png` ||
+			files[0].ContentType != "image/png" || files[0].Size != 14 || len(files[0].Checksum) != 64 {
+			t.Errorf("failed asserting the stored file on %T: %+v", d, files[0])
+		}
+		if content, _ := d.Read("uploads/notes.txt"); string(content) != "some notes" {
+			t.Errorf("failed asserting the stored content on %T", d)
+		}
+
+		// the original name is taken
+		if status, _, _ := upload(t, h, uploadPart{"doc", "notes.txt", "again"}); status != http.StatusConflict {
+			t.Errorf("failed asserting a conflicting upload on %T: %d", d, status)
+		}
+	}
+}
+
+func TestUploadNaming(t *testing.T) {
+	d := memstorage.New()
+	status, files, _ := upload(t, UploadHandler(d, UploadOpts{Naming: UUIDName}), uploadPart{"f", "a.txt", "a"}, uploadPart{"f", "b.txt", "b"})
+	if status != http.StatusCreated || len(files[0].Name) != 40 || !strings.HasSuffix(files[0].Name, ".txt") || files[0].Name == files[1].Name {
+		t.Errorf("failed asserting uuid names: %+v", files)
+	}
+
+	h := UploadHandler(d, UploadOpts{Dir: "blobs", Naming: HashName})
+	status, files, _ = upload(t, h, uploadPart{"f", "hello.txt", "hello world"})
+	hashName := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9.txt"
+	if status != http.StatusCreated || files[0].Path != "blobs/"+hashName || files[0].Size != 11 {
+		t.Errorf("failed asserting hash names: %d %+v", status, files)
+	}
+	// the same content is stored once
+	status, files, _ = upload(t, h, uploadPart{"f", "copy.txt", "hello world"})
+	if status != http.StatusCreated || files[0].Path != "blobs/"+hashName {
+		t.Errorf("failed asserting a duplicated content: %d %+v", status, files)
+	}
+	if stored, _ := d.Files("blobs"); len(stored) != 1 {
+		t.Errorf("failed asserting no temporary files are left: %d", len(stored))
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	d := memstorage.New()
+	opts := UploadOpts{
+		Field:             "file",
+		MaxFileSize:       10,
+		MaxFiles:          2,
+		AllowedExtensions: []string{"png", ".TXT"},
+		AllowedTypes:      []string{"image/*", "text/plain"},
+	}
+	h := UploadHandler(d, opts)
+
+	tests := []struct {
+		parts  []uploadPart
+		status int
+	}{
+		{[]uploadPart{{"file", "big.txt", "01234567890"}}, http.StatusRequestEntityTooLarge},
+		{[]uploadPart{{"file", "page.html", "<html>"}}, http.StatusUnsupportedMediaType},
+		{[]uploadPart{{"file", "fake.png", "<html><body>"}}, http.StatusUnsupportedMediaType},
+		{[]uploadPart{{"file", "a.txt", "a"}, {"file", "b.txt", "b"}, {"file", "c.txt", "c"}}, http.StatusRequestEntityTooLarge},
+		{[]uploadPart{{"other", "a.txt", "a"}}, http.StatusBadRequest},
+		{[]uploadPart{{"file", "..", "a"}}, http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		if status, _, msg := upload(t, h, tt.parts...); status != tt.status {
+			t.Errorf("failed asserting the status of upload %d: %d %s", i, status, msg)
+		}
+	}
+	if files, _ := d.AllFiles("."); len(files) != 0 {
+		t.Errorf("failed asserting the failed uploads are cleaned up: %d files", len(files))
+	}
+
+	status, files, _ := upload(t, h, uploadPart{"file", "UPPER.TXT", "fine"}, uploadPart{"file", "image.png", pngHead})
+	if status != http.StatusCreated || len(files) != 2 {
+		t.Errorf("failed asserting allowed uploads: %d %+v", status, files)
+	}
+
+	h = UploadHandler(d, UploadOpts{MaxRequestSize: 100})
+	if status, _, _ := upload(t, h, uploadPart{"file", "large.bin", strings.Repeat("x", 200)}); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("failed asserting the request size limit: %d", status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/upload", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("failed asserting the method is not allowed: %d", w.Code)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 Harran Ali <harran.m@gmail.com>. All rights reserved.
+// Use of this source code is governed by MIT-style
+// license that can be found in the LICENSE file.
+
+package stowage
+
+import (
+	"context"
+
+	"github.com/harranali/stowage/localstorage"
+)
+
+// ErrVersioningDisabled is returned by the versions
+// operations when no versions directory is set
+var ErrVersioningDisabled = localstorage.ErrVersioningDisabled
+
+// VersioningOpts options of the versioning, it's enabled by setting
+// the directory the versions are kept in
+type VersioningOpts = localstorage.VersioningOpts
+
+// Version is a prior content of a file kept when the file
+// was overwritten, deleted, moved or renamed
+type Version = localstorage.Version
+
+// VersionDisk defines the versions operations
+type VersionDisk interface {
+	Versions(filePath string) ([]Version, error)
+	VersionsCtx(ctx context.Context, filePath string) ([]Version, error)
+	ReadVersion(filePath string, id string) ([]byte, error)
+	ReadVersionCtx(ctx context.Context, filePath string, id string) ([]byte, error)
+	Restore(filePath string, id string) error
+	RestoreCtx(ctx context.Context, filePath string, id string) error
+	PruneVersions() error
+	PruneVersionsCtx(ctx context.Context) error
+}
+
+// make sure the local storage keeps versions
+var _ VersionDisk = (*localstorage.LocalStorage)(nil)